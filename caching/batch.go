@@ -0,0 +1,292 @@
+package caching
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// batchSetRequest is the JSON body of a POST /mset request
+type batchSetRequest struct {
+	Entries []setRequest `json:"entries"`
+}
+
+// batchGetRequest is the JSON body of a POST /mget request
+type batchGetRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// batchGetResponse is the JSON body answering a POST /mget request. Missing keys are omitted.
+type batchGetResponse struct {
+	Entries map[string]setRequest `json:"entries"`
+}
+
+// MGetError reports the keys an MGet could not return, keyed by key
+type MGetError struct {
+	Errors map[string]error
+}
+
+func (e *MGetError) Error() string {
+	keys := make([]string, 0, len(e.Errors))
+	for key := range e.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return fmt.Sprintf("mget failed for %d keys: %s", len(keys), strings.Join(keys, ", "))
+}
+
+// MSet stores several key-value pairs with one local update and a single replication
+// request per owning node. Like Set it requires the write quorum for every key and
+// returns ErrQuorumNotMet naming how many keys fell short.
+func (cache *DistributedCache) MSet(pairs map[string]string) error {
+	acks := make(map[string]int, len(pairs))
+	batches := make(map[string][]setRequest)
+	targets := make(map[string]Node)
+
+	atomic.AddUint64(&cache.stats.sets, uint64(len(pairs)))
+	cache.mu.Lock()
+	for key, value := range pairs {
+		entry := cacheEntry{value: value, version: cache.nextVersion()}
+		local, peers := cache.owners(key)
+		if local {
+			cache.storeLocked(key, entry)
+			acks[key] = 1
+		} else {
+			acks[key] = 0
+		}
+		for _, node := range peers {
+			batches[node.Address] = append(batches[node.Address], setRequest{Key: key, Value: value, Version: entry.version})
+			targets[node.Address] = node
+		}
+	}
+	quorum := cache.writeQuorum
+	timeout := cache.replicaTimeout
+	cache.mu.Unlock()
+
+	type batchResult struct {
+		address string
+		err     error
+	}
+	results := make(chan batchResult, len(batches))
+	for address, entries := range batches {
+		go func(node Node, entries []setRequest) {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			err := cache.postToNode(ctx, node, "/mset", batchSetRequest{Entries: entries}, nil)
+			if err != nil {
+				log.Printf("Failed to replicate batch of %d keys on node %s: %v\n", len(entries), node.Address, err)
+			}
+			results <- batchResult{address: node.Address, err: err}
+		}(targets[address], entries)
+	}
+	for range batches {
+		result := <-results
+		if result.err != nil {
+			continue
+		}
+		for _, entry := range batches[result.address] {
+			acks[entry.Key]++
+		}
+	}
+
+	short := 0
+	for _, count := range acks {
+		if count < quorum {
+			short++
+		}
+	}
+	if short > 0 {
+		return fmt.Errorf("%w: %d of %d keys", ErrQuorumNotMet, short, len(pairs))
+	}
+	return nil
+}
+
+// MGet retrieves several keys, serving local hits directly and fetching the rest with a
+// single request per owning node, keeping the newest copy of each key. It returns the
+// values it found together with an *MGetError listing the keys it could not return.
+func (cache *DistributedCache) MGet(keys []string) (map[string]string, error) {
+	now := time.Now()
+	values := make(map[string]string, len(keys))
+	best := make(map[string]cacheEntry)
+	batches := make(map[string][]string)
+	targets := make(map[string]Node)
+
+	cache.mu.RLock()
+	for _, key := range keys {
+		if entry, ok := cache.data[key]; ok && !entry.expired(now) {
+			values[key] = entry.value
+			continue
+		}
+		_, peers := cache.owners(key)
+		for _, node := range peers {
+			batches[node.Address] = append(batches[node.Address], key)
+			targets[node.Address] = node
+		}
+	}
+	timeout := cache.replicaTimeout
+	cache.mu.RUnlock()
+
+	hits := make([]string, 0, len(values))
+	for key := range values {
+		hits = append(hits, key)
+	}
+	cache.touch(hits...)
+
+	type batchResult struct {
+		entries map[string]setRequest
+		err     error
+	}
+	results := make(chan batchResult, len(batches))
+	for address, batch := range batches {
+		go func(node Node, batch []string) {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			var resp batchGetResponse
+			err := cache.postToNode(ctx, node, "/mget", batchGetRequest{Keys: batch}, &resp)
+			if err != nil {
+				log.Printf("Failed to fetch batch of %d keys from node %s: %v\n", len(batch), node.Address, err)
+			}
+			results <- batchResult{entries: resp.Entries, err: err}
+		}(targets[address], batch)
+	}
+
+	var lastErr error
+	for range batches {
+		result := <-results
+		if result.err != nil {
+			lastErr = result.err
+			continue
+		}
+		for key, remote := range result.entries {
+			if current, ok := best[key]; !ok || remote.Version > current.version {
+				best[key] = cacheEntry{value: remote.Value, version: remote.Version}
+			}
+		}
+	}
+
+	atomic.AddUint64(&cache.stats.hits, uint64(len(values)+len(best)))
+	failed := make(map[string]error)
+	for _, key := range keys {
+		if _, ok := values[key]; ok {
+			continue
+		}
+		if entry, ok := best[key]; ok {
+			values[key] = entry.value
+			continue
+		}
+		if lastErr != nil {
+			failed[key] = fmt.Errorf("%w (last node error: %v)", ErrKeyNotFound, lastErr)
+		} else {
+			failed[key] = ErrKeyNotFound
+		}
+	}
+	if len(failed) > 0 {
+		atomic.AddUint64(&cache.stats.misses, uint64(len(failed)))
+		return values, &MGetError{Errors: failed}
+	}
+	return values, nil
+}
+
+// postToNode posts a JSON body to a node as a replica request and decodes the JSON response into out
+func (cache *DistributedCache) postToNode(ctx context.Context, node Node, path string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, node.Address+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(replicaHeader, "1")
+
+	resp, err := cache.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// serveMSet handles POST /mset. Replica requests are applied locally only.
+func (cache *DistributedCache) serveMSet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req batchSetRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxSetBodyBytes)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if r.Header.Get(replicaHeader) != "" {
+		for _, entry := range req.Entries {
+			local := cacheEntry{value: entry.Value, version: entry.Version}
+			if entry.ExpiresAt != 0 {
+				local.expiresAt = time.Unix(0, entry.ExpiresAt)
+			}
+			cache.setLocal(entry.Key, local)
+		}
+	} else {
+		pairs := make(map[string]string, len(req.Entries))
+		for _, entry := range req.Entries {
+			pairs[entry.Key] = entry.Value
+		}
+		if err := cache.MSet(pairs); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("OK"))
+}
+
+// serveMGet handles POST /mget. Replica requests are answered from the local copy only.
+func (cache *DistributedCache) serveMGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req batchGetRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxSetBodyBytes)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp := batchGetResponse{Entries: make(map[string]setRequest, len(req.Keys))}
+	if r.Header.Get(replicaHeader) != "" {
+		for _, key := range req.Keys {
+			if entry, ok := cache.getLocal(key); ok {
+				remote := setRequest{Key: key, Value: entry.value, Version: entry.version}
+				if !entry.expiresAt.IsZero() {
+					remote.ExpiresAt = entry.expiresAt.UnixNano()
+				}
+				resp.Entries[key] = remote
+			}
+		}
+	} else {
+		values, _ := cache.MGet(req.Keys)
+		for key, value := range values {
+			resp.Entries[key] = setRequest{Key: key, Value: value}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"caching"
+	"log"
+	"net/http"
+)
+
+func main() {
+	nodes := []caching.Node{
+		{Address: "http://localhost:8001"},
+		{Address: "http://localhost:8002"},
+		{Address: "http://localhost:8003"},
+	}
+
+	cache := caching.NewDistributedCache(nodes)
+
+	http.Handle("/", cache)
+	log.Fatal(http.ListenAndServe(":8000", nil))
+}
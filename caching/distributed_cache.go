@@ -1,58 +1,349 @@
-package main
+package caching
 
 import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"math/rand"
 	"net/http"
+	neturl "net/url"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"distributed_systems/cluster"
+)
+
+const (
+	// defaultReplicaTimeout bounds each replication request so a dead node can't hang a write
+	defaultReplicaTimeout = 2 * time.Second
+	// defaultSweepInterval is how often expired entries are reclaimed
+	defaultSweepInterval = time.Minute
+	// defaultReplicas is the number of copies kept in addition to a key's primary node
+	defaultReplicas = 2
+	// defaultHeartbeatInterval is how often the leader is pinged
+	defaultHeartbeatInterval = 5 * time.Second
+	// defaultFailureThreshold is how many consecutive missed heartbeats trigger failover
+	defaultFailureThreshold = 3
+	// defaultPingTimeout bounds a single heartbeat so a hung node can't stall the monitor
+	defaultPingTimeout = time.Second
+	// defaultTombstoneTTL is how long a deletion is remembered, so read-repair can't bring
+	// back older copies of the key from nodes that missed it
+	defaultTombstoneTTL = 10 * time.Minute
+	// maxSetBodyBytes bounds the size of a POST /set body
+	maxSetBodyBytes = 16 << 20
+	// replicaHeader marks requests forwarded by another node, which are applied locally only
+	replicaHeader = "X-Cache-Replica"
+	// versionHeader and expiresHeader carry entry metadata on replica /get responses
+	versionHeader = "X-Cache-Version"
+	expiresHeader = "X-Cache-Expires"
 )
 
+var (
+	// ErrQuorumNotMet is returned when fewer than the write quorum of nodes acknowledged a write
+	ErrQuorumNotMet = errors.New("write quorum not met")
+	// ErrKeyNotFound is returned when no node holds the key
+	ErrKeyNotFound = errors.New("key not found")
+)
+
+// defaultClient is used for requests to other nodes without WithHTTPClient. Requests carry
+// their own deadlines; its timeout is a backstop for a hung connection.
+var defaultClient = &http.Client{Timeout: defaultReplicaTimeout}
+
 // Node represents a cache node in the distributed system
-type Node struct {
-	Address string
-	Client  *http.Client
+type Node = cluster.Node
+
+// cacheEntry is a cached value with its optional expiry and version. Versions are logical
+// timestamps; when copies diverge the highest version wins.
+type cacheEntry struct {
+	value     string
+	expiresAt time.Time // zero for entries that never expire
+	version   uint64
+}
+
+// expired reports whether the entry has expired at now
+func (e cacheEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// tombstone records the version at which a key was deleted
+type tombstone struct {
+	version   uint64
+	expiresAt time.Time
 }
 
 // DistributedCache represents the main cache with multiple nodes
 type DistributedCache struct {
-	mu     sync.RWMutex
-	data   map[string]string
-	nodes  []Node
-	leader int
+	mu                sync.RWMutex
+	data              map[string]cacheEntry
+	tombstones        map[string]tombstone // recently deleted keys
+	tombstoneTTL      time.Duration        // how long a deletion is remembered
+	nodes             []Node
+	leader            int
+	self              string        // address of this node among nodes
+	ring              *HashRing     // assigns each key to its owning nodes
+	replicas          int           // copies kept in addition to the primary
+	virtualNodes      int           // ring positions per node
+	legacyGetSet      bool          // replicate sets as GET query strings for older nodes
+	clock             uint64        // last version issued or observed
+	writeQuorum       int           // acknowledgements required for a write, including the local one
+	replicaTimeout    time.Duration // per-replica request timeout
+	sweepInterval     time.Duration // how often expired entries are reclaimed
+	heartbeatInterval time.Duration // time between leader heartbeats
+	failureThreshold  int           // consecutive missed heartbeats before failover
+	pingClient        *http.Client  // short-timeout client used for heartbeats
+	client            *http.Client  // client for replication and data requests to other nodes
+	stats             cacheStats
+	maxEntries        int                      // local entry bound; 0 is unbounded
+	recency           *list.List               // keys from most to least recently used
+	lruElements       map[string]*list.Element // key to its recency list element
+}
+
+// CacheOption configures a DistributedCache
+type CacheOption func(*DistributedCache)
+
+// WithSelfAddress identifies which of the nodes is the local one. Without it the first
+// node is treated as the local node.
+func WithSelfAddress(address string) CacheOption {
+	return func(cache *DistributedCache) {
+		cache.self = address
+	}
+}
+
+// WithWriteQuorum makes Set wait for w acknowledgements, counting the local write, before
+// reporting success
+func WithWriteQuorum(w int) CacheOption {
+	return func(cache *DistributedCache) {
+		cache.writeQuorum = w
+	}
+}
+
+// WithReplicaTimeout bounds how long a write waits on each replica
+func WithReplicaTimeout(timeout time.Duration) CacheOption {
+	return func(cache *DistributedCache) {
+		cache.replicaTimeout = timeout
+	}
+}
+
+// WithReplicas sets how many nodes hold a copy of each key in addition to its primary
+func WithReplicas(replicas int) CacheOption {
+	return func(cache *DistributedCache) {
+		cache.replicas = replicas
+	}
+}
+
+// WithVirtualNodes sets how many hash ring positions each node gets
+func WithVirtualNodes(virtualNodes int) CacheOption {
+	return func(cache *DistributedCache) {
+		cache.virtualNodes = virtualNodes
+	}
+}
+
+// WithLegacyGetReplication replicates sets as GET requests with query parameters, for
+// clusters that still contain nodes without the POST /set endpoint
+func WithLegacyGetReplication() CacheOption {
+	return func(cache *DistributedCache) {
+		cache.legacyGetSet = true
+	}
+}
+
+// WithHeartbeat sets how often the leader is pinged, how many consecutive missed
+// heartbeats trigger a new election, and the timeout of a single ping
+func WithHeartbeat(interval time.Duration, failureThreshold int, timeout time.Duration) CacheOption {
+	return func(cache *DistributedCache) {
+		cache.heartbeatInterval = interval
+		cache.failureThreshold = failureThreshold
+		cache.pingClient = &http.Client{Timeout: timeout}
+	}
+}
+
+// WithHTTPClient sets the client used for replication and data requests to other nodes
+func WithHTTPClient(client *http.Client) CacheOption {
+	return func(cache *DistributedCache) {
+		cache.client = client
+	}
+}
+
+// WithSweepInterval sets how often the background sweeper reclaims expired entries
+func WithSweepInterval(interval time.Duration) CacheOption {
+	return func(cache *DistributedCache) {
+		cache.sweepInterval = interval
+	}
+}
+
+// WithTombstoneTTL sets how long a deleted key is remembered. A node that misses a deletion
+// and comes back after this long can still return the deleted value.
+func WithTombstoneTTL(ttl time.Duration) CacheOption {
+	return func(cache *DistributedCache) {
+		cache.tombstoneTTL = ttl
+	}
 }
 
 // NewDistributedCache initializes a distributed cache
-func NewDistributedCache(nodes []Node) *DistributedCache {
+func NewDistributedCache(nodes []Node, opts ...CacheOption) *DistributedCache {
 	cache := &DistributedCache{
-		data:   make(map[string]string),
-		nodes:  nodes,
-		leader: 0, // Initially, the first node is the leader
+		data:           make(map[string]cacheEntry),
+		tombstones:     make(map[string]tombstone),
+		tombstoneTTL:   defaultTombstoneTTL,
+		recency:        list.New(),
+		lruElements:    make(map[string]*list.Element),
+		nodes:          nodes,
+		leader:         0, // Initially, the first node is the leader
+		writeQuorum:    1,
+		replicaTimeout: defaultReplicaTimeout,
+		sweepInterval:  defaultSweepInterval,
+		replicas:       defaultReplicas,
+		virtualNodes:   defaultVirtualNodes,
+
+		heartbeatInterval: defaultHeartbeatInterval,
+		failureThreshold:  defaultFailureThreshold,
+		pingClient:        &http.Client{Timeout: defaultPingTimeout},
+	}
+	for _, opt := range opts {
+		opt(cache)
+	}
+	if cache.self == "" && len(nodes) > 0 {
+		cache.self = nodes[0].Address
+	}
+	cache.ring = NewHashRing(cache.virtualNodes)
+	for _, node := range nodes {
+		cache.ring.Add(node.Address)
 	}
 	go cache.monitorLeader()
+	go cache.sweepExpired()
 	return cache
 }
 
-// monitorLeader checks the status of the leader and elects a new one
+// sweepExpired periodically removes expired entries that were never read again, and
+// tombstones that are no longer needed
+func (cache *DistributedCache) sweepExpired() {
+	ticker := time.NewTicker(cache.sweepInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		cache.mu.Lock()
+		for key, entry := range cache.data {
+			if entry.expired(now) {
+				cache.removeLocked(key)
+				atomic.AddUint64(&cache.stats.expirations, 1)
+			}
+		}
+		for key, deleted := range cache.tombstones {
+			if !now.Before(deleted.expiresAt) {
+				delete(cache.tombstones, key)
+			}
+		}
+		cache.mu.Unlock()
+	}
+}
+
+// owners returns whether this node owns a key and the other nodes owning it; cache.mu must be held
+func (cache *DistributedCache) owners(key string) (bool, []Node) {
+	local := false
+	var peers []Node
+	for _, address := range cache.ring.Get(key, cache.replicas+1) {
+		if address == cache.self {
+			local = true
+			continue
+		}
+		if node, ok := cache.nodeByAddress(address); ok {
+			peers = append(peers, node)
+		}
+	}
+	return local, peers
+}
+
+// nodeByAddress looks up a member node; cache.mu must be held
+func (cache *DistributedCache) nodeByAddress(address string) (Node, bool) {
+	for _, node := range cache.nodes {
+		if node.Address == address {
+			return node, true
+		}
+	}
+	return Node{}, false
+}
+
+// httpClient returns the configured client, falling back to defaultClient
+func (cache *DistributedCache) httpClient() *http.Client {
+	if cache.client != nil {
+		return cache.client
+	}
+	return defaultClient
+}
+
+// monitorLeader sends heartbeats to the leader and elects a new one once the leader has
+// missed failureThreshold consecutive heartbeats. After a miss the next heartbeat backs
+// off exponentially, and every wait is jittered so nodes don't probe in lockstep.
 func (cache *DistributedCache) monitorLeader() {
+	misses := 0
 	for {
-		time.Sleep(5 * time.Second)
-		cache.mu.Lock()
-		leader := cache.nodes[cache.leader]
-		if !cache.pingNode(leader) {
+		time.Sleep(cache.heartbeatDelay(misses))
+
+		cache.mu.RLock()
+		if len(cache.nodes) == 0 {
+			cache.mu.RUnlock()
+			continue
+		}
+		leader := cache.nodes[cache.leader%len(cache.nodes)]
+		cache.mu.RUnlock()
+
+		// Ping without holding the lock so a slow leader doesn't block cache operations
+		if cache.pingNode(leader) {
+			misses = 0
+			continue
+		}
+		misses++
+		log.Printf("Leader %s missed heartbeat (%d/%d)\n", leader.Address, misses, cache.failureThreshold)
+		if misses >= cache.failureThreshold {
 			fmt.Println("Leader is down, electing a new leader...")
 			cache.electNewLeader()
+			misses = 0
 		}
-		cache.mu.Unlock()
 	}
 }
 
+// heartbeatDelay returns the jittered wait before the next heartbeat. Each consecutive
+// miss doubles the wait, up to four times the heartbeat interval.
+func (cache *DistributedCache) heartbeatDelay(misses int) time.Duration {
+	maxDelay := 4 * cache.heartbeatInterval
+	delay := cache.heartbeatInterval
+	for i := 0; i < misses && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	// Spread heartbeats by up to 20% either way
+	spread := int64(delay) / 5
+	if spread <= 0 {
+		return delay
+	}
+	return delay + time.Duration(rand.Int63n(2*spread+1)-spread)
+}
+
 // electNewLeader selects a new leader from available nodes
 func (cache *DistributedCache) electNewLeader() {
-	for i, node := range cache.nodes {
+	cache.mu.RLock()
+	nodes := make([]Node, len(cache.nodes))
+	copy(nodes, cache.nodes)
+	cache.mu.RUnlock()
+
+	for _, node := range nodes {
 		if cache.pingNode(node) {
-			cache.leader = i
+			// Look the node up again as membership may have changed during the pings
+			cache.mu.Lock()
+			for i, member := range cache.nodes {
+				if member.Address == node.Address {
+					cache.leader = i
+				}
+			}
+			cache.mu.Unlock()
 			fmt.Printf("New leader elected: %s\n", node.Address)
 			return
 		}
@@ -62,100 +353,486 @@ func (cache *DistributedCache) electNewLeader() {
 
 // pingNode checks if a node is reachable
 func (cache *DistributedCache) pingNode(node Node) bool {
-	_, err := http.Get(node.Address + "/ping")
-	return err == nil
+	resp, err := cache.pingClient.Get(node.Address + "/ping")
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
 }
 
-// Set stores a key-value pair in the distributed cache
+// Set stores a key-value pair on the nodes owning the key. It returns once the write quorum
+// of owners, including this node when it is one, has acknowledged the write, or
+// ErrQuorumNotMet if too many replicas failed. Replication to the remaining owners
+// continues in the background.
 func (cache *DistributedCache) Set(key, value string) error {
+	return cache.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL stores a key-value pair that expires after ttl; a non-positive ttl never expires.
+// Replicas receive the absolute expiry so every copy expires at the same time.
+func (cache *DistributedCache) SetWithTTL(key, value string, ttl time.Duration) error {
+	entry := cacheEntry{value: value}
+	if ttl > 0 {
+		entry.expiresAt = time.Now().Add(ttl)
+	}
+
 	cache.mu.Lock()
-	defer cache.mu.Unlock()
+	entry.version = cache.nextVersion()
+	local, peers := cache.owners(key)
+	atomic.AddUint64(&cache.stats.sets, 1)
+	acks := 0
+	if local {
+		// Set value in local cache
+		cache.storeLocked(key, entry)
+		acks = 1
+	}
+	quorum := cache.writeQuorum
+	timeout := cache.replicaTimeout
+	cache.mu.Unlock()
 
-	// Set value in local cache
-	cache.data[key] = value
+	if quorum > len(peers)+acks {
+		return fmt.Errorf("%w: quorum of %d exceeds %d owners", ErrQuorumNotMet, quorum, len(peers)+acks)
+	}
 
 	// Replicate the change to other nodes
-	for i, node := range cache.nodes {
-		if i != cache.leader {
-			go cache.replicateSet(node, key, value)
-		}
+	results := make(chan error, len(peers))
+	for _, node := range peers {
+		go func(node Node) {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			err := cache.replicateSet(ctx, node, key, entry)
+			if err != nil {
+				log.Printf("Failed to replicate set on node %s: %v\n", node.Address, err)
+			}
+			results <- err
+		}(node)
 	}
 
+	// reachable is the most acknowledgements still possible
+	reachable := acks + len(peers)
+	for acks < quorum {
+		if err := <-results; err != nil {
+			reachable--
+			if reachable < quorum {
+				return fmt.Errorf("%w: %d of %d acknowledgements", ErrQuorumNotMet, acks, quorum)
+			}
+			continue
+		}
+		acks++
+	}
 	return nil
 }
 
+// Rebalance moves local entries to their owners after the hash ring changed. Each entry is
+// copied to the other nodes now owning it, and entries this node no longer owns are dropped
+// once every owner has a copy.
+func (cache *DistributedCache) Rebalance() {
+	cache.mu.RLock()
+	snapshot := make(map[string]cacheEntry, len(cache.data))
+	for key, entry := range cache.data {
+		snapshot[key] = entry
+	}
+	timeout := cache.replicaTimeout
+	cache.mu.RUnlock()
+
+	now := time.Now()
+	for key, entry := range snapshot {
+		if entry.expired(now) {
+			continue
+		}
+
+		cache.mu.RLock()
+		local, peers := cache.owners(key)
+		cache.mu.RUnlock()
+
+		moved := true
+		for _, node := range peers {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			if err := cache.replicateSet(ctx, node, key, entry); err != nil {
+				log.Printf("Failed to move key %s to node %s: %v\n", key, node.Address, err)
+				moved = false
+			}
+			cancel()
+		}
+
+		if !local && moved {
+			cache.mu.Lock()
+			if current, ok := cache.data[key]; ok && current == entry {
+				cache.removeLocked(key)
+			}
+			cache.mu.Unlock()
+		}
+	}
+}
+
+// nextVersion issues a version newer than any seen by this node; cache.mu must be held
+func (cache *DistributedCache) nextVersion() uint64 {
+	version := uint64(time.Now().UnixNano())
+	if version <= cache.clock {
+		version = cache.clock + 1
+	}
+	cache.clock = version
+	return version
+}
+
+// setLocal stores a replicated entry without forwarding it. Entries older than the local
+// copy are ignored so a late or repeated replication can't overwrite a newer value.
+func (cache *DistributedCache) setLocal(key string, entry cacheEntry) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if entry.version > cache.clock {
+		cache.clock = entry.version
+	}
+	if current, ok := cache.data[key]; ok && current.version > entry.version {
+		return
+	}
+	if deleted, ok := cache.tombstones[key]; ok && deleted.version >= entry.version {
+		return
+	}
+	cache.storeLocked(key, entry)
+}
+
+// setRequest is the JSON body of a POST /set request. Clients set TTL as a duration
+// string; replicas receive the absolute ExpiresAt in Unix nanoseconds instead.
+type setRequest struct {
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	TTL       string `json:"ttl,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+	Version   uint64 `json:"version,omitempty"`
+}
+
 // replicateSet sends a SET request to another node
-func (cache *DistributedCache) replicateSet(node Node, key, value string) {
-	url := fmt.Sprintf("%s/set?key=%s&value=%s", node.Address, key, value)
-	_, err := http.Get(url)
+func (cache *DistributedCache) replicateSet(ctx context.Context, node Node, key string, entry cacheEntry) error {
+	body := setRequest{Key: key, Value: entry.value, Version: entry.version}
+	if !entry.expiresAt.IsZero() {
+		body.ExpiresAt = entry.expiresAt.UnixNano()
+	}
+
+	var req *http.Request
+	var err error
+	if cache.legacyGetSet {
+		query := neturl.Values{"key": {key}, "value": {entry.value}}
+		if body.ExpiresAt != 0 {
+			query.Set("expires", strconv.FormatInt(body.ExpiresAt, 10))
+		}
+		query.Set("version", strconv.FormatUint(body.Version, 10))
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, node.Address+"/set?"+query.Encode(), nil)
+	} else {
+		payload, marshalErr := json.Marshal(body)
+		if marshalErr != nil {
+			return marshalErr
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, node.Address+"/set", bytes.NewReader(payload))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	req.Header.Set(replicaHeader, "1")
+
+	resp, err := cache.httpClient().Do(req)
 	if err != nil {
-		log.Printf("Failed to replicate set on node %s: %v\n", node.Address, err)
+		return err
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
 }
 
 // Get retrieves a value from the distributed cache
 func (cache *DistributedCache) Get(key string) (string, error) {
-	cache.mu.RLock()
-	defer cache.mu.RUnlock()
+	now := time.Now()
 
 	// Check local cache first
-	value, ok := cache.data[key]
+	cache.mu.RLock()
+	entry, ok := cache.data[key]
+	deleted, wasDeleted := cache.tombstones[key]
+	_, peers := cache.owners(key)
+	timeout := cache.replicaTimeout
+	cache.mu.RUnlock()
+
+	if ok && !entry.expired(now) {
+		cache.touch(key)
+		atomic.AddUint64(&cache.stats.hits, 1)
+		return entry.value, nil
+	}
 	if ok {
-		return value, nil
+		// Lazily drop the expired entry unless it was replaced meanwhile
+		cache.mu.Lock()
+		if current, exists := cache.data[key]; exists && current.expired(now) {
+			cache.removeLocked(key)
+			atomic.AddUint64(&cache.stats.expirations, 1)
+		}
+		cache.mu.Unlock()
 	}
 
-	// If not found, try to fetch from other nodes
-	for _, node := range cache.nodes {
-		val, err := cache.fetchFromNode(node, key)
-		if err == nil {
-			return val, nil
+	// If not found, ask every other owner at once and keep the newest copy
+	type fetchResult struct {
+		entry cacheEntry
+		err   error
+	}
+	results := make([]fetchResult, len(peers))
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	var wg sync.WaitGroup
+	for i, node := range peers {
+		wg.Add(1)
+		go func(i int, node Node) {
+			defer wg.Done()
+			remote, err := cache.fetchFromNode(ctx, node, key)
+			results[i] = fetchResult{entry: remote, err: err}
+		}(i, node)
+	}
+	wg.Wait()
+	cancel()
+
+	var winner cacheEntry
+	found := false
+	var deletedVersion uint64
+	if wasDeleted && now.Before(deleted.expiresAt) {
+		deletedVersion = deleted.version
+	}
+	versions := make([]uint64, len(peers))
+	reachable := make([]bool, len(peers))
+	for i, result := range results {
+		if result.err == ErrKeyNotFound {
+			// A miss carries the version of the node's tombstone, if it has one
+			reachable[i] = true
+			versions[i] = result.entry.version
+			if result.entry.version > deletedVersion {
+				deletedVersion = result.entry.version
+			}
+			continue
+		}
+		if result.err != nil {
+			continue
+		}
+		reachable[i] = true
+		versions[i] = result.entry.version
+		if !found || result.entry.version > winner.version {
+			winner = result.entry
+			found = true
+		}
+	}
+
+	// A deletion newer than every copy wins, and is repaired onto the owners still holding one
+	if !found || winner.version <= deletedVersion {
+		atomic.AddUint64(&cache.stats.misses, 1)
+		if found {
+			var stale []Node
+			for i, node := range peers {
+				if reachable[i] && versions[i] < deletedVersion {
+					stale = append(stale, node)
+				}
+			}
+			go cache.repairDelete(key, deletedVersion, stale)
+		}
+		return "", ErrKeyNotFound
+	}
+	atomic.AddUint64(&cache.stats.hits, 1)
+
+	// Read-repair: write the winning copy back to owners that are missing it or stale
+	var stale []Node
+	for i, node := range peers {
+		if reachable[i] && versions[i] < winner.version {
+			stale = append(stale, node)
+		}
+	}
+	go cache.readRepair(key, winner, stale)
+
+	return winner.value, nil
+}
+
+// readRepair copies the winning entry to stale owners, and locally if this node owns the key
+func (cache *DistributedCache) readRepair(key string, entry cacheEntry, stale []Node) {
+	cache.mu.RLock()
+	local, _ := cache.owners(key)
+	timeout := cache.replicaTimeout
+	cache.mu.RUnlock()
+
+	if local {
+		cache.setLocal(key, entry)
+	}
+	for _, node := range stale {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		if err := cache.replicateSet(ctx, node, key, entry); err != nil {
+			log.Printf("Failed to read-repair key %s on node %s: %v\n", key, node.Address, err)
 		}
+		cancel()
 	}
+}
+
+// repairDelete copies a deletion to stale owners, and locally if this node owns the key
+func (cache *DistributedCache) repairDelete(key string, version uint64, stale []Node) {
+	cache.mu.RLock()
+	local, _ := cache.owners(key)
+	timeout := cache.replicaTimeout
+	cache.mu.RUnlock()
 
-	return "", errors.New("key not found")
+	if local {
+		cache.deleteLocal(key, version)
+	}
+	for _, node := range stale {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		if err := cache.replicateDelete(ctx, node, key, version); err != nil {
+			log.Printf("Failed to read-repair deletion of key %s on node %s: %v\n", key, node.Address, err)
+		}
+		cancel()
+	}
 }
 
-// fetchFromNode attempts to get a value from a specific node
-func (cache *DistributedCache) fetchFromNode(node Node, key string) (string, error) {
-	url := fmt.Sprintf("%s/get?key=%s", node.Address, key)
-	resp, err := http.Get(url)
+// deletedVersion returns the version at which a key was deleted, if this node remembers
+func (cache *DistributedCache) deletedVersion(key string) (uint64, bool) {
+	cache.mu.RLock()
+	deleted, ok := cache.tombstones[key]
+	cache.mu.RUnlock()
+
+	if !ok || !time.Now().Before(deleted.expiresAt) {
+		return 0, false
+	}
+	return deleted.version, true
+}
+
+// getLocal returns a key from this node only, treating expired entries as missing
+func (cache *DistributedCache) getLocal(key string) (cacheEntry, bool) {
+	cache.mu.RLock()
+	entry, ok := cache.data[key]
+	cache.mu.RUnlock()
+
+	if !ok || entry.expired(time.Now()) {
+		return cacheEntry{}, false
+	}
+	cache.touch(key)
+	return entry, true
+}
+
+// fetchFromNode attempts to get a value from a specific node. The value is returned
+// verbatim with its version and expiry. A 404 response is reported as ErrKeyNotFound,
+// together with the version of the deletion when the node remembers one.
+func (cache *DistributedCache) fetchFromNode(ctx context.Context, node Node, key string) (cacheEntry, error) {
+	url := fmt.Sprintf("%s/get?key=%s", node.Address, neturl.QueryEscape(key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return "", err
+		return cacheEntry{}, err
+	}
+	// Ask for the node's local copy so it doesn't fan the lookup back out
+	req.Header.Set(replicaHeader, "1")
+
+	resp, err := cache.httpClient().Do(req)
+	if err != nil {
+		return cacheEntry{}, err
 	}
 	defer resp.Body.Close()
 
-	var value string
-	if _, err := fmt.Fscanf(resp.Body, "%s", &value); err != nil {
-		return "", err
+	var entry cacheEntry
+	// Nodes predating versioning send no metadata and rank as the oldest copy
+	if raw := resp.Header.Get(versionHeader); raw != "" {
+		if entry.version, err = strconv.ParseUint(raw, 10, 64); err != nil {
+			return cacheEntry{}, fmt.Errorf("invalid version from node %s: %w", node.Address, err)
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return cacheEntry{version: entry.version}, ErrKeyNotFound
+	default:
+		return cacheEntry{}, fmt.Errorf("unexpected status %d from node %s", resp.StatusCode, node.Address)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return cacheEntry{}, err
 	}
-	return value, nil
+	entry.value = string(body)
+	if raw := resp.Header.Get(expiresHeader); raw != "" {
+		nanos, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return cacheEntry{}, fmt.Errorf("invalid expiry from node %s: %w", node.Address, err)
+		}
+		entry.expiresAt = time.Unix(0, nanos)
+	}
+	return entry, nil
 }
 
-// Delete removes a key-value pair from the distributed cache
+// Delete removes a key-value pair from the distributed cache. The deletion is versioned
+// like a write and leaves a tombstone, so older copies of the key are not read back.
 func (cache *DistributedCache) Delete(key string) error {
 	cache.mu.Lock()
-	defer cache.mu.Unlock()
-
 	// Delete from local cache
-	delete(cache.data, key)
+	version := cache.nextVersion()
+	cache.deleteLocked(key, version)
+	atomic.AddUint64(&cache.stats.deletes, 1)
+	_, peers := cache.owners(key)
+	timeout := cache.replicaTimeout
+	cache.mu.Unlock()
 
-	// Replicate the deletion to other nodes
-	for i, node := range cache.nodes {
-		if i != cache.leader {
-			go cache.replicateDelete(node, key)
-		}
+	// Replicate the deletion to the other owners
+	for _, node := range peers {
+		go func(node Node) {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			if err := cache.replicateDelete(ctx, node, key, version); err != nil {
+				log.Printf("Failed to replicate delete on node %s: %v\n", node.Address, err)
+			}
+		}(node)
 	}
 
 	return nil
 }
 
-// replicateDelete sends a DELETE request to another node
-func (cache *DistributedCache) replicateDelete(node Node, key string) {
-	url := fmt.Sprintf("%s/delete?key=%s", node.Address, key)
-	_, err := http.Get(url)
+// deleteLocked removes a key and records a tombstone at version, unless the local copy is
+// newer than the deletion; cache.mu must be held for writing
+func (cache *DistributedCache) deleteLocked(key string, version uint64) {
+	if current, ok := cache.data[key]; ok && current.version > version {
+		return
+	}
+	cache.removeLocked(key)
+	if deleted, ok := cache.tombstones[key]; !ok || deleted.version < version {
+		cache.tombstones[key] = tombstone{version: version, expiresAt: time.Now().Add(cache.tombstoneTTL)}
+	}
+}
+
+// deleteLocal applies a replicated deletion without forwarding it. Deletions from nodes
+// predating versioning carry no version and are stamped with a local one.
+func (cache *DistributedCache) deleteLocal(key string, version uint64) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if version == 0 {
+		version = cache.nextVersion()
+	} else if version > cache.clock {
+		cache.clock = version
+	}
+	cache.deleteLocked(key, version)
+}
+
+// replicateDelete sends a DELETE request with the deletion's version to another node
+func (cache *DistributedCache) replicateDelete(ctx context.Context, node Node, key string, version uint64) error {
+	query := neturl.Values{"key": {key}, "version": {strconv.FormatUint(version, 10)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, node.Address+"/delete?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(replicaHeader, "1")
+
+	resp, err := cache.httpClient().Do(req)
 	if err != nil {
-		log.Printf("Failed to replicate delete on node %s: %v\n", node.Address, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
 	}
+	return nil
 }
 
 // ServeHTTP allows the cache to respond to HTTP requests
@@ -164,36 +841,122 @@ func (cache *DistributedCache) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	case "/ping":
 		w.Write([]byte("pong"))
 	case "/set":
-		key := r.URL.Query().Get("key")
-		value := r.URL.Query().Get("value")
-		cache.Set(key, value)
+		req, err := parseSetRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get(replicaHeader) != "" {
+			entry := cacheEntry{value: req.Value, version: req.Version}
+			if req.ExpiresAt != 0 {
+				entry.expiresAt = time.Unix(0, req.ExpiresAt)
+			}
+			cache.setLocal(req.Key, entry)
+		} else {
+			var ttl time.Duration
+			if req.TTL != "" {
+				parsed, err := time.ParseDuration(req.TTL)
+				if err != nil {
+					http.Error(w, "Invalid ttl", http.StatusBadRequest)
+					return
+				}
+				ttl = parsed
+			}
+			if err := cache.SetWithTTL(req.Key, req.Value, ttl); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.Write([]byte("OK"))
 	case "/get":
 		key := r.URL.Query().Get("key")
+		if r.Header.Get(replicaHeader) != "" {
+			entry, ok := cache.getLocal(key)
+			if !ok {
+				// Report the deletion so the caller doesn't repair the key back
+				if version, deleted := cache.deletedVersion(key); deleted {
+					w.Header().Set(versionHeader, strconv.FormatUint(version, 10))
+				}
+				http.Error(w, "Not Found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set(versionHeader, strconv.FormatUint(entry.version, 10))
+			if !entry.expiresAt.IsZero() {
+				w.Header().Set(expiresHeader, strconv.FormatInt(entry.expiresAt.UnixNano(), 10))
+			}
+			w.Write([]byte(entry.value))
+			return
+		}
 		value, err := cache.Get(key)
 		if err != nil {
 			http.Error(w, "Not Found", http.StatusNotFound)
 			return
 		}
 		w.Write([]byte(value))
+	case "/stats":
+		cache.serveStats(w, r)
+	case "/mset":
+		cache.serveMSet(w, r)
+	case "/mget":
+		cache.serveMGet(w, r)
+	case "/nodes":
+		cache.serveNodes(w, r)
 	case "/delete":
 		key := r.URL.Query().Get("key")
-		cache.Delete(key)
+		if r.Header.Get(replicaHeader) != "" {
+			var version uint64
+			if raw := r.URL.Query().Get("version"); raw != "" {
+				parsed, err := strconv.ParseUint(raw, 10, 64)
+				if err != nil {
+					http.Error(w, "Invalid version", http.StatusBadRequest)
+					return
+				}
+				version = parsed
+			}
+			cache.deleteLocal(key, version)
+		} else {
+			cache.Delete(key)
+		}
 		w.Write([]byte("OK"))
 	default:
 		http.Error(w, "Invalid endpoint", http.StatusNotFound)
 	}
 }
 
-func main() {
-	nodes := []Node{
-		{Address: "http://localhost:8001", Client: &http.Client{}},
-		{Address: "http://localhost:8002", Client: &http.Client{}},
-		{Address: "http://localhost:8003", Client: &http.Client{}},
+// parseSetRequest reads a set from a JSON POST body, or from query parameters for the
+// legacy GET form
+func parseSetRequest(r *http.Request) (setRequest, error) {
+	var req setRequest
+	switch r.Method {
+	case http.MethodPost, http.MethodPut:
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxSetBodyBytes)).Decode(&req); err != nil {
+			return req, fmt.Errorf("invalid request body: %w", err)
+		}
+	case http.MethodGet:
+		query := r.URL.Query()
+		req.Key = query.Get("key")
+		req.Value = query.Get("value")
+		req.TTL = query.Get("ttl")
+		if expires := query.Get("expires"); expires != "" {
+			nanos, err := strconv.ParseInt(expires, 10, 64)
+			if err != nil {
+				return req, errors.New("invalid expires")
+			}
+			req.ExpiresAt = nanos
+		}
+		if version := query.Get("version"); version != "" {
+			parsed, err := strconv.ParseUint(version, 10, 64)
+			if err != nil {
+				return req, errors.New("invalid version")
+			}
+			req.Version = parsed
+		}
+	default:
+		return req, fmt.Errorf("method %s not allowed", r.Method)
 	}
-
-	cache := NewDistributedCache(nodes)
-
-	http.Handle("/", cache)
-	log.Fatal(http.ListenAndServe(":8000", nil))
+	if req.Key == "" {
+		return req, errors.New("missing key")
+	}
+	return req, nil
 }
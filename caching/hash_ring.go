@@ -0,0 +1,121 @@
+package caching
+
+import (
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"sync"
+)
+
+// defaultVirtualNodes is the number of ring positions each node gets when none is configured
+const defaultVirtualNodes = 100
+
+// HashRing maps keys to nodes with consistent hashing. Each node is placed on the ring
+// at several virtual positions so keys spread evenly and only a small share of keys
+// moves when membership changes.
+type HashRing struct {
+	mu           sync.RWMutex
+	virtualNodes int
+	hashes       []uint32          // sorted ring positions
+	owners       map[uint32]string // ring position to node address
+	nodes        map[string]bool
+}
+
+// NewHashRing creates an empty ring placing each node at virtualNodes positions
+func NewHashRing(virtualNodes int) *HashRing {
+	if virtualNodes <= 0 {
+		virtualNodes = defaultVirtualNodes
+	}
+	return &HashRing{
+		virtualNodes: virtualNodes,
+		owners:       make(map[uint32]string),
+		nodes:        make(map[string]bool),
+	}
+}
+
+// hashKey returns the ring position of a key
+func hashKey(key string) uint32 {
+	return crc32.ChecksumIEEE([]byte(key))
+}
+
+// Add places a node on the ring; adding a node twice has no effect
+func (r *HashRing) Add(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.nodes[node] {
+		return
+	}
+	r.nodes[node] = true
+	for i := 0; i < r.virtualNodes; i++ {
+		h := hashKey(fmt.Sprintf("%s#%d", node, i))
+		if _, taken := r.owners[h]; taken {
+			// Keep the existing owner on the rare collision
+			continue
+		}
+		r.owners[h] = node
+		r.hashes = append(r.hashes, h)
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+}
+
+// Remove takes a node off the ring
+func (r *HashRing) Remove(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.nodes[node] {
+		return
+	}
+	delete(r.nodes, node)
+	hashes := r.hashes[:0]
+	for _, h := range r.hashes {
+		if r.owners[h] == node {
+			delete(r.owners, h)
+			continue
+		}
+		hashes = append(hashes, h)
+	}
+	r.hashes = hashes
+}
+
+// Get returns up to n distinct nodes responsible for a key, primary first, walking
+// clockwise from the key's position
+func (r *HashRing) Get(key string, n int) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.hashes) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(r.nodes) {
+		n = len(r.nodes)
+	}
+
+	h := hashKey(key)
+	start := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+
+	owners := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; len(owners) < n && i < len(r.hashes); i++ {
+		node := r.owners[r.hashes[(start+i)%len(r.hashes)]]
+		if !seen[node] {
+			seen[node] = true
+			owners = append(owners, node)
+		}
+	}
+	return owners
+}
+
+// Nodes returns the nodes on the ring in sorted order
+func (r *HashRing) Nodes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	nodes := make([]string, 0, len(r.nodes))
+	for node := range r.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
@@ -0,0 +1,61 @@
+package caching
+
+import "sync/atomic"
+
+// WithMaxEntries bounds the number of locally stored entries, evicting the least recently
+// used entry once the bound is exceeded. Zero leaves the cache unbounded.
+func WithMaxEntries(maxEntries int) CacheOption {
+	return func(cache *DistributedCache) {
+		cache.maxEntries = maxEntries
+	}
+}
+
+// storeLocked saves an entry, clearing any older deletion of the key, marks it most recently
+// used, and evicts least recently used entries while the cache is over its bound; cache.mu
+// must be held for writing
+func (cache *DistributedCache) storeLocked(key string, entry cacheEntry) {
+	cache.data[key] = entry
+	delete(cache.tombstones, key)
+	if cache.maxEntries <= 0 {
+		return
+	}
+
+	if element, ok := cache.lruElements[key]; ok {
+		cache.recency.MoveToFront(element)
+	} else {
+		cache.lruElements[key] = cache.recency.PushFront(key)
+	}
+
+	for len(cache.data) > cache.maxEntries {
+		oldest := cache.recency.Back()
+		if oldest == nil {
+			return
+		}
+		cache.removeLocked(oldest.Value.(string))
+		atomic.AddUint64(&cache.stats.evictions, 1)
+	}
+}
+
+// removeLocked deletes an entry and its recency record; cache.mu must be held for writing
+func (cache *DistributedCache) removeLocked(key string) {
+	delete(cache.data, key)
+	if element, ok := cache.lruElements[key]; ok {
+		cache.recency.Remove(element)
+		delete(cache.lruElements, key)
+	}
+}
+
+// touch marks keys as most recently used
+func (cache *DistributedCache) touch(keys ...string) {
+	if cache.maxEntries <= 0 || len(keys) == 0 {
+		return
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	for _, key := range keys {
+		if element, ok := cache.lruElements[key]; ok {
+			cache.recency.MoveToFront(element)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package caching
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+// membershipRequest is the JSON body of POST and DELETE /nodes requests
+type membershipRequest struct {
+	Address string `json:"address"`
+}
+
+// membershipResponse is the JSON body answering GET /nodes
+type membershipResponse struct {
+	Nodes []string `json:"nodes"`
+}
+
+// AddNode adds a node to the cluster at runtime and rebalances keys onto it. Operations
+// already in flight keep using the owners they resolved before the change.
+func (cache *DistributedCache) AddNode(address string) {
+	cache.mu.Lock()
+	if _, exists := cache.nodeByAddress(address); exists {
+		cache.mu.Unlock()
+		return
+	}
+	cache.nodes = append(cache.nodes, Node{Address: address})
+	cache.ring.Add(address)
+	cache.mu.Unlock()
+
+	log.Printf("Node %s joined the cache cluster\n", address)
+	go cache.Rebalance()
+}
+
+// RemoveNode removes a node from the cluster at runtime and rebalances the keys it owned
+// onto the remaining nodes. The last node cannot be removed.
+func (cache *DistributedCache) RemoveNode(address string) {
+	cache.mu.Lock()
+	index := -1
+	for i, node := range cache.nodes {
+		if node.Address == address {
+			index = i
+			break
+		}
+	}
+	if index < 0 || len(cache.nodes) == 1 {
+		cache.mu.Unlock()
+		return
+	}
+
+	leaderAddress := cache.nodes[cache.leader%len(cache.nodes)].Address
+	cache.nodes = append(cache.nodes[:index:index], cache.nodes[index+1:]...)
+	cache.ring.Remove(address)
+
+	// Keep pointing at the same leader, or hand over to the first node if it left
+	cache.leader = 0
+	for i, node := range cache.nodes {
+		if node.Address == leaderAddress {
+			cache.leader = i
+		}
+	}
+	cache.mu.Unlock()
+
+	log.Printf("Node %s left the cache cluster\n", address)
+	go cache.Rebalance()
+}
+
+// Members returns the addresses of the nodes currently in the cluster
+func (cache *DistributedCache) Members() []string {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	members := make([]string, len(cache.nodes))
+	for i, node := range cache.nodes {
+		members[i] = node.Address
+	}
+	return members
+}
+
+// Join discovers the cluster through a seed node: it adopts the seed's membership and
+// announces this node, which the seed propagates to the other members
+func (cache *DistributedCache) Join(seed string) error {
+	cache.mu.RLock()
+	timeout := cache.replicaTimeout
+	self := cache.self
+	cache.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, seed+"/nodes", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := cache.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach seed %s: %w", seed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from seed %s", resp.StatusCode, seed)
+	}
+
+	var members membershipResponse
+	if err := json.NewDecoder(resp.Body).Decode(&members); err != nil {
+		return fmt.Errorf("invalid membership from seed %s: %w", seed, err)
+	}
+	for _, address := range members.Nodes {
+		cache.AddNode(address)
+	}
+	cache.AddNode(seed)
+
+	return cache.sendMembership(ctx, Node{Address: seed}, http.MethodPost, self, false)
+}
+
+// sendMembership sends a membership change to a node. Replica changes are applied by the
+// receiving node without being propagated any further.
+func (cache *DistributedCache) sendMembership(ctx context.Context, node Node, method, address string, replica bool) error {
+	payload, err := json.Marshal(membershipRequest{Address: address})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, node.Address+"/nodes", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if replica {
+		req.Header.Set(replicaHeader, "1")
+	}
+
+	resp, err := cache.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// announceMembership forwards a membership change to every other node
+func (cache *DistributedCache) announceMembership(method, address string) {
+	cache.mu.RLock()
+	nodes := make([]Node, 0, len(cache.nodes))
+	for _, node := range cache.nodes {
+		if node.Address != cache.self && node.Address != address {
+			nodes = append(nodes, node)
+		}
+	}
+	timeout := cache.replicaTimeout
+	cache.mu.RUnlock()
+
+	for _, node := range nodes {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := cache.sendMembership(ctx, node, method, address, true)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to announce membership change of %s to node %s: %v\n", address, node.Address, err)
+		}
+	}
+}
+
+// serveNodes handles /nodes: GET lists the members, POST adds a node, and DELETE removes
+// one. Changes received from clients are propagated to the other members.
+func (cache *DistributedCache) serveNodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(membershipResponse{Nodes: cache.Members()})
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req membershipRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil || req.Address == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if r.Method == http.MethodPost {
+		cache.AddNode(req.Address)
+	} else {
+		cache.RemoveNode(req.Address)
+	}
+	if r.Header.Get(replicaHeader) == "" {
+		go cache.announceMembership(r.Method, req.Address)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("OK"))
+}
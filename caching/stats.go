@@ -0,0 +1,55 @@
+package caching
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// cacheStats holds the operation counters of a DistributedCache, updated atomically
+type cacheStats struct {
+	hits        uint64
+	misses      uint64
+	sets        uint64
+	deletes     uint64
+	expirations uint64
+	evictions   uint64
+}
+
+// CacheStats is a point-in-time snapshot of a DistributedCache's counters
+type CacheStats struct {
+	Hits        uint64  `json:"hits"`
+	Misses      uint64  `json:"misses"`
+	Sets        uint64  `json:"sets"`
+	Deletes     uint64  `json:"deletes"`
+	Expirations uint64  `json:"expirations"` // entries removed because their TTL passed
+	Evictions   uint64  `json:"evictions"`   // entries removed to stay within the entry bound
+	HitRatio    float64 `json:"hit_ratio"`
+	Entries     int     `json:"entries"`
+}
+
+// Stats returns a snapshot of the cache counters
+func (cache *DistributedCache) Stats() CacheStats {
+	stats := CacheStats{
+		Hits:        atomic.LoadUint64(&cache.stats.hits),
+		Misses:      atomic.LoadUint64(&cache.stats.misses),
+		Sets:        atomic.LoadUint64(&cache.stats.sets),
+		Deletes:     atomic.LoadUint64(&cache.stats.deletes),
+		Expirations: atomic.LoadUint64(&cache.stats.expirations),
+		Evictions:   atomic.LoadUint64(&cache.stats.evictions),
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(lookups)
+	}
+
+	cache.mu.RLock()
+	stats.Entries = len(cache.data)
+	cache.mu.RUnlock()
+	return stats
+}
+
+// serveStats handles GET /stats
+func (cache *DistributedCache) serveStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cache.Stats())
+}
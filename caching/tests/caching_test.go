@@ -0,0 +1,233 @@
+package caching_tests
+
+import (
+	"caching"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestNode starts a cache node behind an HTTP test server
+func newTestNode(t *testing.T) (*caching.DistributedCache, *httptest.Server) {
+	t.Helper()
+	var cache *caching.DistributedCache
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cache.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	cache = caching.NewDistributedCache([]caching.Node{{Address: server.URL}}, caching.WithSelfAddress(server.URL))
+	return cache, server
+}
+
+// Test case for fetching a value containing whitespace from another node verbatim
+func TestFetchFromNodePreservesSpaces(t *testing.T) {
+	remote, remoteServer := newTestNode(t)
+	const value = "hello distributed  world\twith tabs"
+	if err := remote.Set("greeting", value); err != nil {
+		t.Fatalf("Failed to set value on remote node: %v", err)
+	}
+
+	local := caching.NewDistributedCache(
+		[]caching.Node{{Address: "local"}, {Address: remoteServer.URL}},
+		caching.WithSelfAddress("local"),
+	)
+
+	got, err := local.Get("greeting")
+	if err != nil {
+		t.Fatalf("Failed to fetch value from remote node: %v", err)
+	}
+	if got != value {
+		t.Errorf("Expected %q, got %q", value, got)
+	}
+}
+
+// Test case for treating a missing key on another node as a clean miss
+func TestFetchFromNodeMiss(t *testing.T) {
+	_, remoteServer := newTestNode(t)
+
+	local := caching.NewDistributedCache(
+		[]caching.Node{{Address: "local"}, {Address: remoteServer.URL}},
+		caching.WithSelfAddress("local"),
+	)
+
+	if _, err := local.Get("missing"); err != caching.ErrKeyNotFound {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+// Test case for only remapping the keys of a node removed from the hash ring
+func TestHashRingRemoveNode(t *testing.T) {
+	ring := caching.NewHashRing(50)
+	for _, node := range []string{"node-a", "node-b", "node-c"} {
+		ring.Add(node)
+	}
+
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		owners := ring.Get(key, 2)
+		if len(owners) != 2 || owners[0] == owners[1] {
+			t.Fatalf("Expected 2 distinct owners for %s, got %v", key, owners)
+		}
+		before[key] = owners[0]
+	}
+
+	ring.Remove("node-b")
+	for key, primary := range before {
+		after := ring.Get(key, 1)[0]
+		if after == "node-b" {
+			t.Fatalf("Key %s still maps to removed node", key)
+		}
+		if primary != "node-b" && after != primary {
+			t.Errorf("Key %s moved from %s to %s although its node stayed", key, primary, after)
+		}
+	}
+}
+
+// Test case for replicating values with special characters to a peer over POST
+func TestReplicateSetSpecialCharacters(t *testing.T) {
+	var peer *caching.DistributedCache
+	peerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer.ServeHTTP(w, r)
+	}))
+	defer peerServer.Close()
+
+	nodes := []caching.Node{{Address: "local"}, {Address: peerServer.URL}}
+	peer = caching.NewDistributedCache(nodes, caching.WithSelfAddress(peerServer.URL))
+	local := caching.NewDistributedCache(nodes, caching.WithSelfAddress("local"), caching.WithWriteQuorum(2))
+
+	const key = "user/42?x=1&y=2"
+	const value = "a=b&c=d %20 #frag"
+	if err := local.Set(key, value); err != nil {
+		t.Fatalf("Expected quorum write to succeed, got %v", err)
+	}
+
+	got, err := peer.Get(key)
+	if err != nil {
+		t.Fatalf("Expected replicated key on peer, got %v", err)
+	}
+	if got != value {
+		t.Errorf("Expected %q, got %q", value, got)
+	}
+}
+
+// Test case for batch writes replicating to a peer and batch reads reporting missing keys
+func TestMSetMGet(t *testing.T) {
+	var peer *caching.DistributedCache
+	peerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer.ServeHTTP(w, r)
+	}))
+	defer peerServer.Close()
+
+	nodes := []caching.Node{{Address: "local"}, {Address: peerServer.URL}}
+	peer = caching.NewDistributedCache(nodes, caching.WithSelfAddress(peerServer.URL))
+	local := caching.NewDistributedCache(nodes, caching.WithSelfAddress("local"), caching.WithWriteQuorum(2))
+
+	pairs := map[string]string{"a": "1", "b": "two words", "c": "3"}
+	if err := local.MSet(pairs); err != nil {
+		t.Fatalf("Expected batch write to succeed, got %v", err)
+	}
+
+	values, err := peer.MGet([]string{"a", "b", "c", "missing"})
+	mgetErr, ok := err.(*caching.MGetError)
+	if !ok {
+		t.Fatalf("Expected *MGetError for the missing key, got %v", err)
+	}
+	if len(mgetErr.Errors) != 1 || mgetErr.Errors["missing"] == nil {
+		t.Errorf("Expected only the missing key to fail, got %v", mgetErr.Errors)
+	}
+	for key, want := range pairs {
+		if values[key] != want {
+			t.Errorf("Expected %s=%q, got %q", key, want, values[key])
+		}
+	}
+}
+
+// Test case for evicting the least recently used entry once the entry bound is exceeded
+func TestLRUEviction(t *testing.T) {
+	cache := caching.NewDistributedCache(
+		[]caching.Node{{Address: "local"}},
+		caching.WithSelfAddress("local"),
+		caching.WithMaxEntries(2),
+	)
+
+	cache.Set("a", "1")
+	cache.Set("b", "2")
+	if _, err := cache.Get("a"); err != nil {
+		t.Fatalf("Expected a to be cached, got %v", err)
+	}
+	cache.Set("c", "3")
+
+	if _, err := cache.Get("b"); err != caching.ErrKeyNotFound {
+		t.Errorf("Expected least recently used key b to be evicted, got %v", err)
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, err := cache.Get(key); err != nil {
+			t.Errorf("Expected %s to remain cached, got %v", key, err)
+		}
+	}
+	if stats := cache.Stats(); stats.Evictions != 1 || stats.Entries != 2 {
+		t.Errorf("Expected 1 eviction and 2 entries, got %+v", stats)
+	}
+}
+
+// Test case for joining a cluster through a seed node and leaving it again
+func TestMembershipJoinAndRemove(t *testing.T) {
+	seed, seedServer := newTestNode(t)
+	joiner, joinerServer := newTestNode(t)
+
+	if err := joiner.Join(seedServer.URL); err != nil {
+		t.Fatalf("Failed to join through seed: %v", err)
+	}
+	if members := seed.Members(); len(members) != 2 {
+		t.Fatalf("Expected seed to know 2 members after the join, got %v", members)
+	}
+	if members := joiner.Members(); len(members) != 2 {
+		t.Fatalf("Expected joiner to know 2 members after the join, got %v", members)
+	}
+
+	seed.RemoveNode(joinerServer.URL)
+	if members := seed.Members(); len(members) != 1 || members[0] != seedServer.URL {
+		t.Errorf("Expected only the seed to remain, got %v", members)
+	}
+	seed.RemoveNode(seedServer.URL)
+	if members := seed.Members(); len(members) != 1 {
+		t.Errorf("Expected the last node to be kept, got %v", members)
+	}
+}
+
+// Test case for not reading back a deleted key from an owner that missed the deletion
+func TestDeleteNotResurrectedByReadRepair(t *testing.T) {
+	deleted, deletedServer := newTestNode(t)
+	stale, staleServer := newTestNode(t)
+
+	if err := stale.Set("key", "old"); err != nil {
+		t.Fatalf("Failed to set value on stale node: %v", err)
+	}
+	if err := deleted.Set("key", "new"); err != nil {
+		t.Fatalf("Failed to set value on deleting node: %v", err)
+	}
+	deleted.Delete("key")
+
+	local := caching.NewDistributedCache(
+		[]caching.Node{{Address: "local"}, {Address: deletedServer.URL}, {Address: staleServer.URL}},
+		caching.WithSelfAddress("local"),
+	)
+	if value, err := local.Get("key"); err != caching.ErrKeyNotFound {
+		t.Fatalf("Expected the deletion to win, got %q, %v", value, err)
+	}
+
+	// The deletion is repaired onto the stale owner in the background
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := stale.Get("key"); err == caching.ErrKeyNotFound {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the stale owner to drop the deleted key")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
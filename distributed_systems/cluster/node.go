@@ -0,0 +1,17 @@
+package cluster
+
+// Node is a member of the database cluster. It is shared by the components that
+// address other nodes, such as the distributed cache and the query processor.
+type Node struct {
+	ID       string
+	Address  string
+	Metadata map[string]string // free-form labels such as zone or role
+}
+
+// String returns the node's ID, or its address if it has no ID
+func (n Node) String() string {
+	if n.ID != "" {
+		return n.ID
+	}
+	return n.Address
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	dqp "distributed_systems"
+	"distributed_systems/grpcnode"
+	"log"
+	"rpc"
+	"time"
+)
+
+func main() {
+	nodes := []*dqp.Node{
+		{ID: "1", Address: "192.168.1.1:50051"},
+		{ID: "2", Address: "192.168.1.2:50051"},
+		{ID: "3", Address: "192.168.1.3:50051"},
+	}
+
+	config := rpc.DefaultClientConfig()
+	config.TLS = rpc.ClientTLSOptions{
+		CACertFile: "certs/ca.crt",
+		CertFile:   "certs/client.crt",
+		KeyFile:    "certs/client.key",
+	}
+	qp := dqp.NewQueryProcessor(nodes, grpcnode.NewGRPCNodeClient(config))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queryChan, resultChan := qp.StartQueryProcessor(ctx)
+
+	go func() {
+		queries := []*dqp.Query{
+			{ID: "q1", Statement: "SELECT * FROM users"},
+			{ID: "q2", Statement: "SELECT * FROM orders"},
+		}
+		for _, query := range queries {
+			queryChan <- query
+		}
+	}()
+
+	go func() {
+		for result := range resultChan {
+			log.Printf("Received result for query %s: %v", result.QueryID, result.Data)
+		}
+	}()
+
+	// Simulate running for a while.
+	time.Sleep(5 * time.Second)
+	qp.Shutdown(ctx)
+}
@@ -1,6 +1,7 @@
 package consensus
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -8,154 +9,377 @@ import (
 	"time"
 )
 
+// ErrAcceptorUnavailable is returned when a request can't reach an acceptor
+var ErrAcceptorUnavailable = errors.New("acceptor unavailable")
+
+// ErrProposalPreempted is returned when an acceptor has promised a higher proposal
+var ErrProposalPreempted = errors.New("proposal preempted")
+
 type ProposalID struct {
 	Number int
 	NodeID int
 }
 
+// Compare orders proposals by Number, breaking ties by NodeID so that proposals from
+// different proposers never compare equal. It returns -1, 0, or +1.
+func (id ProposalID) Compare(other ProposalID) int {
+	switch {
+	case id.Number < other.Number:
+		return -1
+	case id.Number > other.Number:
+		return 1
+	case id.NodeID < other.NodeID:
+		return -1
+	case id.NodeID > other.NodeID:
+		return 1
+	}
+	return 0
+}
+
+// Less reports whether id orders before other
+func (id ProposalID) Less(other ProposalID) bool {
+	return id.Compare(other) < 0
+}
+
 type Proposer struct {
 	ID        int
 	ProposeID ProposalID
 	Value     interface{}
 	Acceptors []*Acceptor
+	Learners  []*Learner
 	Majority  int
 	PromiseID ProposalID
 	accepted  bool
 	mu        sync.Mutex
 }
 
-type Acceptor struct {
-	ID          int
+// AcceptorState is what an acceptor has promised and accepted for one log slot
+type AcceptorState struct {
 	PromisedID  ProposalID
 	AcceptedID  ProposalID
 	AcceptedVal interface{}
-	mu          sync.Mutex
+}
+
+type Acceptor struct {
+	ID    int
+	slots map[int]*AcceptorState
+	down  bool          // simulated failure: requests to the acceptor go unanswered
+	delay time.Duration // simulated latency before the acceptor answers
+	mu    sync.Mutex
 }
 
 type Learner struct {
 	ID           int
 	AcceptedVals map[ProposalID]interface{}
+	Chosen       map[int]interface{} // chosen value by log slot
 	mu           sync.Mutex
 }
 
+// PaxosSystem runs an independent Paxos instance per log slot, so the values decided
+// in each slot form a replicated log
 type PaxosSystem struct {
 	Proposers []*Proposer
 	Acceptors []*Acceptor
 	Learners  []*Learner
+
+	mu      sync.Mutex
+	decided map[int]interface{}
 }
 
 func NewPaxosSystem(numProposers, numAcceptors, numLearners int) *PaxosSystem {
-	p := &PaxosSystem{}
-	for i := 0; i < numProposers; i++ {
-		p.Proposers = append(p.Proposers, &Proposer{ID: i, Majority: (numAcceptors/2 + 1)})
-	}
+	p := &PaxosSystem{decided: make(map[int]interface{})}
 	for i := 0; i < numAcceptors; i++ {
-		p.Acceptors = append(p.Acceptors, &Acceptor{ID: i})
+		p.Acceptors = append(p.Acceptors, &Acceptor{ID: i, slots: make(map[int]*AcceptorState)})
 	}
 	for i := 0; i < numLearners; i++ {
-		p.Learners = append(p.Learners, &Learner{ID: i, AcceptedVals: make(map[ProposalID]interface{})})
+		p.Learners = append(p.Learners, &Learner{
+			ID:           i,
+			AcceptedVals: make(map[ProposalID]interface{}),
+			Chosen:       make(map[int]interface{}),
+		})
+	}
+	for i := 0; i < numProposers; i++ {
+		p.Proposers = append(p.Proposers, &Proposer{
+			ID:        i,
+			ProposeID: ProposalID{NodeID: i},
+			Acceptors: p.Acceptors,
+			Learners:  p.Learners,
+			Majority:  (numAcceptors/2 + 1),
+		})
 	}
 	return p
 }
 
-func (p *Proposer) Propose(value interface{}) error {
+// Promise is an acceptor's answer to a prepare request. A granted promise carries the
+// proposal the acceptor accepted last, if any; a refusal carries the higher proposal
+// it has promised instead.
+type Promise struct {
+	OK          bool
+	PromisedID  ProposalID
+	AcceptedID  ProposalID
+	AcceptedVal interface{}
+}
+
+// Propose runs one Paxos round for a log slot and returns the value chosen for it. The
+// round is aborted with the context's error if ctx is done before it completes, and with
+// ErrProposalPreempted if an acceptor has promised a higher proposal; the next round then
+// starts above the highest one refused.
+func (p *Proposer) Propose(ctx context.Context, slot int, value interface{}) (interface{}, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	p.ProposeID.Number++
 	p.Value = value
-	fmt.Printf("Proposer %d: Proposing value %v with ID %d\n", p.ID, value, p.ProposeID.Number)
+	fmt.Printf("Proposer %d: Proposing value %v for slot %d with ID %d\n", p.ID, value, slot, p.ProposeID.Number)
 
 	promises := 0
+	var highest, refused ProposalID
+	adopted, preempted := false, false
 	for _, a := range p.Acceptors {
-		if p.SendPrepare(a) {
-			promises++
+		promise, err := p.SendPrepare(ctx, a, slot)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("prepare phase aborted: %w", ctx.Err())
+		}
+		if err != nil {
+			continue
+		}
+		if !promise.OK {
+			preempted = true
+			if refused.Less(promise.PromisedID) {
+				refused = promise.PromisedID
+			}
+			continue
+		}
+		promises++
+		// A value may already have been chosen, so adopt the highest accepted one
+		if highest.Less(promise.AcceptedID) {
+			highest = promise.AcceptedID
+			p.Value = promise.AcceptedVal
+			adopted = true
 		}
 	}
 
+	if preempted {
+		// The promises were made to this proposal number, so it can't change mid-round
+		if refused.Number > p.ProposeID.Number {
+			p.ProposeID.Number = refused.Number
+		}
+		return nil, fmt.Errorf("%w: acceptor promised proposal %d", ErrProposalPreempted, refused.Number)
+	}
 	if promises < p.Majority {
-		return errors.New("failed to get majority for prepare phase")
+		return nil, errors.New("failed to get majority for prepare phase")
+	}
+	if adopted {
+		fmt.Printf("Proposer %d: Adopting previously accepted value %v for slot %d\n", p.ID, p.Value, slot)
 	}
 
 	accepted := 0
 	for _, a := range p.Acceptors {
-		if p.SendAccept(a) {
+		ok, err := p.SendAccept(ctx, a, slot)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("accept phase aborted: %w", ctx.Err())
+		}
+		if err == nil && ok {
 			accepted++
 		}
 	}
 
 	if accepted < p.Majority {
-		return errors.New("failed to get majority for accept phase")
+		return nil, errors.New("failed to get majority for accept phase")
 	}
 
-	p.NotifyLearners()
-	return nil
+	p.NotifyLearners(slot)
+	return p.Value, nil
 }
 
-func (p *Proposer) SendPrepare(a *Acceptor) bool {
-	a.mu.Lock()
-	defer a.mu.Unlock()
+func (p *Proposer) SendPrepare(ctx context.Context, a *Acceptor, slot int) (Promise, error) {
+	if err := a.reach(ctx); err != nil {
+		fmt.Printf("Proposer %d: Prepare to acceptor %d failed: %v\n", p.ID, a.ID, err)
+		return Promise{}, err
+	}
+	promise := a.ReceivePrepare(slot, p.ProposeID)
+	if promise.OK {
+		fmt.Printf("Proposer %d: Acceptor %d promises for proposal %d in slot %d\n", p.ID, a.ID, p.ProposeID.Number, slot)
+	}
+	return promise, nil
+}
 
-	if a.PromisedID.Number >= p.ProposeID.Number {
-		return false
+func (p *Proposer) SendAccept(ctx context.Context, a *Acceptor, slot int) (bool, error) {
+	if err := a.reach(ctx); err != nil {
+		fmt.Printf("Proposer %d: Accept to acceptor %d failed: %v\n", p.ID, a.ID, err)
+		return false, err
+	}
+	if !a.ReceiveAccept(slot, p.ProposeID, p.Value) {
+		return false, nil
 	}
+	fmt.Printf("Proposer %d: Acceptor %d accepts proposal %d in slot %d\n", p.ID, a.ID, p.ProposeID.Number, slot)
+	return true, nil
+}
 
-	a.PromisedID = p.ProposeID
-	fmt.Printf("Proposer %d: Acceptor %d promises for proposal %d\n", p.ID, a.ID, p.ProposeID.Number)
-	return true
+// NotifyLearners tells every learner the value a majority of acceptors accepted
+func (p *Proposer) NotifyLearners(slot int) {
+	for _, l := range p.Learners {
+		fmt.Printf("Proposer %d: Notify Learner %d about accepted value %v in slot %d\n", p.ID, l.ID, p.Value, slot)
+		l.Learn(slot, p.ProposeID, p.Value)
+	}
 }
 
-func (p *Proposer) SendAccept(a *Acceptor) bool {
+// reach simulates delivering a request to the acceptor, failing if it is down and
+// waiting out its latency unless ctx is done first
+func (a *Acceptor) reach(ctx context.Context) error {
 	a.mu.Lock()
-	defer a.mu.Unlock()
+	down, delay := a.down, a.delay
+	a.mu.Unlock()
 
-	if a.PromisedID.Number > p.ProposeID.Number {
-		return false
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-
-	a.AcceptedID = p.ProposeID
-	a.AcceptedVal = p.Value
-	fmt.Printf("Proposer %d: Acceptor %d accepts proposal %d\n", p.ID, a.ID, p.ProposeID.Number)
-	return true
+	if down {
+		return ErrAcceptorUnavailable
+	}
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
 }
 
-func (p *Proposer) NotifyLearners() {
-	for range p.Acceptors {
-		fmt.Printf("Proposer %d: Notify Learners about accepted value %v\n", p.ID, p.Value)
+// stateLocked returns the acceptor's state for a slot, creating it on first use;
+// a.mu must be held
+func (a *Acceptor) stateLocked(slot int) *AcceptorState {
+	state, ok := a.slots[slot]
+	if !ok {
+		state = &AcceptorState{}
+		a.slots[slot] = state
 	}
+	return state
 }
 
-func (a *Acceptor) ReceivePrepare(proposalID ProposalID) bool {
+// State returns a copy of the acceptor's state for a slot
+func (a *Acceptor) State(slot int) AcceptorState {
 	a.mu.Lock()
 	defer a.mu.Unlock()
+	return *a.stateLocked(slot)
+}
 
-	if a.PromisedID.Number > proposalID.Number {
-		return false
+func (a *Acceptor) ReceivePrepare(slot int, proposalID ProposalID) Promise {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	state := a.stateLocked(slot)
+	if proposalID.Less(state.PromisedID) {
+		return Promise{PromisedID: state.PromisedID}
 	}
 
-	a.PromisedID = proposalID
-	return true
+	state.PromisedID = proposalID
+	return Promise{
+		OK:          true,
+		PromisedID:  proposalID,
+		AcceptedID:  state.AcceptedID,
+		AcceptedVal: state.AcceptedVal,
+	}
 }
 
-func (a *Acceptor) ReceiveAccept(proposalID ProposalID, value interface{}) bool {
+func (a *Acceptor) ReceiveAccept(slot int, proposalID ProposalID, value interface{}) bool {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if a.PromisedID.Number > proposalID.Number {
+	state := a.stateLocked(slot)
+	if proposalID.Less(state.PromisedID) {
 		return false
 	}
 
-	a.AcceptedID = proposalID
-	a.AcceptedVal = value
+	// Accepting also promises the proposal, keeping the promise at least the accepted ID
+	state.PromisedID = proposalID
+	state.AcceptedID = proposalID
+	state.AcceptedVal = value
 	return true
 }
 
-func (l *Learner) Learn(proposalID ProposalID, value interface{}) {
+func (l *Learner) Learn(slot int, proposalID ProposalID, value interface{}) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	l.AcceptedVals[proposalID] = value
-	fmt.Printf("Learner %d learned value %v from proposal %d\n", l.ID, value, proposalID.Number)
+	l.Chosen[slot] = value
+	fmt.Printf("Learner %d learned value %v for slot %d from proposal %d\n", l.ID, value, slot, proposalID.Number)
+}
+
+// SetAcceptorAvailable marks an acceptor as up or down. Proposers treat a down acceptor
+// as one that never responds; its promises and accepted values are kept for when it
+// comes back up.
+func (p *PaxosSystem) SetAcceptorAvailable(id int, up bool) {
+	for _, a := range p.Acceptors {
+		if a.ID == id {
+			a.mu.Lock()
+			a.down = !up
+			a.mu.Unlock()
+		}
+	}
+}
+
+// SetAcceptorDelay makes an acceptor answer requests only after delay, to simulate a
+// slow network
+func (p *PaxosSystem) SetAcceptorDelay(id int, delay time.Duration) {
+	for _, a := range p.Acceptors {
+		if a.ID == id {
+			a.mu.Lock()
+			a.delay = delay
+			a.mu.Unlock()
+		}
+	}
+}
+
+// Decide runs Paxos for a slot until a value is chosen, retrying with each proposer
+// in turn, and records the chosen value in the log. The chosen value can differ from
+// value when the slot was already decided. Retrying stops once ctx is done.
+func (p *PaxosSystem) Decide(ctx context.Context, slot int, value interface{}) (interface{}, error) {
+	if len(p.Proposers) == 0 {
+		return nil, errors.New("no proposers")
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < 3*len(p.Proposers); attempt++ {
+		proposer := p.Proposers[attempt%len(p.Proposers)]
+		chosen, err := proposer.Propose(ctx, slot, value)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("slot %d undecided: %w", slot, ctx.Err())
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		p.mu.Lock()
+		if previous, ok := p.decided[slot]; !ok {
+			p.decided[slot] = chosen
+		} else {
+			chosen = previous
+		}
+		p.mu.Unlock()
+		return chosen, nil
+	}
+	return nil, fmt.Errorf("slot %d undecided: %w", slot, lastErr)
+}
+
+// Log returns the decided values in slot order, up to the first undecided slot
+func (p *PaxosSystem) Log() []interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var entries []interface{}
+	for slot := 0; ; slot++ {
+		value, ok := p.decided[slot]
+		if !ok {
+			return entries
+		}
+		entries = append(entries, value)
+	}
 }
 
 func (p *PaxosSystem) RunElection() {
@@ -163,7 +387,9 @@ func (p *PaxosSystem) RunElection() {
 	for _, proposer := range p.Proposers {
 		go func(proposer *Proposer) {
 			value := rand.Intn(100)
-			err := proposer.Propose(value)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			_, err := proposer.Propose(ctx, 0, value)
 			if err != nil {
 				fmt.Printf("Proposer %d failed to propose value: %v\n", proposer.ID, err)
 			}
@@ -172,17 +398,15 @@ func (p *PaxosSystem) RunElection() {
 }
 
 func (p *PaxosSystem) RunConsensus() {
-	for _, proposer := range p.Proposers {
-		go func(proposer *Proposer) {
+	for slot := range p.Proposers {
+		go func(slot int) {
 			value := rand.Intn(100)
-			if err := proposer.Propose(value); err == nil {
-				for _, learner := range p.Learners {
-					for _, acceptor := range p.Acceptors {
-						learner.Learn(acceptor.AcceptedID, acceptor.AcceptedVal)
-					}
-				}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if _, err := p.Decide(ctx, slot, value); err != nil {
+				fmt.Printf("Failed to reach consensus for slot %d: %v\n", slot, err)
 			}
-		}(proposer)
+		}(slot)
 	}
 }
 
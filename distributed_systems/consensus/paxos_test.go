@@ -0,0 +1,254 @@
+package consensus_test
+
+import (
+	"context"
+	"distributed_systems/consensus"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Test case for notifying every learner of the value chosen by a Paxos round
+func TestPaxosLearnersConverge(t *testing.T) {
+	ps := consensus.NewPaxosSystem(1, 5, 3)
+	proposer := ps.Proposers[0]
+	if _, err := proposer.Propose(context.Background(), 0, 42); err != nil {
+		t.Fatalf("Expected the proposal to be chosen, got %v", err)
+	}
+
+	for _, learner := range ps.Learners {
+		if len(learner.AcceptedVals) != 1 {
+			t.Fatalf("Learner %d: expected one learned value, got %v", learner.ID, learner.AcceptedVals)
+		}
+		if value := learner.AcceptedVals[proposer.ProposeID]; value != 42 {
+			t.Errorf("Learner %d: expected value 42 for proposal %+v, got %v", learner.ID, proposer.ProposeID, value)
+		}
+	}
+	for _, acceptor := range ps.Acceptors {
+		state := acceptor.State(0)
+		if state.AcceptedID != proposer.ProposeID || state.AcceptedVal != 42 {
+			t.Errorf("Acceptor %d: expected to accept 42 under %+v, got %v under %+v",
+				acceptor.ID, proposer.ProposeID, state.AcceptedVal, state.AcceptedID)
+		}
+	}
+}
+
+// Test case for deciding a sequence of slots and reading the agreed log in order
+func TestMultiPaxosLog(t *testing.T) {
+	ps := consensus.NewPaxosSystem(2, 3, 1)
+	for slot, value := range []string{"a", "b", "c"} {
+		chosen, err := ps.Decide(context.Background(), slot, value)
+		if err != nil || chosen != value {
+			t.Fatalf("Expected %q to be chosen for slot %d, got %v, err %v", value, slot, chosen, err)
+		}
+	}
+
+	// Slots decide independently, so a gap stops the readable log
+	if _, err := ps.Decide(context.Background(), 4, "e"); err != nil {
+		t.Fatalf("Failed to decide slot 4: %v", err)
+	}
+	log := ps.Log()
+	if len(log) != 3 || log[0] != "a" || log[1] != "b" || log[2] != "c" {
+		t.Errorf("Expected log [a b c], got %v", log)
+	}
+	if chosen := ps.Learners[0].Chosen[4]; chosen != "e" {
+		t.Errorf("Expected the learner to know slot 4 chose e, got %v", chosen)
+	}
+}
+
+// Test case for ordering two proposals with the same number by node ID
+func TestPaxosEqualProposalNumbers(t *testing.T) {
+	ps := consensus.NewPaxosSystem(2, 3, 1)
+	first, second := ps.Proposers[0], ps.Proposers[1]
+	first.ProposeID.Number, second.ProposeID.Number = 1, 1
+	first.Value, second.Value = "first", "second"
+	ctx := context.Background()
+
+	for _, a := range ps.Acceptors {
+		if promise, err := first.SendPrepare(ctx, a, 0); err != nil || !promise.OK {
+			t.Fatalf("Expected acceptor %d to promise to %+v", a.ID, first.ProposeID)
+		}
+	}
+	for _, a := range ps.Acceptors {
+		if promise, err := second.SendPrepare(ctx, a, 0); err != nil || !promise.OK {
+			t.Fatalf("Expected acceptor %d to promise to the higher-ordered %+v", a.ID, second.ProposeID)
+		}
+	}
+
+	// The first proposer was superseded, so only the second may have its value accepted
+	for _, a := range ps.Acceptors {
+		if ok, _ := first.SendAccept(ctx, a, 0); ok {
+			t.Errorf("Expected acceptor %d to reject %+v after promising %+v", a.ID, first.ProposeID, second.ProposeID)
+		}
+		if ok, err := second.SendAccept(ctx, a, 0); err != nil || !ok {
+			t.Errorf("Expected acceptor %d to accept %+v", a.ID, second.ProposeID)
+		}
+	}
+
+	if !(consensus.ProposalID{Number: 1, NodeID: 0}).Less(consensus.ProposalID{Number: 1, NodeID: 1}) {
+		t.Errorf("Expected node ID to break ties between equal numbers")
+	}
+	if !(consensus.ProposalID{Number: 1, NodeID: 9}).Less(consensus.ProposalID{Number: 2, NodeID: 0}) {
+		t.Errorf("Expected the number to take precedence over node ID")
+	}
+}
+
+// Test case for adopting the highest previously accepted value in the prepare phase
+func TestPaxosAdoptsAcceptedValue(t *testing.T) {
+	ps := consensus.NewPaxosSystem(2, 3, 2)
+	first, second := ps.Proposers[0], ps.Proposers[1]
+
+	if chosen, err := first.Propose(context.Background(), 0, "first"); err != nil || chosen != "first" {
+		t.Fatalf("Expected first to be chosen, got %v, err %v", chosen, err)
+	}
+	chosen, err := second.Propose(context.Background(), 0, "second")
+	if err != nil || chosen != "first" {
+		t.Fatalf("Expected the later proposal to keep the chosen value first, got %v, err %v", chosen, err)
+	}
+	for _, learner := range ps.Learners {
+		if learner.Chosen[0] != "first" {
+			t.Errorf("Learner %d: expected first, got %v", learner.ID, learner.Chosen[0])
+		}
+	}
+
+	// With different values accepted under different proposals, the highest one wins
+	ps.Acceptors[0].ReceiveAccept(1, consensus.ProposalID{Number: 1, NodeID: 0}, "low")
+	ps.Acceptors[1].ReceiveAccept(1, consensus.ProposalID{Number: 1, NodeID: 1}, "high")
+	chosen, err = ps.Decide(context.Background(), 1, "new")
+	if err != nil || chosen != "high" {
+		t.Errorf("Expected the highest accepted value high to be adopted, got %v, err %v", chosen, err)
+	}
+}
+
+// Test case for aborting a round preempted mid-prepare instead of renumbering it, which
+// would let the stale promises it collected choose a second value
+func TestPaxosPreemptedRoundAborts(t *testing.T) {
+	ps := consensus.NewPaxosSystem(3, 5, 1)
+	p1, p2 := ps.Proposers[1], ps.Proposers[2]
+	p1.ProposeID.Number = 4 // its next round proposes (5,1)
+	ctx := context.Background()
+
+	// p2's prepare (1,2) is promised by acceptors 0 and 1, then held up on its way to 2
+	ps.SetAcceptorDelay(2, 500*time.Millisecond)
+	type outcome struct {
+		chosen interface{}
+		err    error
+	}
+	done := make(chan outcome)
+	go func() {
+		chosen, err := p2.Propose(ctx, 0, "Y")
+		done <- outcome{chosen, err}
+	}()
+	deadline := time.Now().Add(time.Second)
+	for ps.Acceptors[1].State(0).PromisedID != (consensus.ProposalID{Number: 1, NodeID: 2}) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected acceptor 1 to promise to p2")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// Meanwhile p1 has X chosen by acceptors 0 to 2
+	ps.SetAcceptorDelay(2, 0)
+	ps.SetAcceptorAvailable(3, false)
+	ps.SetAcceptorAvailable(4, false)
+	if chosen, err := p1.Propose(ctx, 0, "X"); err != nil || chosen != "X" {
+		t.Fatalf("Expected X to be chosen, got %v, err %v", chosen, err)
+	}
+	ps.SetAcceptorAvailable(3, true)
+	ps.SetAcceptorAvailable(4, true)
+
+	// Acceptor 2 refuses p2, whose round must end rather than go on as (5,2)
+	result := <-done
+	if !errors.Is(result.err, consensus.ErrProposalPreempted) {
+		t.Fatalf("Expected the preempted round to fail with ErrProposalPreempted, got %v, err %v", result.chosen, result.err)
+	}
+	for _, a := range ps.Acceptors {
+		if state := a.State(0); state.AcceptedVal == "Y" {
+			t.Errorf("Expected acceptor %d not to accept Y from the preempted round", a.ID)
+		}
+	}
+
+	// The next round starts above the refused proposal and adopts X
+	chosen, err := p2.Propose(ctx, 0, "Y")
+	if err != nil || chosen != "X" {
+		t.Fatalf("Expected the next round to keep X, got %v, err %v", chosen, err)
+	}
+	if want := (consensus.ProposalID{Number: 6, NodeID: 2}); p2.ProposeID != want {
+		t.Errorf("Expected the next round to propose %+v, got %+v", want, p2.ProposeID)
+	}
+	if learned := ps.Learners[0].Chosen[0]; learned != "X" {
+		t.Errorf("Expected the learner to know X was chosen, got %v", learned)
+	}
+}
+
+// Test case for an accept also raising the acceptor's promise to the accepted proposal
+func TestPaxosAcceptRaisesPromise(t *testing.T) {
+	ps := consensus.NewPaxosSystem(1, 1, 1)
+	acceptor := ps.Acceptors[0]
+	accepted := consensus.ProposalID{Number: 5, NodeID: 0}
+
+	if !acceptor.ReceiveAccept(0, accepted, "value") {
+		t.Fatalf("Expected an accept without a prior promise to succeed")
+	}
+	if state := acceptor.State(0); state.PromisedID != accepted {
+		t.Errorf("Expected the promise to be raised to %+v, got %+v", accepted, state.PromisedID)
+	}
+	if promise := acceptor.ReceivePrepare(0, consensus.ProposalID{Number: 3, NodeID: 0}); promise.OK {
+		t.Errorf("Expected a prepare older than the accepted proposal to be rejected")
+	}
+}
+
+// Test case for choosing a value with a minority of acceptors down and failing without a majority
+func TestPaxosAcceptorFailures(t *testing.T) {
+	ps := consensus.NewPaxosSystem(2, 5, 1)
+	ps.SetAcceptorAvailable(0, false)
+	ps.SetAcceptorAvailable(3, false)
+
+	chosen, err := ps.Decide(context.Background(), 0, "minority down")
+	if err != nil || chosen != "minority down" {
+		t.Fatalf("Expected a value to be chosen with 2 of 5 acceptors down, got %v, err %v", chosen, err)
+	}
+
+	ps.SetAcceptorAvailable(4, false)
+	if chosen, err := ps.Decide(context.Background(), 1, "majority down"); err == nil {
+		t.Fatalf("Expected no decision with 3 of 5 acceptors down, got %v", chosen)
+	}
+	if _, ok := ps.Learners[0].Chosen[1]; ok {
+		t.Errorf("Expected slot 1 to remain undecided")
+	}
+
+	// Recovered acceptors let the slot be decided again
+	ps.SetAcceptorAvailable(0, true)
+	if _, err := ps.Decide(context.Background(), 1, "recovered"); err != nil {
+		t.Errorf("Expected a decision once a majority is back, got %v", err)
+	}
+}
+
+// Test case for aborting a Paxos round when slow acceptors outlast the context
+func TestPaxosProposeTimeout(t *testing.T) {
+	ps := consensus.NewPaxosSystem(1, 3, 1)
+	for _, a := range ps.Acceptors {
+		ps.SetAcceptorDelay(a.ID, time.Second)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := ps.Proposers[0].Propose(ctx, 0, "slow")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected a deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the round to abort near the deadline, took %v", elapsed)
+	}
+	if _, ok := ps.Learners[0].Chosen[0]; ok {
+		t.Errorf("Expected no value to be learned from an aborted round")
+	}
+
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	if _, err := ps.Decide(cancelled, 0, "cancelled"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Decide to stop on a cancelled context, got %v", err)
+	}
+}
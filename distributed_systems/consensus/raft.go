@@ -1,6 +1,8 @@
 package consensus
 
 import (
+	"context"
+	"errors"
 	"log"
 	"math/rand"
 	"sync"
@@ -20,123 +22,355 @@ const (
 	HeartbeatTimeout  = 50 * time.Millisecond
 	ElectionTimeout   = 150 * time.Millisecond
 	BroadcastInterval = 100 * time.Millisecond
+	RPCTimeout        = 100 * time.Millisecond
 )
 
+// ErrNodeStopped is returned by the RPC handlers of a node that has been stopped
+var ErrNodeStopped = errors.New("raft node stopped")
+
 type LogEntry struct {
+	Index   int
 	Term    int
+	Type    EntryType
 	Command interface{}
+	Servers []int // the new configuration, for EntryConfig entries
 }
 
 // Raft node structure
 type Raft struct {
 	mu          sync.Mutex
 	id          int
-	peers       []int
+	peers       []int // the other servers in the current configuration
+	member      bool  // whether this node is in the current configuration
 	role        Role
 	term        int
 	votedFor    int
-	log         []LogEntry
+	log         []LogEntry // entries after the snapshot, starting at index snapshotIndex+1
 	commitIdx   int
 	lastApplied int
 	nextIndex   map[int]int
 	matchIndex  map[int]int
 	applyCh     chan ApplyMsg
-	timeoutCh   chan bool
-	heartbeatCh chan bool
+	heartbeatCh chan bool     // signalled when a leader or candidate is heard from
+	stateCh     chan struct{} // signalled when the node becomes or stops being leader
+	applyCond   *sync.Cond    // signalled when commitIdx advances
 	voteCount   int
-	stopCh      chan struct{}
+	stopCh      chan struct{} // closed by Stop
+	stopped     bool
+	transport   Transport
+	persister   Persister
+
+	// The snapshot replaces every log entry up to and including snapshotIndex
+	snapshot        []byte
+	snapshotIndex   int
+	snapshotTerm    int
+	snapshotPending bool // the snapshot still has to be delivered on applyCh
+	snapshotServers []int
+
+	initialServers []int // the configuration before any configuration entry
+	configIndex    int   // index of the latest configuration entry, -1 if none
+
+	// Timers are owned by the run loop; other goroutines signal it over the channels
+	electionTimer  *time.Timer
+	heartbeatTimer *time.Timer
 }
 
+// ApplyMsg carries either a committed command or, when SnapshotValid is set, a
+// snapshot that replaces the state built from every command up to SnapshotIndex
 type ApplyMsg struct {
 	CommandValid bool
 	Command      interface{}
 	CommandIndex int
+
+	SnapshotValid bool
+	Snapshot      []byte
+	SnapshotIndex int
+	SnapshotTerm  int
 }
 
-func NewRaft(id int, peers []int, applyCh chan ApplyMsg) *Raft {
+// RaftOption configures optional Raft behaviour
+type RaftOption func(*Raft)
+
+// WithPersister makes the node save its term, vote, and log through p and recover
+// them from p on startup
+func WithPersister(p Persister) RaftOption {
+	return func(rf *Raft) {
+		rf.persister = p
+	}
+}
+
+// NewRaft creates a Raft node that reaches its peers through the given transport
+func NewRaft(id int, peers []int, applyCh chan ApplyMsg, transport Transport, opts ...RaftOption) *Raft {
 	raft := &Raft{
 		id:          id,
-		peers:       peers,
 		role:        Follower,
 		term:        0,
 		votedFor:    -1,
 		log:         []LogEntry{},
-		commitIdx:   0,
-		lastApplied: 0,
+		commitIdx:   -1, // log indexes start at 0, so -1 means nothing is committed yet
+		lastApplied: -1,
 		nextIndex:   make(map[int]int),
 		matchIndex:  make(map[int]int),
 		applyCh:     applyCh,
-		timeoutCh:   make(chan bool),
-		heartbeatCh: make(chan bool),
+		heartbeatCh: make(chan bool, 1),
+		stateCh:     make(chan struct{}, 1),
 		voteCount:   0,
 		stopCh:      make(chan struct{}),
+		transport:   transport,
+
+		snapshotIndex: -1,
+		snapshotTerm:  -1,
+
+		initialServers: append(append([]int(nil), peers...), id),
+		configIndex:    -1,
+
+		electionTimer:  time.NewTimer(randomElectionTimeout()),
+		heartbeatTimer: time.NewTimer(BroadcastInterval),
+	}
+	for _, opt := range opts {
+		opt(raft)
 	}
+	raft.applyCond = sync.NewCond(&raft.mu)
+	raft.readPersist()
+	raft.refreshConfigLocked()
 	go raft.run()
+	go raft.applier()
 	return raft
 }
 
+// readPersist restores the term, vote, snapshot, and log saved before a restart
+func (rf *Raft) readPersist() {
+	if rf.persister == nil {
+		return
+	}
+	snapshot, err := rf.persister.ReadSnapshot()
+	if err != nil {
+		log.Printf("Failed to read persisted Raft snapshot: %v", err)
+		return
+	}
+	if snapshot != nil {
+		rf.snapshot = snapshot.Data
+		rf.snapshotIndex = snapshot.LastIncludedIdx
+		rf.snapshotTerm = snapshot.LastIncludedTerm
+		rf.snapshotServers = snapshot.Servers
+		rf.snapshotPending = true
+		rf.commitIdx = snapshot.LastIncludedIdx
+	}
+
+	term, votedFor, err := rf.persister.ReadState()
+	if err != nil {
+		log.Printf("Failed to read persisted Raft state: %v", err)
+		return
+	}
+	entries, err := rf.persister.ReadLog()
+	if err != nil {
+		log.Printf("Failed to read persisted Raft log: %v", err)
+		return
+	}
+	rf.term = term
+	rf.votedFor = votedFor
+
+	// A crash between saving a snapshot and the log it truncates leaves covered entries behind
+	for len(entries) > 0 && entries[0].Index <= rf.snapshotIndex {
+		entries = entries[1:]
+	}
+	if entries != nil {
+		rf.log = entries
+	}
+}
+
+// persistStateLocked saves the term and vote; rf.mu must be held
+func (rf *Raft) persistStateLocked() {
+	if rf.persister == nil {
+		return
+	}
+	if err := rf.persister.SaveState(rf.term, rf.votedFor); err != nil {
+		log.Printf("Failed to persist Raft state: %v", err)
+	}
+}
+
+// persistLogLocked saves the log; rf.mu must be held
+func (rf *Raft) persistLogLocked() {
+	if rf.persister == nil {
+		return
+	}
+	if err := rf.persister.SaveLog(rf.log); err != nil {
+		log.Printf("Failed to persist Raft log: %v", err)
+	}
+}
+
 func (rf *Raft) run() {
 	for {
-		switch rf.role {
-		case Follower:
+		rf.mu.Lock()
+		role := rf.role
+		rf.mu.Unlock()
+
+		if role == Leader {
+			rf.broadcastHeartbeat()
+			resetTimer(rf.heartbeatTimer, BroadcastInterval)
 			select {
-			case <-rf.timeoutCh:
-				rf.startElection()
-			case <-rf.heartbeatCh:
-				rf.resetTimeout()
+			case <-rf.heartbeatTimer.C:
+			case <-rf.stateCh:
+				// Stepped down: start a fresh election timeout as a follower
+				resetTimer(rf.electionTimer, randomElectionTimeout())
+			case <-rf.stopCh:
+				return
 			}
-		case Candidate:
+			continue
+		}
+
+		select {
+		case <-rf.electionTimer.C:
 			rf.startElection()
-		case Leader:
-			rf.broadcastHeartbeat()
-			time.Sleep(BroadcastInterval)
+			resetTimer(rf.electionTimer, randomElectionTimeout())
+		case <-rf.heartbeatCh:
+			resetTimer(rf.electionTimer, randomElectionTimeout())
+		case <-rf.stateCh:
+		case <-rf.stopCh:
+			return
 		}
 	}
 }
 
-func (rf *Raft) resetTimeout() {
-	timeout := time.Duration(rand.Intn(150)+150) * time.Millisecond
-	time.AfterFunc(timeout, func() { rf.timeoutCh <- true })
+// applier delivers committed entries to applyCh in log order, each exactly once
+func (rf *Raft) applier() {
+	for {
+		rf.mu.Lock()
+		for !rf.stopped && !rf.snapshotPending && rf.lastApplied >= rf.commitIdx {
+			rf.applyCond.Wait()
+		}
+		if rf.stopped {
+			rf.mu.Unlock()
+			return
+		}
+		if rf.snapshotPending {
+			msg := ApplyMsg{
+				SnapshotValid: true,
+				Snapshot:      rf.snapshot,
+				SnapshotIndex: rf.snapshotIndex,
+				SnapshotTerm:  rf.snapshotTerm,
+			}
+			rf.snapshotPending = false
+			rf.lastApplied = rf.snapshotIndex
+			rf.mu.Unlock()
+
+			if !rf.deliver(msg) {
+				return
+			}
+			continue
+		}
+		first := rf.lastApplied + 1
+		entries := append([]LogEntry(nil), rf.log[rf.logPos(first):rf.logPos(rf.commitIdx)+1]...)
+		rf.lastApplied = rf.commitIdx
+		rf.mu.Unlock()
+
+		// Send without the lock so a slow consumer doesn't stall the node. Configuration
+		// entries are consumed by Raft itself and not delivered.
+		for i, entry := range entries {
+			if entry.Type == EntryConfig {
+				continue
+			}
+			msg := ApplyMsg{
+				CommandValid: true,
+				Command:      entry.Command,
+				CommandIndex: first + i,
+			}
+			if !rf.deliver(msg) {
+				return
+			}
+		}
+	}
+}
+
+// deliver sends msg on applyCh, giving up if the node is stopped first
+func (rf *Raft) deliver(msg ApplyMsg) bool {
+	select {
+	case rf.applyCh <- msg:
+		return true
+	case <-rf.stopCh:
+		return false
+	}
+}
+
+// Stop shuts the node down: the run loop and applier exit, and later calls are
+// no-ops. Stop can be called more than once.
+func (rf *Raft) Stop() {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.stopped {
+		return
+	}
+	rf.stopped = true
+	rf.role = Follower
+	close(rf.stopCh)
+	rf.electionTimer.Stop()
+	rf.heartbeatTimer.Stop()
+	rf.applyCond.Broadcast()
 }
 
+// randomElectionTimeout spreads election timeouts so nodes rarely time out together
+func randomElectionTimeout() time.Duration {
+	return ElectionTimeout + time.Duration(rand.Int63n(int64(ElectionTimeout)))
+}
+
+// resetTimer stops t, discards a pending expiry, and rearms it for d
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
+// startElection becomes a candidate for the next term and requests votes. Votes are
+// counted as the replies arrive; the run loop starts another election if this one
+// hasn't been won before the election timer fires again.
 func (rf *Raft) startElection() {
 	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	// Servers removed from the configuration must not disrupt the cluster
+	if rf.stopped || !rf.member {
+		return
+	}
 	rf.term++
 	rf.votedFor = rf.id
 	rf.voteCount = 1
 	rf.role = Candidate
-	rf.mu.Unlock()
+	rf.persistStateLocked()
 
+	if rf.isMajorityLocked(rf.voteCount) {
+		rf.becomeLeaderLocked()
+		return
+	}
 	for _, peer := range rf.peers {
 		go rf.sendRequestVote(peer)
 	}
+}
 
-	select {
-	case <-rf.heartbeatCh:
-		rf.mu.Lock()
-		rf.role = Follower
-		rf.mu.Unlock()
-	case <-time.After(ElectionTimeout):
-		rf.mu.Lock()
-		if rf.voteCount > len(rf.peers)/2 {
-			rf.role = Leader
-			rf.initializeLeaderState()
-		} else {
-			rf.role = Follower
-		}
-		rf.mu.Unlock()
-	}
+// becomeLeaderLocked takes over as leader for the current term; rf.mu must be held
+func (rf *Raft) becomeLeaderLocked() {
+	rf.role = Leader
+	rf.initializeLeaderState()
+	rf.signalStateChange()
 }
 
 func (rf *Raft) initializeLeaderState() {
 	for _, peer := range rf.peers {
-		rf.nextIndex[peer] = len(rf.log)
-		rf.matchIndex[peer] = 0
+		rf.nextIndex[peer] = rf.lastLogIndex() + 1
+		rf.matchIndex[peer] = -1
 	}
 }
 
 func (rf *Raft) broadcastHeartbeat() {
-	for _, peer := range rf.peers {
+	rf.mu.Lock()
+	peers := append([]int(nil), rf.peers...)
+	rf.mu.Unlock()
+
+	for _, peer := range peers {
 		go rf.sendAppendEntries(peer)
 	}
 }
@@ -146,75 +380,296 @@ func (rf *Raft) sendRequestVote(peer int) {
 	args := RequestVoteArgs{
 		Term:        rf.term,
 		CandidateID: rf.id,
-		LastLogIdx:  len(rf.log) - 1,
+		LastLogIdx:  rf.lastLogIndex(),
 		LastLogTerm: rf.getLastLogTerm(),
 	}
 	rf.mu.Unlock()
 
+	ctx, cancel := context.WithTimeout(context.Background(), RPCTimeout)
+	defer cancel()
+
 	var reply RequestVoteReply
-	if rf.sendRPC(peer, "Raft.RequestVote", args, &reply) {
+	if err := rf.transport.RequestVote(ctx, peer, &args, &reply); err == nil {
 		rf.mu.Lock()
 		defer rf.mu.Unlock()
+		if rf.stopped {
+			return
+		}
+		if reply.Term > rf.term {
+			rf.stepDownLocked(reply.Term)
+			return
+		}
+		// Ignore votes from an election this node is no longer running
+		if rf.role != Candidate || rf.term != args.Term {
+			return
+		}
 		if reply.VoteGranted {
 			rf.voteCount++
-			if rf.voteCount > len(rf.peers)/2 {
-				rf.role = Leader
-				rf.initializeLeaderState()
+			if rf.isMajorityLocked(rf.voteCount) {
+				rf.becomeLeaderLocked()
 			}
-		} else if reply.Term > rf.term {
-			rf.term = reply.Term
-			rf.role = Follower
-			rf.votedFor = -1
 		}
 	}
 }
 
 func (rf *Raft) sendAppendEntries(peer int) {
 	rf.mu.Lock()
+	next := rf.nextIndex[peer]
+	if next <= rf.snapshotIndex {
+		// The entries the follower needs were compacted away
+		rf.mu.Unlock()
+		rf.sendInstallSnapshot(peer)
+		return
+	}
 	args := AppendEntriesArgs{
 		Term:         rf.term,
 		LeaderID:     rf.id,
-		PrevLogIdx:   rf.nextIndex[peer] - 1,
-		PrevLogTerm:  rf.getLogTerm(rf.nextIndex[peer] - 1),
-		Entries:      rf.log[rf.nextIndex[peer]:],
+		PrevLogIdx:   next - 1,
+		PrevLogTerm:  rf.getLogTerm(next - 1),
+		Entries:      append([]LogEntry(nil), rf.log[rf.logPos(next):]...),
 		LeaderCommit: rf.commitIdx,
 	}
 	rf.mu.Unlock()
 
+	ctx, cancel := context.WithTimeout(context.Background(), RPCTimeout)
+	defer cancel()
+
 	var reply AppendEntriesReply
-	if rf.sendRPC(peer, "Raft.AppendEntries", args, &reply) {
+	if err := rf.transport.AppendEntries(ctx, peer, &args, &reply); err == nil {
 		rf.mu.Lock()
 		defer rf.mu.Unlock()
+		if rf.stopped {
+			return
+		}
+		if reply.Term > rf.term {
+			rf.stepDownLocked(reply.Term)
+			return
+		}
+		// Ignore replies to requests sent in an earlier term
+		if rf.role != Leader || rf.term != args.Term {
+			return
+		}
 		if reply.Success {
-			rf.nextIndex[peer] = len(rf.log)
-			rf.matchIndex[peer] = rf.nextIndex[peer] - 1
-		} else if reply.Term > rf.term {
-			rf.term = reply.Term
-			rf.role = Follower
-			rf.votedFor = -1
-		} else {
+			match := args.PrevLogIdx + len(args.Entries)
+			if match > rf.matchIndex[peer] {
+				rf.matchIndex[peer] = match
+			}
+			rf.nextIndex[peer] = rf.matchIndex[peer] + 1
+			rf.advanceCommitLocked()
+		} else if rf.nextIndex[peer] > 0 {
 			rf.nextIndex[peer]--
 		}
 	}
 }
 
-func (rf *Raft) getLastLogTerm() int {
-	if len(rf.log) == 0 {
-		return -1
+// RequestVote handles a candidate's request for this node's vote. The vote is granted
+// at most once per term, and only to candidates whose log is at least as up to date.
+func (rf *Raft) RequestVote(args *RequestVoteArgs, reply *RequestVoteReply) error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.stopped {
+		return ErrNodeStopped
+	}
+	if args.Term > rf.term {
+		rf.stepDownLocked(args.Term)
+	}
+	reply.Term = rf.term
+	reply.VoteGranted = false
+	if args.Term < rf.term {
+		return nil
+	}
+
+	lastTerm := rf.getLastLogTerm()
+	upToDate := args.LastLogTerm > lastTerm ||
+		(args.LastLogTerm == lastTerm && args.LastLogIdx >= rf.lastLogIndex())
+	if (rf.votedFor == -1 || rf.votedFor == args.CandidateID) && upToDate {
+		rf.votedFor = args.CandidateID
+		rf.persistStateLocked()
+		reply.VoteGranted = true
+		rf.signalHeartbeat()
 	}
-	return rf.log[len(rf.log)-1].Term
+	return nil
 }
 
-func (rf *Raft) getLogTerm(index int) int {
-	if index < 0 || index >= len(rf.log) {
-		return -1
+// AppendEntries handles log replication and heartbeats from the leader. Entries are
+// accepted only if the log contains the entry preceding them; conflicting entries are
+// replaced by the leader's, and the commit index follows the leader's.
+func (rf *Raft) AppendEntries(args *AppendEntriesArgs, reply *AppendEntriesReply) error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.stopped {
+		return ErrNodeStopped
+	}
+	reply.Term = rf.term
+	reply.Success = false
+	if args.Term < rf.term {
+		return nil
+	}
+	if args.Term > rf.term || rf.role != Follower {
+		rf.stepDownLocked(args.Term)
+	}
+	reply.Term = rf.term
+	rf.signalHeartbeat()
+
+	prevIdx, prevTerm, entries := args.PrevLogIdx, args.PrevLogTerm, args.Entries
+	if prevIdx < rf.snapshotIndex {
+		// Entries covered by the snapshot are committed, so they match the leader's
+		if prevIdx+len(entries) <= rf.snapshotIndex {
+			reply.Success = true
+			return nil
+		}
+		entries = entries[rf.snapshotIndex-prevIdx:]
+		prevIdx, prevTerm = rf.snapshotIndex, rf.snapshotTerm
+	}
+	if prevIdx > rf.lastLogIndex() || rf.getLogTerm(prevIdx) != prevTerm {
+		return nil
+	}
+
+	for i, entry := range entries {
+		pos := rf.logPos(prevIdx + 1 + i)
+		if pos < len(rf.log) && rf.log[pos].Term == entry.Term {
+			continue
+		}
+		rf.log = append(rf.log[:pos], entries[i:]...)
+		rf.persistLogLocked()
+		rf.refreshConfigLocked()
+		break
+	}
+
+	// Only entries known to match the leader's log can be committed
+	commit := args.LeaderCommit
+	if last := args.PrevLogIdx + len(args.Entries); last < commit {
+		commit = last
+	}
+	if commit > rf.commitIdx {
+		rf.commitIdx = commit
+		rf.applyCond.Signal()
+	}
+	reply.Success = true
+	return nil
+}
+
+// advanceCommitLocked commits the highest entry from the current term that a majority
+// of nodes have stored. Entries from earlier terms are committed along with it, never
+// by counting their replicas alone. rf.mu must be held.
+func (rf *Raft) advanceCommitLocked() {
+	for n := rf.lastLogIndex(); n > rf.commitIdx; n-- {
+		if rf.getLogTerm(n) != rf.term {
+			break
+		}
+		count := 0
+		if rf.member {
+			count = 1
+		}
+		for _, peer := range rf.peers {
+			if rf.matchIndex[peer] >= n {
+				count++
+			}
+		}
+		if rf.isMajorityLocked(count) {
+			rf.commitIdx = n
+			rf.applyCond.Signal()
+			// A leader removed from the configuration hands over once its removal commits
+			if !rf.member && rf.commitIdx >= rf.configIndex {
+				rf.stepDownLocked(rf.term)
+			}
+			return
+		}
 	}
-	return rf.log[index].Term
 }
 
-func (rf *Raft) sendRPC(peer int, method string, args interface{}, reply interface{}) bool {
-	log.Printf("Sending RPC to peer %d, method: %s, args: %+v, reply: %+v", peer, method, args, reply)
-	return true
+// stepDownLocked moves to a newer term as a follower; rf.mu must be held
+func (rf *Raft) stepDownLocked(term int) {
+	if term > rf.term {
+		rf.term = term
+		rf.votedFor = -1
+		rf.persistStateLocked()
+	}
+	if rf.role == Leader {
+		rf.signalStateChange()
+	}
+	rf.role = Follower
+}
+
+// isMajorityLocked reports whether count servers form a majority of the current
+// configuration; rf.mu must be held
+func (rf *Raft) isMajorityLocked(count int) bool {
+	voters := len(rf.peers)
+	if rf.member {
+		voters++
+	}
+	return count > voters/2
+}
+
+// signalStateChange wakes the run loop after a leadership change
+func (rf *Raft) signalStateChange() {
+	select {
+	case rf.stateCh <- struct{}{}:
+	default:
+	}
+}
+
+// signalHeartbeat tells the run loop that the leader or a candidate was heard from
+// without blocking when the loop isn't waiting
+func (rf *Raft) signalHeartbeat() {
+	select {
+	case rf.heartbeatCh <- true:
+	default:
+	}
+}
+
+// Start proposes a command for the replicated log. On the leader the command is
+// appended and replication begins immediately; it reaches applyCh only once committed,
+// which may never happen if leadership is lost first. Other nodes return
+// isLeader=false so the caller can redirect to the leader.
+func (rf *Raft) Start(command interface{}) (index int, term int, isLeader bool) {
+	rf.mu.Lock()
+	if rf.stopped || rf.role != Leader {
+		defer rf.mu.Unlock()
+		return -1, rf.term, false
+	}
+	index, term = rf.lastLogIndex()+1, rf.term
+	rf.log = append(rf.log, LogEntry{Index: index, Term: term, Command: command})
+	rf.persistLogLocked()
+	rf.advanceCommitLocked() // a single-node cluster commits immediately
+	rf.mu.Unlock()
+
+	rf.broadcastHeartbeat()
+	return index, term, true
+}
+
+// GetState returns the current term and whether this node believes it is the leader
+func (rf *Raft) GetState() (int, bool) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.term, rf.role == Leader
+}
+
+// lastLogIndex returns the index of the last entry, counting compacted entries
+func (rf *Raft) lastLogIndex() int {
+	return rf.snapshotIndex + len(rf.log)
+}
+
+// logPos maps a log index to its position in rf.log
+func (rf *Raft) logPos(index int) int {
+	return index - rf.snapshotIndex - 1
+}
+
+func (rf *Raft) getLastLogTerm() int {
+	return rf.getLogTerm(rf.lastLogIndex())
+}
+
+func (rf *Raft) getLogTerm(index int) int {
+	if index == rf.snapshotIndex {
+		return rf.snapshotTerm
+	}
+	pos := rf.logPos(index)
+	if pos < 0 || pos >= len(rf.log) {
+		return -1
+	}
+	return rf.log[pos].Term
 }
 
 type RequestVoteArgs struct {
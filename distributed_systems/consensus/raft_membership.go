@@ -0,0 +1,132 @@
+package consensus
+
+import "errors"
+
+// EntryType distinguishes client commands from configuration changes in the log
+type EntryType int
+
+const (
+	EntryCommand EntryType = iota
+	EntryConfig
+)
+
+var (
+	// ErrNotLeader is returned when a request that only the leader can serve reaches another node
+	ErrNotLeader = errors.New("not the leader")
+	// ErrConfigChangePending is returned while an earlier membership change is uncommitted
+	ErrConfigChangePending = errors.New("membership change already in progress")
+	// ErrAlreadyMember is returned when adding a server that is already in the cluster
+	ErrAlreadyMember = errors.New("server is already a member")
+	// ErrNotMember is returned when removing a server that isn't in the cluster
+	ErrNotMember = errors.New("server is not a member")
+)
+
+// AddServer adds a server to the cluster through a configuration entry in the log. The
+// server must already be reachable through the transport. It is called on the leader.
+func (rf *Raft) AddServer(id int) error {
+	return rf.changeConfig(id, true)
+}
+
+// RemoveServer removes a server from the cluster through a configuration entry in the
+// log. A leader that removes itself steps down once the change is committed.
+func (rf *Raft) RemoveServer(id int) error {
+	return rf.changeConfig(id, false)
+}
+
+// changeConfig appends a configuration adding or removing one server. Changing a
+// single server at a time keeps every majority of the old and new configurations
+// overlapping, so the change takes effect as soon as it is appended.
+func (rf *Raft) changeConfig(id int, add bool) error {
+	rf.mu.Lock()
+	if rf.stopped || rf.role != Leader {
+		rf.mu.Unlock()
+		return ErrNotLeader
+	}
+	if rf.configIndex > rf.commitIdx {
+		rf.mu.Unlock()
+		return ErrConfigChangePending
+	}
+
+	current := rf.serversLocked()
+	servers := make([]int, 0, len(current)+1)
+	found := false
+	for _, server := range current {
+		if server == id {
+			found = true
+			if !add {
+				continue
+			}
+		}
+		servers = append(servers, server)
+	}
+	if add && found {
+		rf.mu.Unlock()
+		return ErrAlreadyMember
+	}
+	if !add && !found {
+		rf.mu.Unlock()
+		return ErrNotMember
+	}
+	if add {
+		servers = append(servers, id)
+	}
+
+	index := rf.lastLogIndex() + 1
+	rf.log = append(rf.log, LogEntry{Index: index, Term: rf.term, Type: EntryConfig, Servers: servers})
+	rf.persistLogLocked()
+	rf.refreshConfigLocked()
+	rf.advanceCommitLocked()
+	rf.mu.Unlock()
+
+	rf.broadcastHeartbeat()
+	return nil
+}
+
+// serversLocked returns every server in the current configuration; rf.mu must be held
+func (rf *Raft) serversLocked() []int {
+	servers := append([]int(nil), rf.peers...)
+	if rf.member {
+		servers = append(servers, rf.id)
+	}
+	return servers
+}
+
+// configAtLocked returns the configuration in effect at a log index; rf.mu must be held
+func (rf *Raft) configAtLocked(index int) []int {
+	for pos := rf.logPos(index); pos >= 0; pos-- {
+		if pos < len(rf.log) && rf.log[pos].Type == EntryConfig {
+			return rf.log[pos].Servers
+		}
+	}
+	if rf.snapshotServers != nil {
+		return rf.snapshotServers
+	}
+	return rf.initialServers
+}
+
+// refreshConfigLocked adopts the latest configuration in the log, committed or not, as
+// Raft requires. It runs after every change to the log. rf.mu must be held.
+func (rf *Raft) refreshConfigLocked() {
+	rf.configIndex = -1
+	for pos := len(rf.log) - 1; pos >= 0; pos-- {
+		if rf.log[pos].Type == EntryConfig {
+			rf.configIndex = rf.log[pos].Index
+			break
+		}
+	}
+	servers := rf.configAtLocked(rf.lastLogIndex())
+
+	rf.peers = nil
+	rf.member = false
+	for _, server := range servers {
+		if server == rf.id {
+			rf.member = true
+			continue
+		}
+		rf.peers = append(rf.peers, server)
+		if _, ok := rf.nextIndex[server]; !ok {
+			rf.nextIndex[server] = rf.lastLogIndex() + 1
+			rf.matchIndex[server] = -1
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package consensus
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Persister stores the Raft state that must survive a crash: the current term, the
+// vote cast in it, the latest snapshot, and the log following it
+type Persister interface {
+	SaveState(term, votedFor int) error
+	ReadState() (term, votedFor int, err error)
+	SaveLog(entries []LogEntry) error
+	ReadLog() ([]LogEntry, error)
+	SaveSnapshot(snapshot RaftSnapshot) error
+	ReadSnapshot() (*RaftSnapshot, error)
+}
+
+// persistedState is the on-disk form of the term and vote
+type persistedState struct {
+	Term     int `json:"term"`
+	VotedFor int `json:"voted_for"`
+}
+
+// FilePersister keeps Raft state as JSON files in a directory. Commands are decoded
+// by encoding/json on recovery, so they come back as generic JSON values.
+type FilePersister struct {
+	Dir string
+}
+
+// NewFilePersister creates a FilePersister, creating its directory if needed
+func NewFilePersister(dir string) (*FilePersister, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	return &FilePersister{Dir: dir}, nil
+}
+
+// SaveState writes the current term and vote
+func (p *FilePersister) SaveState(term, votedFor int) error {
+	return p.write("state.json", persistedState{Term: term, VotedFor: votedFor})
+}
+
+// ReadState reads the current term and vote; a missing file is a fresh node
+func (p *FilePersister) ReadState() (int, int, error) {
+	state := persistedState{VotedFor: -1}
+	if _, err := p.read("state.json", &state); err != nil {
+		return 0, -1, err
+	}
+	return state.Term, state.VotedFor, nil
+}
+
+// SaveLog writes the log entries
+func (p *FilePersister) SaveLog(entries []LogEntry) error {
+	return p.write("log.json", entries)
+}
+
+// ReadLog reads the log entries; a missing file is an empty log
+func (p *FilePersister) ReadLog() ([]LogEntry, error) {
+	var entries []LogEntry
+	if _, err := p.read("log.json", &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// SaveSnapshot writes the snapshot
+func (p *FilePersister) SaveSnapshot(snapshot RaftSnapshot) error {
+	return p.write("snapshot.json", snapshot)
+}
+
+// ReadSnapshot reads the snapshot; it returns nil if none was saved
+func (p *FilePersister) ReadSnapshot() (*RaftSnapshot, error) {
+	var snapshot RaftSnapshot
+	found, err := p.read("snapshot.json", &snapshot)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// write stores v in the named file, syncing a temporary file and renaming it into
+// place so a crash never leaves a truncated file behind
+func (p *FilePersister) write(name string, v interface{}) error {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to serialize %s: %w", name, err)
+	}
+
+	path := filepath.Join(p.Dir, name)
+	tmp, err := os.Create(path + ".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	if _, err := tmp.Write(jsonData); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return nil
+}
+
+// read loads the named file into v, reporting whether the file existed
+func (p *FilePersister) read(name string, v interface{}) (bool, error) {
+	jsonData, err := ioutil.ReadFile(filepath.Join(p.Dir, name))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read file: %w", err)
+	}
+	if err := json.Unmarshal(jsonData, v); err != nil {
+		return false, fmt.Errorf("failed to deserialize %s: %w", name, err)
+	}
+	return true, nil
+}
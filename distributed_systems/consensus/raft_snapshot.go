@@ -0,0 +1,147 @@
+package consensus
+
+import (
+	"context"
+	"log"
+)
+
+// RaftSnapshot is the persisted form of a snapshot together with the last log entry
+// it covers
+type RaftSnapshot struct {
+	LastIncludedIdx  int
+	LastIncludedTerm int
+	Servers          []int // the configuration as of LastIncludedIdx
+	Data             []byte
+}
+
+type InstallSnapshotArgs struct {
+	Term             int
+	LeaderID         int
+	LastIncludedIdx  int
+	LastIncludedTerm int
+	Servers          []int
+	Data             []byte
+}
+
+type InstallSnapshotReply struct {
+	Term int
+}
+
+// Snapshot tells Raft that the service has captured its state in state, covering every
+// command up to and including index. Log entries up to index are discarded. Requests
+// for an index that isn't applied yet or is already compacted are ignored.
+func (rf *Raft) Snapshot(index int, state []byte) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.stopped || index <= rf.snapshotIndex || index > rf.lastApplied {
+		return
+	}
+	term := rf.getLogTerm(index)
+	rf.snapshotServers = rf.configAtLocked(index)
+	rf.log = append([]LogEntry(nil), rf.log[rf.logPos(index)+1:]...)
+	rf.snapshot = state
+	rf.snapshotIndex = index
+	rf.snapshotTerm = term
+	rf.persistSnapshotLocked()
+}
+
+// InstallSnapshot handles a snapshot sent by the leader to a follower that is missing
+// entries the leader has already compacted. The snapshot is handed to the service on
+// applyCh; log entries following it are kept if they agree with the leader.
+func (rf *Raft) InstallSnapshot(args *InstallSnapshotArgs, reply *InstallSnapshotReply) error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.stopped {
+		return ErrNodeStopped
+	}
+	reply.Term = rf.term
+	if args.Term < rf.term {
+		return nil
+	}
+	if args.Term > rf.term || rf.role != Follower {
+		rf.stepDownLocked(args.Term)
+	}
+	reply.Term = rf.term
+	rf.signalHeartbeat()
+
+	// Everything the snapshot covers is already committed here
+	if args.LastIncludedIdx <= rf.commitIdx {
+		return nil
+	}
+
+	if args.LastIncludedIdx <= rf.lastLogIndex() && rf.getLogTerm(args.LastIncludedIdx) == args.LastIncludedTerm {
+		rf.log = append([]LogEntry(nil), rf.log[rf.logPos(args.LastIncludedIdx)+1:]...)
+	} else {
+		rf.log = []LogEntry{}
+	}
+	rf.snapshot = args.Data
+	rf.snapshotIndex = args.LastIncludedIdx
+	rf.snapshotTerm = args.LastIncludedTerm
+	rf.snapshotServers = args.Servers
+	rf.snapshotPending = true
+	rf.commitIdx = args.LastIncludedIdx
+	rf.persistSnapshotLocked()
+	rf.refreshConfigLocked()
+	rf.applyCond.Signal()
+	return nil
+}
+
+// sendInstallSnapshot brings a lagging follower up to the leader's snapshot
+func (rf *Raft) sendInstallSnapshot(peer int) {
+	rf.mu.Lock()
+	args := InstallSnapshotArgs{
+		Term:             rf.term,
+		LeaderID:         rf.id,
+		LastIncludedIdx:  rf.snapshotIndex,
+		LastIncludedTerm: rf.snapshotTerm,
+		Servers:          rf.snapshotServers,
+		Data:             rf.snapshot,
+	}
+	rf.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), RPCTimeout)
+	defer cancel()
+
+	var reply InstallSnapshotReply
+	if err := rf.transport.InstallSnapshot(ctx, peer, &args, &reply); err == nil {
+		rf.mu.Lock()
+		defer rf.mu.Unlock()
+		if rf.stopped {
+			return
+		}
+		if reply.Term > rf.term {
+			rf.stepDownLocked(reply.Term)
+			return
+		}
+		if rf.role != Leader || rf.term != args.Term {
+			return
+		}
+		if args.LastIncludedIdx > rf.matchIndex[peer] {
+			rf.matchIndex[peer] = args.LastIncludedIdx
+		}
+		rf.nextIndex[peer] = rf.matchIndex[peer] + 1
+		rf.advanceCommitLocked()
+	}
+}
+
+// persistSnapshotLocked saves the snapshot and the log that remains after it. The
+// snapshot is written first so a crash in between only leaves covered entries in the
+// log, which readPersist discards. rf.mu must be held.
+func (rf *Raft) persistSnapshotLocked() {
+	if rf.persister == nil {
+		return
+	}
+	snapshot := RaftSnapshot{
+		LastIncludedIdx:  rf.snapshotIndex,
+		LastIncludedTerm: rf.snapshotTerm,
+		Servers:          rf.snapshotServers,
+		Data:             rf.snapshot,
+	}
+	if err := rf.persister.SaveSnapshot(snapshot); err != nil {
+		log.Printf("Failed to persist Raft snapshot: %v", err)
+		return
+	}
+	rf.persistLogLocked()
+}
@@ -0,0 +1,458 @@
+package consensus_test
+
+import (
+	"distributed_systems/consensus"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// newRaftCluster starts n Raft nodes connected through one mock transport, stopping
+// them when the test ends
+func newRaftCluster(t *testing.T, n int) ([]*consensus.Raft, *consensus.MockTransport, []chan consensus.ApplyMsg) {
+	transport := consensus.NewMockTransport()
+	nodes := make([]*consensus.Raft, n)
+	applyChs := make([]chan consensus.ApplyMsg, n)
+	for i := 0; i < n; i++ {
+		var peers []int
+		for j := 0; j < n; j++ {
+			if j != i {
+				peers = append(peers, j)
+			}
+		}
+		applyChs[i] = make(chan consensus.ApplyMsg, 100)
+		nodes[i] = consensus.NewRaft(i, peers, applyChs[i], transport)
+		transport.Register(i, nodes[i])
+		t.Cleanup(nodes[i].Stop)
+	}
+	return nodes, transport, applyChs
+}
+
+// waitForLeader waits until exactly one connected node leads the highest term
+func waitForLeader(t *testing.T, nodes []*consensus.Raft, connected func(int) bool) int {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		leaders := make(map[int][]int)
+		highest := 0
+		for i, node := range nodes {
+			if !connected(i) {
+				continue
+			}
+			term, isLeader := node.GetState()
+			if isLeader {
+				leaders[term] = append(leaders[term], i)
+			}
+			if term > highest {
+				highest = term
+			}
+		}
+		for term, ids := range leaders {
+			if len(ids) > 1 {
+				t.Fatalf("Term %d has %d leaders: %v", term, len(ids), ids)
+			}
+		}
+		if ids := leaders[highest]; len(ids) == 1 {
+			return ids[0]
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("No leader elected")
+	return -1
+}
+
+// Test case for recovering the term, vote, and log after a node crashes and restarts
+func TestRaftCrashRecovery(t *testing.T) {
+	dir := t.TempDir()
+	persister, err := consensus.NewFilePersister(dir)
+	if err != nil {
+		t.Fatalf("Failed to create persister: %v", err)
+	}
+
+	entries := []consensus.LogEntry{{Term: 1, Command: "set x 1"}, {Term: 3, Command: "set y 2"}}
+	if err := persister.SaveState(3, 1); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+	if err := persister.SaveLog(entries); err != nil {
+		t.Fatalf("Failed to save log: %v", err)
+	}
+
+	// Recover through a fresh persister as a restarted process would
+	recovered, err := consensus.NewFilePersister(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen persister: %v", err)
+	}
+	term, votedFor, err := recovered.ReadState()
+	if err != nil || term != 3 || votedFor != 1 {
+		t.Fatalf("Expected term 3 and vote for 1, got term %d, vote %d, err %v", term, votedFor, err)
+	}
+	restored, err := recovered.ReadLog()
+	if err != nil || len(restored) != len(entries) {
+		t.Fatalf("Expected %d log entries, got %v, err %v", len(entries), restored, err)
+	}
+	for i, entry := range restored {
+		if entry.Term != entries[i].Term || entry.Command != entries[i].Command {
+			t.Errorf("Expected entry %d to be %+v, got %+v", i, entries[i], entry)
+		}
+	}
+
+	rf := consensus.NewRaft(0, nil, make(chan consensus.ApplyMsg, 1), consensus.NewMockTransport(), consensus.WithPersister(recovered))
+	defer rf.Stop()
+	if term, _ := rf.GetState(); term != 3 {
+		t.Errorf("Expected restarted node to resume at term 3, got %d", term)
+	}
+}
+
+// Test case for starting a node without any persisted state
+func TestRaftFreshPersister(t *testing.T) {
+	persister, err := consensus.NewFilePersister(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create persister: %v", err)
+	}
+	term, votedFor, err := persister.ReadState()
+	if err != nil || term != 0 || votedFor != -1 {
+		t.Errorf("Expected term 0 and no vote, got term %d, vote %d, err %v", term, votedFor, err)
+	}
+	if entries, err := persister.ReadLog(); err != nil || len(entries) != 0 {
+		t.Errorf("Expected an empty log, got %v, err %v", entries, err)
+	}
+}
+
+// Test case for granting at most one vote per term and only to up-to-date candidates
+func TestRaftRequestVote(t *testing.T) {
+	rf := consensus.NewRaft(0, []int{1, 2}, make(chan consensus.ApplyMsg, 1), consensus.NewMockTransport())
+	defer rf.Stop()
+
+	var reply consensus.RequestVoteReply
+	rf.RequestVote(&consensus.RequestVoteArgs{Term: 1, CandidateID: 1, LastLogIdx: -1, LastLogTerm: -1}, &reply)
+	if !reply.VoteGranted || reply.Term != 1 {
+		t.Fatalf("Expected vote for candidate 1 in term 1, got %+v", reply)
+	}
+
+	reply = consensus.RequestVoteReply{}
+	rf.RequestVote(&consensus.RequestVoteArgs{Term: 1, CandidateID: 2, LastLogIdx: -1, LastLogTerm: -1}, &reply)
+	if reply.VoteGranted {
+		t.Errorf("Expected a second vote in term 1 to be refused")
+	}
+
+	// Give the node a log entry from term 2 so a candidate with an empty log is stale
+	var appendReply consensus.AppendEntriesReply
+	rf.AppendEntries(&consensus.AppendEntriesArgs{
+		Term: 2, LeaderID: 1, PrevLogIdx: -1, PrevLogTerm: -1,
+		Entries: []consensus.LogEntry{{Term: 2, Command: "x"}}, LeaderCommit: -1,
+	}, &appendReply)
+	if !appendReply.Success {
+		t.Fatalf("Expected the entry to be appended, got %+v", appendReply)
+	}
+
+	reply = consensus.RequestVoteReply{}
+	rf.RequestVote(&consensus.RequestVoteArgs{Term: 3, CandidateID: 2, LastLogIdx: -1, LastLogTerm: -1}, &reply)
+	if reply.VoteGranted || reply.Term != 3 {
+		t.Errorf("Expected a candidate with a stale log to be refused in term 3, got %+v", reply)
+	}
+}
+
+// Test case for the AppendEntries term check and log-matching rule
+func TestRaftAppendEntries(t *testing.T) {
+	rf := consensus.NewRaft(0, []int{1, 2}, make(chan consensus.ApplyMsg, 1), consensus.NewMockTransport())
+	defer rf.Stop()
+
+	var reply consensus.AppendEntriesReply
+	rf.AppendEntries(&consensus.AppendEntriesArgs{
+		Term: 2, LeaderID: 1, PrevLogIdx: -1, PrevLogTerm: -1,
+		Entries: []consensus.LogEntry{{Term: 1, Command: "a"}, {Term: 2, Command: "b"}}, LeaderCommit: 0,
+	}, &reply)
+	if !reply.Success {
+		t.Fatalf("Expected entries to be appended, got %+v", reply)
+	}
+
+	reply = consensus.AppendEntriesReply{}
+	rf.AppendEntries(&consensus.AppendEntriesArgs{Term: 1, LeaderID: 2, PrevLogIdx: 1, PrevLogTerm: 2}, &reply)
+	if reply.Success || reply.Term != 2 {
+		t.Errorf("Expected a request from an old term to be rejected, got %+v", reply)
+	}
+
+	reply = consensus.AppendEntriesReply{}
+	rf.AppendEntries(&consensus.AppendEntriesArgs{Term: 2, LeaderID: 1, PrevLogIdx: 1, PrevLogTerm: 1}, &reply)
+	if reply.Success {
+		t.Errorf("Expected a mismatched previous term to be rejected")
+	}
+
+	reply = consensus.AppendEntriesReply{}
+	rf.AppendEntries(&consensus.AppendEntriesArgs{Term: 2, LeaderID: 1, PrevLogIdx: 5, PrevLogTerm: 2}, &reply)
+	if reply.Success {
+		t.Errorf("Expected a missing previous entry to be rejected")
+	}
+
+	// A new leader overwrites the conflicting entry at index 1
+	reply = consensus.AppendEntriesReply{}
+	rf.AppendEntries(&consensus.AppendEntriesArgs{
+		Term: 3, LeaderID: 2, PrevLogIdx: 0, PrevLogTerm: 1,
+		Entries: []consensus.LogEntry{{Term: 3, Command: "c"}}, LeaderCommit: 1,
+	}, &reply)
+	if !reply.Success {
+		t.Fatalf("Expected the conflicting entry to be replaced, got %+v", reply)
+	}
+
+	reply = consensus.AppendEntriesReply{}
+	rf.AppendEntries(&consensus.AppendEntriesArgs{Term: 3, LeaderID: 2, PrevLogIdx: 1, PrevLogTerm: 3}, &reply)
+	if !reply.Success {
+		t.Errorf("Expected the log to match the new leader at index 1, got %+v", reply)
+	}
+}
+
+// Test case for electing a new leader after the current one is partitioned away, meant
+// to be run with the race detector
+func TestRaftLeaderFailover(t *testing.T) {
+	nodes, transport, _ := newRaftCluster(t, 3)
+	all := func(int) bool { return true }
+
+	leader := waitForLeader(t, nodes, all)
+	oldTerm, _ := nodes[leader].GetState()
+
+	transport.SetConnected(leader, false)
+	others := func(i int) bool { return i != leader }
+	newLeader := waitForLeader(t, nodes, others)
+	if newLeader == leader {
+		t.Fatalf("Expected a different leader after partitioning node %d", leader)
+	}
+	if term, _ := nodes[newLeader].GetState(); term <= oldTerm {
+		t.Errorf("Expected the new leader's term to exceed %d, got %d", oldTerm, term)
+	}
+
+	// The old leader rejoins and steps down once it hears from the newer term
+	transport.SetConnected(leader, true)
+	waitForLeader(t, nodes, all)
+	time.Sleep(3 * consensus.BroadcastInterval)
+	if term, isLeader := nodes[leader].GetState(); isLeader && term <= oldTerm {
+		t.Errorf("Expected the old leader to step down, still leading term %d", term)
+	}
+}
+
+// Test case for proposing commands on the leader and redirecting from followers
+func TestRaftStart(t *testing.T) {
+	nodes, _, _ := newRaftCluster(t, 3)
+	leader := waitForLeader(t, nodes, func(int) bool { return true })
+	follower := (leader + 1) % len(nodes)
+
+	if _, _, isLeader := nodes[follower].Start("set x 1"); isLeader {
+		t.Errorf("Expected follower %d to refuse the command", follower)
+	}
+
+	term, _ := nodes[leader].GetState()
+	for want := 0; want < 3; want++ {
+		index, gotTerm, isLeader := nodes[leader].Start(want)
+		if !isLeader {
+			t.Fatalf("Expected leader %d to accept the command", leader)
+		}
+		if index != want || gotTerm != term {
+			t.Errorf("Expected index %d in term %d, got index %d in term %d", want, term, index, gotTerm)
+		}
+	}
+}
+
+// Test case for applying committed commands on every node in order, exactly once
+func TestRaftApplyCommitted(t *testing.T) {
+	nodes, _, applyChs := newRaftCluster(t, 3)
+	leader := waitForLeader(t, nodes, func(int) bool { return true })
+
+	const commands = 5
+	for i := 0; i < commands; i++ {
+		if _, _, isLeader := nodes[leader].Start(i); !isLeader {
+			t.Fatalf("Expected node %d to still be leader", leader)
+		}
+	}
+
+	for node, applyCh := range applyChs {
+		for want := 0; want < commands; want++ {
+			select {
+			case msg := <-applyCh:
+				if !msg.CommandValid || msg.CommandIndex != want || msg.Command != want {
+					t.Fatalf("Node %d: expected command %d at index %d, got %+v", node, want, want, msg)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("Node %d: timed out waiting for command %d", node, want)
+			}
+		}
+		select {
+		case msg := <-applyCh:
+			t.Errorf("Node %d: unexpected extra message %+v", node, msg)
+		case <-time.After(3 * consensus.BroadcastInterval):
+		}
+	}
+}
+
+// waitForApplied reads applyCh until the command at index has been applied
+func waitForApplied(t *testing.T, applyCh chan consensus.ApplyMsg, index int) {
+	t.Helper()
+	for {
+		select {
+		case msg := <-applyCh:
+			if msg.CommandValid && msg.CommandIndex == index {
+				return
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for index %d to be applied", index)
+		}
+	}
+}
+
+// Test case for catching up a lagging follower with the leader's snapshot
+func TestRaftInstallSnapshot(t *testing.T) {
+	nodes, transport, applyChs := newRaftCluster(t, 3)
+	leader := waitForLeader(t, nodes, func(int) bool { return true })
+	lagging := (leader + 1) % len(nodes)
+	transport.SetConnected(lagging, false)
+
+	for i := 0; i < 10; i++ {
+		if _, _, isLeader := nodes[leader].Start(i); !isLeader {
+			t.Fatalf("Expected node %d to still be leader", leader)
+		}
+	}
+
+	// Every connected node compacts, so whichever leads after the rejoin sends a snapshot
+	state := []byte("state through index 7")
+	for i, node := range nodes {
+		if i == lagging {
+			continue
+		}
+		waitForApplied(t, applyChs[i], 7)
+		node.Snapshot(7, state)
+	}
+	transport.SetConnected(lagging, true)
+
+	select {
+	case msg := <-applyChs[lagging]:
+		if !msg.SnapshotValid || msg.SnapshotIndex != 7 || string(msg.Snapshot) != string(state) {
+			t.Fatalf("Expected the snapshot through index 7 first, got %+v", msg)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Timed out waiting for the snapshot")
+	}
+	for want := 8; want < 10; want++ {
+		select {
+		case msg := <-applyChs[lagging]:
+			if !msg.CommandValid || msg.CommandIndex != want || msg.Command != want {
+				t.Fatalf("Expected command %d after the snapshot, got %+v", want, msg)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for command %d", want)
+		}
+	}
+}
+
+// Test case for restoring a snapshot from the persister after a restart
+func TestRaftSnapshotRecovery(t *testing.T) {
+	persister, err := consensus.NewFilePersister(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create persister: %v", err)
+	}
+	applyCh := make(chan consensus.ApplyMsg, 100)
+	rf := consensus.NewRaft(0, nil, applyCh, consensus.NewMockTransport(), consensus.WithPersister(persister))
+	waitForLeader(t, []*consensus.Raft{rf}, func(int) bool { return true })
+
+	for i := 0; i < 5; i++ {
+		rf.Start(i)
+	}
+	waitForApplied(t, applyCh, 4)
+	rf.Snapshot(2, []byte("snap"))
+
+	rf.Stop()
+	restartCh := make(chan consensus.ApplyMsg, 100)
+	restarted := consensus.NewRaft(0, nil, restartCh, consensus.NewMockTransport(), consensus.WithPersister(persister))
+	defer restarted.Stop()
+	select {
+	case msg := <-restartCh:
+		if !msg.SnapshotValid || msg.SnapshotIndex != 2 || string(msg.Snapshot) != "snap" {
+			t.Errorf("Expected the restarted node to deliver the snapshot through index 2, got %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for the recovered snapshot")
+	}
+}
+
+// Test case for stopping many nodes without leaking goroutines
+func TestRaftStopLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	for round := 0; round < 20; round++ {
+		nodes, _, _ := newRaftCluster(t, 3)
+		time.Sleep(consensus.ElectionTimeout / 10)
+		for _, node := range nodes {
+			node.Stop()
+			node.Stop()
+		}
+		if _, _, isLeader := nodes[0].Start("ignored"); isLeader {
+			t.Fatalf("Expected a stopped node to refuse commands")
+		}
+	}
+
+	// Wait for in-flight RPCs to finish
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("Expected goroutines to return to %d after stopping, got %d", before, after)
+	}
+}
+
+// Test case for adding and removing servers through configuration entries in the log
+func TestRaftMembershipChange(t *testing.T) {
+	nodes, transport, applyChs := newRaftCluster(t, 3)
+	connected := func(int) bool { return true }
+
+	// Commit an entry first so the new server's empty log can't win an election
+	first := waitForLeader(t, nodes, connected)
+	index, _, _ := nodes[first].Start("before join")
+	waitForApplied(t, applyChs[first], index)
+
+	// The new server starts with the configuration it is about to join
+	applyCh := make(chan consensus.ApplyMsg, 100)
+	joined := consensus.NewRaft(3, []int{0, 1, 2}, applyCh, transport)
+	transport.Register(3, joined)
+	t.Cleanup(joined.Stop)
+	all := append(nodes, joined)
+
+	var leader int
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		leader = waitForLeader(t, all, connected)
+		err := all[leader].AddServer(3)
+		if err == nil {
+			break
+		}
+		if err != consensus.ErrNotLeader || time.Now().After(deadline) {
+			t.Fatalf("Failed to add server 3: %v", err)
+		}
+	}
+	if err := all[leader].AddServer(3); err != consensus.ErrConfigChangePending && err != consensus.ErrAlreadyMember {
+		t.Errorf("Expected a second change to be refused, got %v", err)
+	}
+
+	index, _, isLeader := all[leader].Start("after join")
+	if !isLeader {
+		t.Fatalf("Expected node %d to still be leader", leader)
+	}
+	waitForApplied(t, applyCh, index)
+
+	// Remove one of the original followers and keep committing without it
+	removed := (leader + 1) % len(nodes)
+	for time.Now().Before(deadline) {
+		if err := all[leader].RemoveServer(removed); err != consensus.ErrConfigChangePending {
+			if err != nil {
+				t.Fatalf("Failed to remove server %d: %v", removed, err)
+			}
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	transport.SetConnected(removed, false)
+
+	index, _, isLeader = all[leader].Start("after removal")
+	if !isLeader {
+		t.Fatalf("Expected node %d to still be leader", leader)
+	}
+	waitForApplied(t, applyCh, index)
+	waitForApplied(t, applyChs[leader], index)
+}
@@ -0,0 +1,265 @@
+package consensus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// ErrPeerUnreachable is returned when a transport cannot reach a peer
+var ErrPeerUnreachable = errors.New("peer unreachable")
+
+// Transport carries Raft RPCs from a node to its peers
+type Transport interface {
+	RequestVote(ctx context.Context, peer int, args *RequestVoteArgs, reply *RequestVoteReply) error
+	AppendEntries(ctx context.Context, peer int, args *AppendEntriesArgs, reply *AppendEntriesReply) error
+	InstallSnapshot(ctx context.Context, peer int, args *InstallSnapshotArgs, reply *InstallSnapshotReply) error
+}
+
+// RPCHandler is implemented by the receiving side of Raft RPCs
+type RPCHandler interface {
+	RequestVote(args *RequestVoteArgs, reply *RequestVoteReply) error
+	AppendEntries(args *AppendEntriesArgs, reply *AppendEntriesReply) error
+	InstallSnapshot(args *InstallSnapshotArgs, reply *InstallSnapshotReply) error
+}
+
+// Raft messages are plain structs without generated protobuf code, so the gRPC
+// transport exchanges them as JSON through a registered codec
+const (
+	jsonCodecName   = "json"
+	raftServiceName = "consensus.Raft"
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return jsonCodecName }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// GRPCTransport sends Raft RPCs to peers over gRPC
+type GRPCTransport struct {
+	mu        sync.Mutex
+	addresses map[int]string
+	conns     map[int]*grpc.ClientConn
+}
+
+// NewGRPCTransport creates a transport dialing peers at the given addresses by ID
+func NewGRPCTransport(addresses map[int]string) *GRPCTransport {
+	return &GRPCTransport{
+		addresses: addresses,
+		conns:     make(map[int]*grpc.ClientConn),
+	}
+}
+
+// SetAddress sets the address of a peer, for servers added to the cluster at runtime
+func (t *GRPCTransport) SetAddress(peer int, address string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if conn, ok := t.conns[peer]; ok && t.addresses[peer] != address {
+		conn.Close()
+		delete(t.conns, peer)
+	}
+	t.addresses[peer] = address
+}
+
+// conn returns the connection to a peer, dialing it on first use
+func (t *GRPCTransport) conn(peer int) (*grpc.ClientConn, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if conn, ok := t.conns[peer]; ok {
+		return conn, nil
+	}
+	address, ok := t.addresses[peer]
+	if !ok {
+		return nil, fmt.Errorf("%w: no address for peer %d", ErrPeerUnreachable, peer)
+	}
+	conn, err := grpc.Dial(address, grpc.WithInsecure())
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial peer %d: %v", peer, err)
+	}
+	t.conns[peer] = conn
+	return conn, nil
+}
+
+func (t *GRPCTransport) invoke(ctx context.Context, peer int, method string, args, reply interface{}) error {
+	conn, err := t.conn(peer)
+	if err != nil {
+		return err
+	}
+	if err := conn.Invoke(ctx, "/"+raftServiceName+"/"+method, args, reply, grpc.CallContentSubtype(jsonCodecName)); err != nil {
+		return fmt.Errorf("%s to peer %d failed: %v", method, peer, err)
+	}
+	return nil
+}
+
+// RequestVote sends a RequestVote RPC to a peer
+func (t *GRPCTransport) RequestVote(ctx context.Context, peer int, args *RequestVoteArgs, reply *RequestVoteReply) error {
+	return t.invoke(ctx, peer, "RequestVote", args, reply)
+}
+
+// AppendEntries sends an AppendEntries RPC to a peer
+func (t *GRPCTransport) AppendEntries(ctx context.Context, peer int, args *AppendEntriesArgs, reply *AppendEntriesReply) error {
+	return t.invoke(ctx, peer, "AppendEntries", args, reply)
+}
+
+// InstallSnapshot sends an InstallSnapshot RPC to a peer
+func (t *GRPCTransport) InstallSnapshot(ctx context.Context, peer int, args *InstallSnapshotArgs, reply *InstallSnapshotReply) error {
+	return t.invoke(ctx, peer, "InstallSnapshot", args, reply)
+}
+
+// Close closes every peer connection
+func (t *GRPCTransport) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for peer, conn := range t.conns {
+		conn.Close()
+		delete(t.conns, peer)
+	}
+}
+
+// RegisterRaftServer registers a handler for incoming Raft RPCs on a gRPC server
+func RegisterRaftServer(s *grpc.Server, handler RPCHandler) {
+	s.RegisterService(&raftServiceDesc, handler)
+}
+
+func requestVoteHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	args := new(RequestVoteArgs)
+	if err := dec(args); err != nil {
+		return nil, err
+	}
+	handle := func(ctx context.Context, req interface{}) (interface{}, error) {
+		reply := new(RequestVoteReply)
+		err := srv.(RPCHandler).RequestVote(req.(*RequestVoteArgs), reply)
+		return reply, err
+	}
+	if interceptor == nil {
+		return handle(ctx, args)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + raftServiceName + "/RequestVote"}
+	return interceptor(ctx, args, info, handle)
+}
+
+func appendEntriesHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	args := new(AppendEntriesArgs)
+	if err := dec(args); err != nil {
+		return nil, err
+	}
+	handle := func(ctx context.Context, req interface{}) (interface{}, error) {
+		reply := new(AppendEntriesReply)
+		err := srv.(RPCHandler).AppendEntries(req.(*AppendEntriesArgs), reply)
+		return reply, err
+	}
+	if interceptor == nil {
+		return handle(ctx, args)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + raftServiceName + "/AppendEntries"}
+	return interceptor(ctx, args, info, handle)
+}
+
+func installSnapshotHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	args := new(InstallSnapshotArgs)
+	if err := dec(args); err != nil {
+		return nil, err
+	}
+	handle := func(ctx context.Context, req interface{}) (interface{}, error) {
+		reply := new(InstallSnapshotReply)
+		err := srv.(RPCHandler).InstallSnapshot(req.(*InstallSnapshotArgs), reply)
+		return reply, err
+	}
+	if interceptor == nil {
+		return handle(ctx, args)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + raftServiceName + "/InstallSnapshot"}
+	return interceptor(ctx, args, info, handle)
+}
+
+var raftServiceDesc = grpc.ServiceDesc{
+	ServiceName: raftServiceName,
+	HandlerType: (*RPCHandler)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "RequestVote", Handler: requestVoteHandler},
+		{MethodName: "AppendEntries", Handler: appendEntriesHandler},
+		{MethodName: "InstallSnapshot", Handler: installSnapshotHandler},
+	},
+}
+
+// MockTransport delivers RPCs in-process to registered handlers, for tests. Peers can be
+// disconnected to simulate network partitions.
+type MockTransport struct {
+	mu           sync.RWMutex
+	handlers     map[int]RPCHandler
+	disconnected map[int]bool
+}
+
+// NewMockTransport creates an empty MockTransport
+func NewMockTransport() *MockTransport {
+	return &MockTransport{
+		handlers:     make(map[int]RPCHandler),
+		disconnected: make(map[int]bool),
+	}
+}
+
+// Register makes a handler reachable as the given peer
+func (t *MockTransport) Register(peer int, handler RPCHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handlers[peer] = handler
+}
+
+// SetConnected connects or disconnects a peer; RPCs to or from a disconnected peer fail
+func (t *MockTransport) SetConnected(peer int, connected bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.disconnected[peer] = !connected
+}
+
+func (t *MockTransport) handler(ctx context.Context, from, peer int) (RPCHandler, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	handler, ok := t.handlers[peer]
+	if !ok || t.disconnected[peer] || t.disconnected[from] {
+		return nil, fmt.Errorf("%w: peer %d", ErrPeerUnreachable, peer)
+	}
+	return handler, nil
+}
+
+// RequestVote delivers a RequestVote RPC to a registered peer
+func (t *MockTransport) RequestVote(ctx context.Context, peer int, args *RequestVoteArgs, reply *RequestVoteReply) error {
+	handler, err := t.handler(ctx, args.CandidateID, peer)
+	if err != nil {
+		return err
+	}
+	return handler.RequestVote(args, reply)
+}
+
+// AppendEntries delivers an AppendEntries RPC to a registered peer
+func (t *MockTransport) AppendEntries(ctx context.Context, peer int, args *AppendEntriesArgs, reply *AppendEntriesReply) error {
+	handler, err := t.handler(ctx, args.LeaderID, peer)
+	if err != nil {
+		return err
+	}
+	return handler.AppendEntries(args, reply)
+}
+
+// InstallSnapshot delivers an InstallSnapshot RPC to a registered peer
+func (t *MockTransport) InstallSnapshot(ctx context.Context, peer int, args *InstallSnapshotArgs, reply *InstallSnapshotReply) error {
+	handler, err := t.handler(ctx, args.LeaderID, peer)
+	if err != nil {
+		return err
+	}
+	return handler.InstallSnapshot(args, reply)
+}
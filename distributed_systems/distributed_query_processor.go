@@ -7,53 +7,208 @@ import (
 	"log"
 	"sync"
 	"time"
+
+	"distributed_systems/cluster"
 )
 
-// Query represents a database query.
+// Query represents a database query. ShardKey, when set, lets a ShardRouter send the
+// query only to the nodes owning that key. Merger combines the nodes' rows; by default
+// they are concatenated.
 type Query struct {
 	ID        string
 	Statement string
+	ShardKey  string
+	Merger    Merger `json:"-"`
 }
 
-// Result represents the result of a query.
+const (
+	defaultHealthCheckInterval = 5 * time.Second
+	defaultFailureThreshold    = 3
+	defaultPingTimeout         = 500 * time.Millisecond
+	pingAttempts               = 2 // a failed ping is retried once before it counts as a failure
+	defaultMaxInFlight         = 64
+)
+
+// ErrPartialResult is returned in strict mode when some nodes failed to answer a query.
+var ErrPartialResult = errors.New("partial result")
+
+// Result represents the result of a query. An aggregated Result is Partial when one or
+// more nodes failed, with the failures listed in NodeErrors.
 type Result struct {
-	QueryID string
-	Data    []interface{}
-	Error   error
+	QueryID    string
+	Data       []interface{}
+	Error      error
+	NodeErrors []*NodeError
+	Partial    bool
 }
 
-// Node represents a distributed node that can process queries.
-type Node struct {
-	ID   string
-	Addr string
+// NodeError records why a node failed to answer a query.
+type NodeError struct {
+	NodeID string
+	Err    error
+}
+
+func (e *NodeError) Error() string {
+	return fmt.Sprintf("node %s: %v", e.NodeID, e.Err)
 }
 
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+// Node represents a distributed node that can process queries.
+type Node = cluster.Node
+
 // QueryProcessor handles query distribution and result aggregation across multiple nodes.
 type QueryProcessor struct {
-	nodes []*Node
-	mu    sync.Mutex
+	nodes  []*Node
+	client NodeClient
+	router RoutingStrategy
+	strict bool // fail a query if any node fails instead of returning a partial result
+
+	fanOutTimeout time.Duration    // how long a query waits for nodes; 0 waits for all of them
+	hedgeAfter    time.Duration    // delay before re-issuing a query to a replica; 0 disables hedging
+	replicas      map[string]*Node // node ID to the replica that can answer in its place
+
+	healthCheckInterval time.Duration  // time between health checks
+	failureThreshold    int            // consecutive failed checks before a node is removed
+	pingTimeout         time.Duration  // timeout of a single ping
+	failures            map[string]int // node ID to consecutive failed checks
+	down                []*Node        // removed nodes, still checked so they can recover
+
+	maxInFlight int           // node requests allowed in flight across all queries
+	inFlight    chan struct{} // semaphore holding a token per in-flight node request
+
+	mu sync.Mutex
 }
 
-// NewQueryProcessor initializes a QueryProcessor with a list of nodes.
-func NewQueryProcessor(nodes []*Node) *QueryProcessor {
-	return &QueryProcessor{nodes: nodes}
+// QueryProcessorOption configures a QueryProcessor.
+type QueryProcessorOption func(*QueryProcessor)
+
+// WithRouter sets the strategy choosing which nodes receive a query. By default queries
+// are broadcast to every node.
+func WithRouter(router RoutingStrategy) QueryProcessorOption {
+	return func(qp *QueryProcessor) {
+		qp.router = router
+	}
+}
+
+// WithStrictMode makes ExecuteQuery fail with ErrPartialResult if any node fails, rather
+// than returning the results of the nodes that answered.
+func WithStrictMode() QueryProcessorOption {
+	return func(qp *QueryProcessor) {
+		qp.strict = true
+	}
+}
+
+// WithFanOutTimeout bounds how long a query waits for nodes, independently of its context.
+// Nodes that haven't answered by then are reported as failed and the result is partial.
+func WithFanOutTimeout(timeout time.Duration) QueryProcessorOption {
+	return func(qp *QueryProcessor) {
+		qp.fanOutTimeout = timeout
+	}
 }
 
-// ExecuteQuery sends a query to multiple nodes, processes the results, and aggregates them.
+// WithHedging re-issues a node's query to its replica, keyed by node ID, when the node
+// hasn't answered within after or has failed. The first successful answer is used.
+func WithHedging(after time.Duration, replicas map[string]*Node) QueryProcessorOption {
+	return func(qp *QueryProcessor) {
+		qp.hedgeAfter = after
+		qp.replicas = replicas
+	}
+}
+
+// WithHealthCheck sets how often nodes are checked, how many consecutive failed checks
+// remove a node, and the timeout of a single ping
+func WithHealthCheck(interval time.Duration, failureThreshold int, timeout time.Duration) QueryProcessorOption {
+	return func(qp *QueryProcessor) {
+		qp.healthCheckInterval = interval
+		qp.failureThreshold = failureThreshold
+		qp.pingTimeout = timeout
+	}
+}
+
+// WithMaxInFlight bounds how many node requests may be in flight at once across all
+// queries. Further requests wait for a slot, so a large cluster under many concurrent
+// queries slows down instead of exhausting resources.
+func WithMaxInFlight(n int) QueryProcessorOption {
+	return func(qp *QueryProcessor) {
+		qp.maxInFlight = n
+	}
+}
+
+// NewQueryProcessor initializes a QueryProcessor with a list of nodes and the client used
+// to send them queries, such as a grpcnode.GRPCNodeClient.
+func NewQueryProcessor(nodes []*Node, client NodeClient, opts ...QueryProcessorOption) *QueryProcessor {
+	qp := &QueryProcessor{
+		nodes:               nodes,
+		client:              client,
+		healthCheckInterval: defaultHealthCheckInterval,
+		failureThreshold:    defaultFailureThreshold,
+		pingTimeout:         defaultPingTimeout,
+		failures:            make(map[string]int),
+		maxInFlight:         defaultMaxInFlight,
+	}
+	for _, opt := range opts {
+		opt(qp)
+	}
+	if qp.maxInFlight <= 0 {
+		qp.maxInFlight = defaultMaxInFlight
+	}
+	qp.inFlight = make(chan struct{}, qp.maxInFlight)
+	if qp.router == nil {
+		qp.router = BroadcastRouter{}
+	}
+	return qp
+}
+
+// ExecuteQuery sends a query to the nodes chosen by the routing strategy, processes the
+// results, and aggregates them. Nodes that fail are reported in the result's NodeErrors
+// and mark it Partial. The query runs against a snapshot of the node list taken when it
+// starts; nodes added or removed while it is in flight only affect later queries.
 func (qp *QueryProcessor) ExecuteQuery(ctx context.Context, query *Query) (*Result, error) {
-	if len(qp.nodes) == 0 {
+	nodes := qp.Nodes()
+	if len(nodes) == 0 {
 		return nil, errors.New("no nodes available for processing")
 	}
+	targets, err := qp.router.Route(query, nodes)
+	if err != nil {
+		return nil, fmt.Errorf("route query %s: %w", query.ID, err)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("route query %s: %w", query.ID, ErrNoRoute)
+	}
+
+	fanOutCtx := ctx
+	if qp.fanOutTimeout > 0 {
+		var cancel context.CancelFunc
+		fanOutCtx, cancel = context.WithTimeout(ctx, qp.fanOutTimeout)
+		defer cancel()
+	}
 
-	resultChan := make(chan *Result, len(qp.nodes))
+	type nodeResult struct {
+		node *Node
+		res  *Result
+	}
+	resultChan := make(chan nodeResult, len(targets))
 	var wg sync.WaitGroup
 
-	for _, node := range qp.nodes {
+	for _, node := range targets {
+		// Take a slot before starting the request; a hedged request shares its node's slot
+		select {
+		case qp.inFlight <- struct{}{}:
+		case <-fanOutCtx.Done():
+			resultChan <- nodeResult{node: node, res: &Result{
+				QueryID: query.ID,
+				Error:   fmt.Errorf("query %s on node %s: %w", query.ID, node.ID, fanOutCtx.Err()),
+			}}
+			continue
+		}
 		wg.Add(1)
 		go func(n *Node) {
 			defer wg.Done()
-			res := qp.sendQueryToNode(ctx, n, query)
-			resultChan <- res
+			defer func() { <-qp.inFlight }()
+			resultChan <- nodeResult{node: n, res: qp.queryNode(fanOutCtx, n, query)}
 		}(node)
 	}
 
@@ -62,37 +217,106 @@ func (qp *QueryProcessor) ExecuteQuery(ctx context.Context, query *Query) (*Resu
 		close(resultChan)
 	}()
 
-	aggregatedResult := &Result{QueryID: query.ID, Data: make([]interface{}, 0)}
-	for res := range resultChan {
-		if res.Error != nil {
-			log.Printf("Error from node %s: %v", res.QueryID, res.Error)
+	aggregatedResult := &Result{QueryID: query.ID}
+	parts := make([][]interface{}, 0, len(targets))
+	for nr := range resultChan {
+		if nr.res.Error != nil {
+			log.Printf("Error from node %s for query %s: %v", nr.node.ID, query.ID, nr.res.Error)
+			aggregatedResult.NodeErrors = append(aggregatedResult.NodeErrors, &NodeError{NodeID: nr.node.ID, Err: nr.res.Error})
 			continue
 		}
-		aggregatedResult.Data = append(aggregatedResult.Data, res.Data...)
+		parts = append(parts, nr.res.Data)
 	}
+	aggregatedResult.Partial = len(aggregatedResult.NodeErrors) > 0
 
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("query %s: %w", query.ID, err)
+	}
+	if aggregatedResult.Partial && qp.strict {
+		return nil, fmt.Errorf("query %s: %w: %d of %d nodes failed, first: %v",
+			query.ID, ErrPartialResult, len(aggregatedResult.NodeErrors), len(targets), aggregatedResult.NodeErrors[0])
+	}
+
+	var merger Merger = ConcatMerger{}
+	if query.Merger != nil {
+		merger = query.Merger
+	}
+	data, err := merger.Merge(parts)
+	if err != nil {
+		return nil, fmt.Errorf("merge results of query %s: %w", query.ID, err)
+	}
+	aggregatedResult.Data = data
 	return aggregatedResult, nil
 }
 
-// sendQueryToNode sends a query to a specific node and waits for the result.
+// queryNode sends a query to a node, hedging to the node's replica if one is configured
+func (qp *QueryProcessor) queryNode(ctx context.Context, node *Node, query *Query) *Result {
+	replica, ok := qp.replicas[node.ID]
+	if qp.hedgeAfter <= 0 || !ok {
+		return qp.sendQueryToNode(ctx, node, query)
+	}
+
+	// The losing request is cancelled once an answer is chosen
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan *Result, 2)
+	go func() { results <- qp.sendQueryToNode(ctx, node, query) }()
+	timer := time.NewTimer(qp.hedgeAfter)
+	defer timer.Stop()
+
+	var failed *Result
+	pending, hedged := 1, false
+	hedge := func() {
+		hedged = true
+		pending++
+		go func() { results <- qp.sendQueryToNode(ctx, replica, query) }()
+	}
+	for pending > 0 {
+		select {
+		case res := <-results:
+			pending--
+			if res.Error == nil {
+				return res
+			}
+			if failed == nil {
+				failed = res
+			}
+			if !hedged {
+				hedge()
+			}
+		case <-timer.C:
+			if !hedged {
+				log.Printf("Node %s slow to answer query %s, hedging to replica %s", node.ID, query.ID, replica.ID)
+				hedge()
+			}
+		}
+	}
+	return failed
+}
+
+// sendQueryToNode sends a query to a specific node and waits for the result. It always
+// returns a Result; if ctx ends first the Result carries the context's error.
 func (qp *QueryProcessor) sendQueryToNode(ctx context.Context, node *Node, query *Query) *Result {
-	// Create a channel to simulate a result that could take time to generate.
+	// Buffered so the dispatching goroutine never blocks on send after a cancellation,
+	// and exits as soon as the client returns, which it does once ctx is done.
 	resultChan := make(chan *Result, 1)
 
-	// Simulate network latency and query processing asynchronously.
+	// Dispatch asynchronously so cancellation is noticed even while the call is in flight.
 	go func() {
-		time.Sleep(time.Duration(50+int(node.ID[0])) * time.Millisecond)
-		resultChan <- &Result{
-			QueryID: query.ID,
-			Data:    []interface{}{fmt.Sprintf("Result from node %s", node.ID)},
+		result, err := qp.client.Query(ctx, node, query)
+		if err != nil {
+			result = &Result{QueryID: query.ID, Error: err}
 		}
+		resultChan <- result
 	}()
 
 	select {
 	case <-ctx.Done():
-		// Handle context cancellation or timeout.
-		fmt.Println("Query canceled")
-		return nil
+		return &Result{
+			QueryID: query.ID,
+			Error:   fmt.Errorf("query %s on node %s: %w", query.ID, node.ID, ctx.Err()),
+		}
 	case result := <-resultChan:
 		return result
 	}
@@ -110,6 +334,13 @@ func (qp *QueryProcessor) RemoveNode(nodeID string) {
 	qp.mu.Lock()
 	defer qp.mu.Unlock()
 
+	delete(qp.failures, nodeID)
+	for i, node := range qp.down {
+		if node.ID == nodeID {
+			qp.down = append(qp.down[:i], qp.down[i+1:]...)
+			break
+		}
+	}
 	for i, node := range qp.nodes {
 		if node.ID == nodeID {
 			qp.nodes = append(qp.nodes[:i], qp.nodes[i+1:]...)
@@ -118,27 +349,98 @@ func (qp *QueryProcessor) RemoveNode(nodeID string) {
 	}
 }
 
-// HealthCheck performs a health check on all nodes and removes any that are unresponsive.
+// Nodes returns the nodes queries are currently sent to.
+func (qp *QueryProcessor) Nodes() []*Node {
+	qp.mu.Lock()
+	defer qp.mu.Unlock()
+	return append([]*Node(nil), qp.nodes...)
+}
+
+// HealthCheck pings every node. A node is removed once it has failed failureThreshold
+// consecutive checks, and a removed node is restored as soon as it answers again.
 func (qp *QueryProcessor) HealthCheck() {
+	qp.mu.Lock()
+	nodes := append(append([]*Node(nil), qp.nodes...), qp.down...)
+	qp.mu.Unlock()
+
+	// Ping without holding the lock so queries aren't blocked behind slow nodes
+	healthy := make(map[string]bool, len(nodes))
+	var healthyMu sync.Mutex
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node *Node) {
+			defer wg.Done()
+			ok := qp.pingNode(node)
+			healthyMu.Lock()
+			healthy[node.ID] = ok
+			healthyMu.Unlock()
+		}(node)
+	}
+	wg.Wait()
+
 	qp.mu.Lock()
 	defer qp.mu.Unlock()
 
-	healthyNodes := make([]*Node, 0)
+	active := make([]*Node, 0, len(qp.nodes))
 	for _, node := range qp.nodes {
-		if qp.pingNode(node) {
-			healthyNodes = append(healthyNodes, node)
-		} else {
-			log.Printf("Node %s is unresponsive and will be removed", node.ID)
+		ok, checked := healthy[node.ID]
+		if !checked || ok {
+			delete(qp.failures, node.ID)
+			active = append(active, node)
+			continue
 		}
+		qp.failures[node.ID]++
+		if qp.failures[node.ID] < qp.failureThreshold {
+			log.Printf("Node %s failed health check (%d/%d)", node.ID, qp.failures[node.ID], qp.failureThreshold)
+			active = append(active, node)
+			continue
+		}
+		log.Printf("Node %s is unresponsive and will be removed", node.ID)
+		qp.down = append(qp.down, node)
 	}
-	qp.nodes = healthyNodes
+
+	down := make([]*Node, 0, len(qp.down))
+	for _, node := range qp.down {
+		if healthy[node.ID] {
+			log.Printf("Node %s has recovered and is back in rotation", node.ID)
+			delete(qp.failures, node.ID)
+			active = append(active, node)
+			continue
+		}
+		down = append(down, node)
+	}
+	qp.nodes = active
+	qp.down = down
 }
 
-// pingNode simulates a health check by pinging a node.
-func (qp *QueryProcessor) pingNode(*Node) bool {
-	// Simulating health check delay.
-	time.Sleep(10 * time.Millisecond)
-	return true
+// pingNode checks whether a node answers, retrying a failed ping once.
+func (qp *QueryProcessor) pingNode(node *Node) bool {
+	var err error
+	for attempt := 0; attempt < pingAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), qp.pingTimeout)
+		err = qp.client.Ping(ctx, node)
+		cancel()
+		if err == nil {
+			return true
+		}
+	}
+	log.Printf("Ping to node %s failed: %v", node.ID, err)
+	return false
+}
+
+// runHealthChecks checks the nodes every healthCheckInterval until ctx is done.
+func (qp *QueryProcessor) runHealthChecks(ctx context.Context) {
+	ticker := time.NewTicker(qp.healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			qp.HealthCheck()
+		}
+	}
 }
 
 // mainQueryLoop is the entry point for processing queries in a continuous loop.
@@ -167,48 +469,16 @@ func (qp *QueryProcessor) StartQueryProcessor(ctx context.Context) (chan *Query,
 	resultChan := make(chan *Result)
 
 	go qp.mainQueryLoop(ctx, queryChan, resultChan)
+	go qp.runHealthChecks(ctx)
 
 	return queryChan, resultChan
 }
 
 // Shutdown gracefully shuts down the query processor.
 func (qp *QueryProcessor) Shutdown(ctx context.Context) error {
-	// Perform cleanup operations if necessary.
 	log.Println("Shutting down query processor.")
-	return nil
-}
-
-// Usage of the distributed query processor.
-func main() {
-	nodes := []*Node{
-		{ID: "1", Addr: "192.168.1.1"},
-		{ID: "2", Addr: "192.168.1.2"},
-		{ID: "3", Addr: "192.168.1.3"},
+	if closer, ok := qp.client.(interface{ Close() }); ok {
+		closer.Close()
 	}
-
-	qp := NewQueryProcessor(nodes)
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	queryChan, resultChan := qp.StartQueryProcessor(ctx)
-
-	go func() {
-		queries := []*Query{
-			{ID: "q1", Statement: "SELECT * FROM users"},
-			{ID: "q2", Statement: "SELECT * FROM orders"},
-		}
-		for _, query := range queries {
-			queryChan <- query
-		}
-	}()
-
-	go func() {
-		for result := range resultChan {
-			log.Printf("Received result for query %s: %v", result.QueryID, result.Data)
-		}
-	}()
-
-	// Simulate running for a while.
-	time.Sleep(5 * time.Second)
-	qp.Shutdown(ctx)
+	return nil
 }
@@ -0,0 +1,353 @@
+package distributed_query_processor_test
+
+import (
+	"context"
+	dqp "distributed_systems"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newQueryCluster creates a query processor over n mock nodes, each answering with a
+// single row naming itself
+func newQueryCluster(n int) (*dqp.QueryProcessor, *dqp.MockNodeClient) {
+	client := dqp.NewMockNodeClient()
+	nodes := make([]*dqp.Node, n)
+	for i := range nodes {
+		id := fmt.Sprintf("node-%d", i)
+		nodes[i] = &dqp.Node{ID: id}
+		client.Register(id, func(ctx context.Context, query *dqp.Query) ([]interface{}, error) {
+			return []interface{}{id + ":" + query.Statement}, nil
+		})
+	}
+	return dqp.NewQueryProcessor(nodes, client), client
+}
+
+// Test case for dispatching a query to every node through the node client
+func TestQueryProcessorDispatch(t *testing.T) {
+	qp, client := newQueryCluster(3)
+	client.Unregister("node-2")
+
+	res, err := qp.ExecuteQuery(context.Background(), &dqp.Query{ID: "q1", Statement: "SELECT 1"})
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	if res.QueryID != "q1" {
+		t.Errorf("Expected result for q1, got %s", res.QueryID)
+	}
+	got := make(map[interface{}]bool)
+	for _, row := range res.Data {
+		got[row] = true
+	}
+	if len(res.Data) != 2 || !got["node-0:SELECT 1"] || !got["node-1:SELECT 1"] {
+		t.Errorf("Expected rows from the two reachable nodes, got %v", res.Data)
+	}
+}
+
+// Test case for reporting which nodes failed, and failing outright in strict mode
+func TestQueryProcessorPartialFailure(t *testing.T) {
+	qp, client := newQueryCluster(3)
+	query := &dqp.Query{ID: "q1", Statement: "SELECT 1"}
+
+	res, err := qp.ExecuteQuery(context.Background(), query)
+	if err != nil || res.Partial || len(res.NodeErrors) != 0 {
+		t.Fatalf("Expected a complete result from healthy nodes, got %+v, %v", res, err)
+	}
+
+	client.Unregister("node-2")
+	res, err = qp.ExecuteQuery(context.Background(), query)
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	if !res.Partial || len(res.Data) != 2 {
+		t.Errorf("Expected a partial result with 2 rows, got %+v", res)
+	}
+	if len(res.NodeErrors) != 1 || res.NodeErrors[0].NodeID != "node-2" || !errors.Is(res.NodeErrors[0], dqp.ErrNodeUnreachable) {
+		t.Errorf("Expected node-2 to be reported unreachable, got %v", res.NodeErrors)
+	}
+
+	strict := dqp.NewQueryProcessor([]*dqp.Node{{ID: "node-0"}, {ID: "node-2"}}, client, dqp.WithStrictMode())
+	if res, err := strict.ExecuteQuery(context.Background(), query); !errors.Is(err, dqp.ErrPartialResult) {
+		t.Errorf("Expected strict mode to fail the query, got %+v, %v", res, err)
+	}
+}
+
+// Test case for cancelling a query while nodes are still working on it
+func TestQueryProcessorCancel(t *testing.T) {
+	qp, client := newQueryCluster(3)
+	started := make(chan struct{}, 3)
+	client.Register("node-1", func(ctx context.Context, query *dqp.Query) ([]interface{}, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	res, err := qp.ExecuteQuery(ctx, &dqp.Query{ID: "q1", Statement: "SELECT 1"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected a cancellation error, got result %v and error %v", res, err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("Expected goroutines to return to %d after cancelling, got %d", before, after)
+	}
+}
+
+// Test case for bounding a query by the fan-out timeout and hedging slow nodes to replicas
+func TestQueryProcessorFanOutTimeoutAndHedging(t *testing.T) {
+	_, client := newQueryCluster(3)
+	client.Register("node-1", func(ctx context.Context, query *dqp.Query) ([]interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	client.Register("node-1-replica", func(ctx context.Context, query *dqp.Query) ([]interface{}, error) {
+		return []interface{}{"replica:" + query.Statement}, nil
+	})
+	nodes := []*dqp.Node{{ID: "node-0"}, {ID: "node-1"}, {ID: "node-2"}}
+	query := &dqp.Query{ID: "q1", Statement: "SELECT 1"}
+
+	qp := dqp.NewQueryProcessor(nodes, client, dqp.WithFanOutTimeout(100*time.Millisecond))
+	start := time.Now()
+	res, err := qp.ExecuteQuery(context.Background(), query)
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the fan-out timeout to bound the query, took %v", elapsed)
+	}
+	if !res.Partial || len(res.Data) != 2 || len(res.NodeErrors) != 1 || res.NodeErrors[0].NodeID != "node-1" {
+		t.Errorf("Expected a partial result missing node-1, got %+v", res)
+	}
+
+	replicas := map[string]*dqp.Node{"node-1": {ID: "node-1-replica"}}
+	qp = dqp.NewQueryProcessor(nodes, client,
+		dqp.WithFanOutTimeout(time.Second), dqp.WithHedging(20*time.Millisecond, replicas))
+	start = time.Now()
+	res, err = qp.ExecuteQuery(context.Background(), query)
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the replica to answer before the fan-out timeout, took %v", elapsed)
+	}
+	if res.Partial || len(res.Data) != 3 {
+		t.Errorf("Expected a complete result with the replica's row, got %+v", res)
+	}
+}
+
+// Test case for removing a node only after consecutive failed checks and restoring it on recovery
+func TestQueryProcessorHealthCheck(t *testing.T) {
+	client := dqp.NewMockNodeClient()
+	nodes := []*dqp.Node{{ID: "node-0"}, {ID: "node-1"}, {ID: "node-2"}}
+	handler := func(ctx context.Context, query *dqp.Query) ([]interface{}, error) { return nil, nil }
+	for _, node := range nodes {
+		client.Register(node.ID, handler)
+	}
+	qp := dqp.NewQueryProcessor(nodes, client, dqp.WithHealthCheck(time.Hour, 2, 50*time.Millisecond))
+
+	client.Unregister("node-2")
+	qp.HealthCheck()
+	if got := len(qp.Nodes()); got != 3 {
+		t.Fatalf("Expected a single failed check to keep the node, got %d nodes", got)
+	}
+	qp.HealthCheck()
+	if got := qp.Nodes(); len(got) != 2 || got[0].ID == "node-2" || got[1].ID == "node-2" {
+		t.Fatalf("Expected node-2 to be removed after 2 failed checks, got %v", got)
+	}
+
+	client.Register("node-2", handler)
+	qp.HealthCheck()
+	if got := len(qp.Nodes()); got != 3 {
+		t.Errorf("Expected node-2 to be restored once it answers, got %d nodes", got)
+	}
+}
+
+// Test case for sending keyed queries to their shard owners and broadcasting the rest
+func TestQueryProcessorShardRouting(t *testing.T) {
+	_, client := newQueryCluster(5)
+	nodes := make([]*dqp.Node, 5)
+	for i := range nodes {
+		nodes[i] = &dqp.Node{ID: fmt.Sprintf("node-%d", i)}
+	}
+	qp := dqp.NewQueryProcessor(nodes, client, dqp.WithRouter(dqp.NewShardRouter(2)))
+
+	query := &dqp.Query{ID: "q1", Statement: "SELECT 1", ShardKey: "user:42"}
+	res, err := qp.ExecuteQuery(context.Background(), query)
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	if len(res.Data) != 2 {
+		t.Fatalf("Expected the key's 2 owners to answer, got %v", res.Data)
+	}
+	again, err := qp.ExecuteQuery(context.Background(), query)
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	owners := make(map[interface{}]bool)
+	for _, row := range res.Data {
+		owners[row] = true
+	}
+	for _, row := range again.Data {
+		if !owners[row] {
+			t.Errorf("Expected the same key to route to the same nodes, got %v then %v", res.Data, again.Data)
+		}
+	}
+
+	broadcast, err := qp.ExecuteQuery(context.Background(), &dqp.Query{ID: "q2", Statement: "SELECT 1"})
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	if len(broadcast.Data) != 5 {
+		t.Errorf("Expected a query without a shard key to reach every node, got %v", broadcast.Data)
+	}
+}
+
+// Test case for merging sorted, limited, and aggregated results across three nodes
+func TestQueryProcessorMergers(t *testing.T) {
+	client := dqp.NewMockNodeClient()
+	rows := map[string][]interface{}{
+		"node-0": {1, 4, 7, 10},
+		"node-1": {2, 5, 8},
+		"node-2": {0, 3, 6, 9, 11},
+	}
+	nodes := make([]*dqp.Node, 0, len(rows))
+	for id, data := range rows {
+		data := data
+		nodes = append(nodes, &dqp.Node{ID: id})
+		client.Register(id, func(ctx context.Context, query *dqp.Query) ([]interface{}, error) {
+			return data, nil
+		})
+	}
+	qp := dqp.NewQueryProcessor(nodes, client)
+	less := func(a, b interface{}) bool { return a.(int) < b.(int) }
+
+	res, err := qp.ExecuteQuery(context.Background(), &dqp.Query{ID: "sorted", Merger: dqp.SortedMerger{Less: less}})
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	if len(res.Data) != 12 {
+		t.Fatalf("Expected all 12 rows, got %v", res.Data)
+	}
+	for i, row := range res.Data {
+		if row.(int) != i {
+			t.Fatalf("Expected a globally ordered result, got %v", res.Data)
+		}
+	}
+
+	res, err = qp.ExecuteQuery(context.Background(), &dqp.Query{ID: "top", Merger: dqp.TopNMerger{Less: less, N: 3}})
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	if len(res.Data) != 3 || res.Data[0] != 0 || res.Data[1] != 1 || res.Data[2] != 2 {
+		t.Errorf("Expected the 3 smallest rows, got %v", res.Data)
+	}
+
+	res, err = qp.ExecuteQuery(context.Background(), &dqp.Query{ID: "sum", Merger: dqp.AggregateMerger{Op: dqp.AggregateSum}})
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	if len(res.Data) != 1 || res.Data[0] != 66.0 {
+		t.Errorf("Expected a sum of 66, got %v", res.Data)
+	}
+
+	res, err = qp.ExecuteQuery(context.Background(), &dqp.Query{ID: "max", Merger: dqp.AggregateMerger{Op: dqp.AggregateMax}})
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	if len(res.Data) != 1 || res.Data[0] != 11.0 {
+		t.Errorf("Expected a maximum of 11, got %v", res.Data)
+	}
+}
+
+// Test case for bounding the node requests in flight across concurrent queries
+func TestQueryProcessorMaxInFlight(t *testing.T) {
+	client := dqp.NewMockNodeClient()
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+	nodes := make([]*dqp.Node, 6)
+	for i := range nodes {
+		nodes[i] = &dqp.Node{ID: fmt.Sprintf("node-%d", i)}
+		client.Register(nodes[i].ID, func(ctx context.Context, query *dqp.Query) ([]interface{}, error) {
+			mu.Lock()
+			inFlight++
+			if inFlight > peak {
+				peak = inFlight
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			return []interface{}{query.ID}, nil
+		})
+	}
+	qp := dqp.NewQueryProcessor(nodes, client, dqp.WithMaxInFlight(2))
+
+	var wg sync.WaitGroup
+	for q := 0; q < 3; q++ {
+		wg.Add(1)
+		go func(q int) {
+			defer wg.Done()
+			res, err := qp.ExecuteQuery(context.Background(), &dqp.Query{ID: fmt.Sprintf("q%d", q)})
+			if err != nil || len(res.Data) != len(nodes) {
+				t.Errorf("Expected every node to answer, got %v, %v", res, err)
+			}
+		}(q)
+	}
+	wg.Wait()
+
+	if peak > 2 {
+		t.Errorf("Expected at most 2 node requests in flight, saw %d", peak)
+	}
+}
+
+// Test case for adding and removing nodes while queries are in flight; run with -race
+func TestQueryProcessorConcurrentMembership(t *testing.T) {
+	qp, client := newQueryCluster(3)
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ctx.Err() == nil; i++ {
+			id := fmt.Sprintf("extra-%d", i%4)
+			client.Register(id, func(ctx context.Context, query *dqp.Query) ([]interface{}, error) {
+				return []interface{}{id}, nil
+			})
+			qp.AddNode(&dqp.Node{ID: id})
+			qp.RemoveNode(id)
+		}
+	}()
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				res, err := qp.ExecuteQuery(context.Background(), &dqp.Query{ID: "q", Statement: "SELECT 1"})
+				if err != nil {
+					t.Errorf("ExecuteQuery failed: %v", err)
+					return
+				}
+				if len(res.Data) < 3 {
+					t.Errorf("Expected at least the 3 permanent nodes to answer, got %v", res.Data)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
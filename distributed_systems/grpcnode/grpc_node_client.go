@@ -0,0 +1,171 @@
+package grpcnode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	dqp "distributed_systems"
+	"rpc"
+	"rpc/protos"
+)
+
+// queryResponse is the wire form of a node's answer to a query
+type queryResponse struct {
+	Data  []interface{} `json:"data"`
+	Error string        `json:"error,omitempty"`
+}
+
+// redialBackoff is how long to wait after a failed dial before dialing the same address
+// again, so health checks of a dead node don't redial it every round
+const redialBackoff = 10 * time.Second
+
+// errClientClosed is returned for dials that finish after the client was closed
+var errClientClosed = errors.New("node client closed")
+
+// GRPCNodeClient sends queries over the RPC service, carrying the query and its result as
+// JSON in the request and response messages. Connections are opened on first use and
+// reused for later queries to the same address.
+type GRPCNodeClient struct {
+	config  rpc.ClientConfig
+	mu      sync.Mutex
+	clients map[string]*rpc.RpcClient
+	dialing map[string]*dialCall // dials in progress, shared by every caller waiting on them
+	failed  map[string]time.Time // when the last dial to an address failed
+	closed  bool
+}
+
+// dialCall is a dial in progress; client and err are set before done is closed
+type dialCall struct {
+	done   chan struct{}
+	client *rpc.RpcClient
+	err    error
+}
+
+// NewGRPCNodeClient creates a GRPCNodeClient with no open connections, dialling nodes with
+// the given configuration
+func NewGRPCNodeClient(config rpc.ClientConfig) *GRPCNodeClient {
+	return &GRPCNodeClient{
+		config:  config,
+		clients: make(map[string]*rpc.RpcClient),
+		dialing: make(map[string]*dialCall),
+		failed:  make(map[string]time.Time),
+	}
+}
+
+// client returns the connection to a node, dialing it if needed. The dial runs without the
+// lock held and is shared by concurrent callers for the same address, so a slow node only
+// delays calls to itself; each caller stops waiting when its ctx is done.
+func (c *GRPCNodeClient) client(ctx context.Context, node *dqp.Node) (*rpc.RpcClient, error) {
+	if node.Address == "" {
+		return nil, fmt.Errorf("%w: no address for node %s", dqp.ErrNodeUnreachable, node.ID)
+	}
+	c.mu.Lock()
+	if client, ok := c.clients[node.Address]; ok {
+		c.mu.Unlock()
+		return client, nil
+	}
+	if failedAt, ok := c.failed[node.Address]; ok && time.Since(failedAt) < redialBackoff {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("%w: node %s: last dial failed %v ago", dqp.ErrNodeUnreachable, node.ID, time.Since(failedAt).Round(time.Second))
+	}
+	call, ok := c.dialing[node.Address]
+	if !ok {
+		call = &dialCall{done: make(chan struct{})}
+		c.dialing[node.Address] = call
+		go c.dial(node.Address, call)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		if call.err != nil {
+			return nil, fmt.Errorf("%w: node %s: %v", dqp.ErrNodeUnreachable, node.ID, call.err)
+		}
+		return call.client, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// dial connects to an address and publishes the outcome to the callers waiting on call
+func (c *GRPCNodeClient) dial(address string, call *dialCall) {
+	client, err := rpc.NewRpcClient([]string{address}, c.config)
+
+	c.mu.Lock()
+	delete(c.dialing, address)
+	switch {
+	case err != nil:
+		c.failed[address] = time.Now()
+	case c.closed:
+		if closeErr := client.Close(); closeErr != nil {
+			log.Printf("Failed to close connection to %s: %v", address, closeErr)
+		}
+		client, err = nil, errClientClosed
+	default:
+		delete(c.failed, address)
+		c.clients[address] = client
+	}
+	c.mu.Unlock()
+
+	call.client, call.err = client, err
+	close(call.done)
+}
+
+// Query sends a query to a node and decodes its result
+func (c *GRPCNodeClient) Query(ctx context.Context, node *dqp.Node, query *dqp.Query) (*dqp.Result, error) {
+	client, err := c.client(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.UnaryCall(ctx, &protos.Request{Message: string(payload)})
+	if err != nil {
+		return nil, fmt.Errorf("query %s on node %s: %w", query.ID, node.ID, err)
+	}
+
+	var decoded queryResponse
+	if err := json.Unmarshal([]byte(resp.Message), &decoded); err != nil {
+		return nil, fmt.Errorf("decode result from node %s: %w", node.ID, err)
+	}
+	result := &dqp.Result{QueryID: query.ID, Data: decoded.Data}
+	if decoded.Error != "" {
+		result.Error = errors.New(decoded.Error)
+	}
+	return result, nil
+}
+
+// Ping checks that a node reports SERVING over the gRPC health checking protocol, so a node
+// taken out of a load balancer's rotation is marked down here too
+func (c *GRPCNodeClient) Ping(ctx context.Context, node *dqp.Node) error {
+	client, err := c.client(ctx, node)
+	if err != nil {
+		return err
+	}
+	if err := client.HealthCheck(ctx); err != nil {
+		return fmt.Errorf("ping node %s: %w", node.ID, err)
+	}
+	return nil
+}
+
+// Close closes every open connection. Connections whose dial is still in progress are
+// closed once it completes.
+func (c *GRPCNodeClient) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for address, client := range c.clients {
+		if err := client.Close(); err != nil {
+			log.Printf("Failed to close connection to %s: %v", address, err)
+		}
+		delete(c.clients, address)
+	}
+}
@@ -0,0 +1,173 @@
+package distributed_query_processor
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNotNumeric is returned when an aggregate is asked to combine a non-numeric value
+var ErrNotNumeric = errors.New("value is not numeric")
+
+// Merger combines the rows returned by each node into the rows of the query's result
+type Merger interface {
+	Merge(parts [][]interface{}) ([]interface{}, error)
+}
+
+// ConcatMerger appends the nodes' rows in the order the nodes answered
+type ConcatMerger struct{}
+
+// Merge concatenates the parts
+func (ConcatMerger) Merge(parts [][]interface{}) ([]interface{}, error) {
+	merged := make([]interface{}, 0)
+	for _, part := range parts {
+		merged = append(merged, part...)
+	}
+	return merged, nil
+}
+
+// SortedMerger merges rows that each node returned already sorted, as for an ORDER BY, into
+// one sorted result
+type SortedMerger struct {
+	Less func(a, b interface{}) bool
+}
+
+// Merge performs a k-way merge of the sorted parts
+func (m SortedMerger) Merge(parts [][]interface{}) ([]interface{}, error) {
+	return mergeSorted(parts, m.Less, -1), nil
+}
+
+// TopNMerger keeps the first N rows of the sorted merge, as for an ORDER BY with a LIMIT.
+// Each node only needs to return its own first N rows.
+type TopNMerger struct {
+	Less func(a, b interface{}) bool
+	N    int
+}
+
+// Merge merges the sorted parts and stops after N rows
+func (m TopNMerger) Merge(parts [][]interface{}) ([]interface{}, error) {
+	if m.N < 0 {
+		return nil, fmt.Errorf("invalid limit %d", m.N)
+	}
+	return mergeSorted(parts, m.Less, m.N), nil
+}
+
+// mergeSorted merges sorted parts, returning at most limit rows unless limit is negative
+func mergeSorted(parts [][]interface{}, less func(a, b interface{}) bool, limit int) []interface{} {
+	h := &rowHeap{less: less}
+	for i, part := range parts {
+		if len(part) > 0 {
+			h.cursors = append(h.cursors, rowCursor{part: i})
+		}
+	}
+	h.parts = parts
+	heap.Init(h)
+
+	merged := make([]interface{}, 0)
+	for h.Len() > 0 && (limit < 0 || len(merged) < limit) {
+		c := &h.cursors[0]
+		merged = append(merged, parts[c.part][c.pos])
+		c.pos++
+		if c.pos < len(parts[c.part]) {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return merged
+}
+
+// rowCursor is the position of the next unmerged row in one part
+type rowCursor struct {
+	part, pos int
+}
+
+// rowHeap orders cursors by their next row
+type rowHeap struct {
+	parts   [][]interface{}
+	cursors []rowCursor
+	less    func(a, b interface{}) bool
+}
+
+func (h *rowHeap) Len() int { return len(h.cursors) }
+func (h *rowHeap) Less(i, j int) bool {
+	a, b := h.cursors[i], h.cursors[j]
+	return h.less(h.parts[a.part][a.pos], h.parts[b.part][b.pos])
+}
+func (h *rowHeap) Swap(i, j int)      { h.cursors[i], h.cursors[j] = h.cursors[j], h.cursors[i] }
+func (h *rowHeap) Push(x interface{}) { h.cursors = append(h.cursors, x.(rowCursor)) }
+func (h *rowHeap) Pop() interface{} {
+	last := h.cursors[len(h.cursors)-1]
+	h.cursors = h.cursors[:len(h.cursors)-1]
+	return last
+}
+
+// AggregateOp is a numeric aggregate that can be combined across nodes
+type AggregateOp int
+
+const (
+	// AggregateCount adds up the nodes' counts
+	AggregateCount AggregateOp = iota
+	// AggregateSum adds up the nodes' sums
+	AggregateSum
+	// AggregateMin keeps the smallest of the nodes' minimums
+	AggregateMin
+	// AggregateMax keeps the largest of the nodes' maximums
+	AggregateMax
+)
+
+// AggregateMerger combines the partial aggregates computed by each node into a single row
+type AggregateMerger struct {
+	Op AggregateOp
+}
+
+// Merge folds every row of every part into one numeric value. The result is empty for a
+// minimum or maximum over no rows.
+func (m AggregateMerger) Merge(parts [][]interface{}) ([]interface{}, error) {
+	var total float64
+	seen := false
+	for _, part := range parts {
+		for _, row := range part {
+			v, err := toFloat(row)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case m.Op == AggregateCount || m.Op == AggregateSum:
+				total += v
+			case !seen:
+				total = v
+			case m.Op == AggregateMin && v < total, m.Op == AggregateMax && v > total:
+				total = v
+			}
+			seen = true
+		}
+	}
+	if !seen && (m.Op == AggregateMin || m.Op == AggregateMax) {
+		return []interface{}{}, nil
+	}
+	return []interface{}{total}, nil
+}
+
+// toFloat converts a row value decoded from JSON or produced in-process to a float64
+func toFloat(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case float32:
+		return float64(n), nil
+	case int:
+		return float64(n), nil
+	case int32:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case uint64:
+		return float64(n), nil
+	case json.Number:
+		return n.Float64()
+	default:
+		return 0, fmt.Errorf("%w: %v (%T)", ErrNotNumeric, v, v)
+	}
+}
@@ -0,0 +1,74 @@
+package distributed_query_processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNodeUnreachable is returned when a client cannot reach a node
+var ErrNodeUnreachable = errors.New("node unreachable")
+
+// NodeClient sends queries to the nodes of the cluster
+type NodeClient interface {
+	Query(ctx context.Context, node *Node, query *Query) (*Result, error)
+	Ping(ctx context.Context, node *Node) error
+}
+
+// QueryHandler answers a query on behalf of a mock node
+type QueryHandler func(ctx context.Context, query *Query) ([]interface{}, error)
+
+// MockNodeClient answers queries in-process with registered handlers, for tests
+type MockNodeClient struct {
+	mu       sync.RWMutex
+	handlers map[string]QueryHandler
+}
+
+// NewMockNodeClient creates an empty MockNodeClient
+func NewMockNodeClient() *MockNodeClient {
+	return &MockNodeClient{handlers: make(map[string]QueryHandler)}
+}
+
+// Register makes a handler answer queries sent to the node with the given ID
+func (m *MockNodeClient) Register(nodeID string, handler QueryHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[nodeID] = handler
+}
+
+// Unregister makes a node unreachable
+func (m *MockNodeClient) Unregister(nodeID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.handlers, nodeID)
+}
+
+// Query runs the handler registered for the node
+func (m *MockNodeClient) Query(ctx context.Context, node *Node, query *Query) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	handler, ok := m.handlers[node.ID]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: node %s", ErrNodeUnreachable, node.ID)
+	}
+
+	data, err := handler(ctx, query)
+	return &Result{QueryID: query.ID, Data: data, Error: err}, nil
+}
+
+// Ping succeeds for nodes with a registered handler
+func (m *MockNodeClient) Ping(ctx context.Context, node *Node) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.handlers[node.ID]; !ok {
+		return fmt.Errorf("%w: node %s", ErrNodeUnreachable, node.ID)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package distributed_query_processor
+
+import (
+	"errors"
+	"hash/fnv"
+	"sort"
+)
+
+// ErrNoRoute is returned when a routing strategy selects no nodes for a query
+var ErrNoRoute = errors.New("no nodes to route query to")
+
+// RoutingStrategy picks the nodes a query is sent to
+type RoutingStrategy interface {
+	Route(query *Query, nodes []*Node) ([]*Node, error)
+}
+
+// BroadcastRouter sends every query to every node
+type BroadcastRouter struct{}
+
+// Route returns all nodes
+func (BroadcastRouter) Route(query *Query, nodes []*Node) ([]*Node, error) {
+	if len(nodes) == 0 {
+		return nil, ErrNoRoute
+	}
+	return nodes, nil
+}
+
+// ShardRouter sends a query to the nodes owning its shard key. Owners are chosen by
+// rendezvous hashing, so adding or removing a node only moves the keys it owns. Queries
+// without a key are broadcast.
+type ShardRouter struct {
+	// Key extracts the shard key from a query; by default the query's ShardKey is used
+	Key func(query *Query) (string, bool)
+	// Replicas is how many nodes own each key; values below 1 mean one
+	Replicas int
+}
+
+// NewShardRouter creates a ShardRouter routing each key to the given number of nodes
+func NewShardRouter(replicas int) *ShardRouter {
+	return &ShardRouter{Replicas: replicas}
+}
+
+// Route returns the owners of the query's shard key, or all nodes if it has none
+func (r *ShardRouter) Route(query *Query, nodes []*Node) ([]*Node, error) {
+	if len(nodes) == 0 {
+		return nil, ErrNoRoute
+	}
+	key, ok := r.key(query)
+	if !ok {
+		return nodes, nil
+	}
+
+	replicas := r.Replicas
+	if replicas < 1 {
+		replicas = 1
+	}
+	if replicas > len(nodes) {
+		replicas = len(nodes)
+	}
+
+	ranked := append([]*Node(nil), nodes...)
+	weights := make(map[*Node]uint64, len(ranked))
+	for _, node := range ranked {
+		weights[node] = shardWeight(key, node.ID)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if weights[ranked[i]] != weights[ranked[j]] {
+			return weights[ranked[i]] > weights[ranked[j]]
+		}
+		return ranked[i].ID < ranked[j].ID
+	})
+	return ranked[:replicas], nil
+}
+
+func (r *ShardRouter) key(query *Query) (string, bool) {
+	if r.Key != nil {
+		return r.Key(query)
+	}
+	return query.ShardKey, query.ShardKey != ""
+}
+
+// shardWeight is the rendezvous hash of a key on a node
+func shardWeight(key, nodeID string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write([]byte(nodeID))
+	return h.Sum64()
+}
@@ -0,0 +1,179 @@
+package monitoring
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultAlertQueueSize is the number of alerts that can wait for delivery before new ones are dropped
+const DefaultAlertQueueSize = 100
+
+// dispatchItem is a queued alert with the notifiers it goes to, or a drain marker
+type dispatchItem struct {
+	alert     Alert
+	notifiers []Notifier
+	flushed   chan struct{} // set on drain markers, closed once reached
+}
+
+// alertDispatcher delivers alerts to notifiers on a worker goroutine so slow notifiers
+// never block metric collection
+type alertDispatcher struct {
+	queueLock sync.RWMutex // guards closed against sends on a closed queue
+	closed    bool
+	queue     chan dispatchItem
+	done      chan struct{}
+	dropped   uint64
+}
+
+// newAlertDispatcher starts a dispatcher buffering up to size alerts
+func newAlertDispatcher(size int) *alertDispatcher {
+	d := &alertDispatcher{
+		queue: make(chan dispatchItem, size),
+		done:  make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// run delivers queued alerts until the queue is closed
+func (d *alertDispatcher) run() {
+	defer close(d.done)
+	for item := range d.queue {
+		if item.flushed != nil {
+			close(item.flushed)
+			continue
+		}
+		// A failing notifier doesn't stop the others
+		for _, notifier := range item.notifiers {
+			if err := notifier.Notify(item.alert); err != nil {
+				log.Printf("Failed to send %s alert on %s via %T: %v", item.alert.Level, item.alert.Metric, notifier, err)
+			}
+		}
+	}
+}
+
+// enqueue queues an alert without blocking, dropping it when the queue is full
+func (d *alertDispatcher) enqueue(alert Alert, notifiers []Notifier) {
+	d.queueLock.RLock()
+	defer d.queueLock.RUnlock()
+
+	if d.closed {
+		atomic.AddUint64(&d.dropped, 1)
+		return
+	}
+	select {
+	case d.queue <- dispatchItem{alert: alert, notifiers: notifiers}:
+	default:
+		atomic.AddUint64(&d.dropped, 1)
+		log.Printf("Alert queue full, dropping %s alert on %s", alert.Level, alert.Metric)
+	}
+}
+
+// droppedCount returns the number of alerts dropped so far
+func (d *alertDispatcher) droppedCount() uint64 {
+	return atomic.LoadUint64(&d.dropped)
+}
+
+// drain waits until every alert queued before the call has been delivered
+func (d *alertDispatcher) drain() {
+	d.queueLock.RLock()
+	if d.closed {
+		d.queueLock.RUnlock()
+		<-d.done
+		return
+	}
+	flushed := make(chan struct{})
+	d.queue <- dispatchItem{flushed: flushed}
+	d.queueLock.RUnlock()
+	<-flushed
+}
+
+// close stops accepting alerts and waits for the pending ones to be delivered
+func (d *alertDispatcher) close() {
+	d.queueLock.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.queueLock.Unlock()
+	<-d.done
+}
+
+// historyWriter saves alert history snapshots on a worker goroutine so a slow store never
+// holds up alerting. A snapshot queued while another is still waiting replaces it, since
+// each one is the whole history.
+type historyWriter struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	store   AlertHistoryStore
+	pending []Alert
+	dirty   bool // pending has not been handed to the store yet
+	saving  bool
+	closed  bool
+	done    chan struct{}
+}
+
+// newHistoryWriter starts a historyWriter
+func newHistoryWriter() *historyWriter {
+	w := &historyWriter{done: make(chan struct{})}
+	w.cond = sync.NewCond(&w.mu)
+	go w.run()
+	return w
+}
+
+// run saves snapshots until the writer is closed and nothing is pending
+func (w *historyWriter) run() {
+	defer close(w.done)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for {
+		for !w.dirty && !w.closed {
+			w.cond.Wait()
+		}
+		if !w.dirty {
+			return
+		}
+		store, alerts := w.store, w.pending
+		w.pending, w.dirty, w.saving = nil, false, true
+		w.mu.Unlock()
+		if err := store.Save(alerts); err != nil {
+			log.Printf("Failed to persist alert history: %v", err)
+		}
+		w.mu.Lock()
+		w.saving = false
+		w.cond.Broadcast()
+	}
+}
+
+// save queues a snapshot of the history for store without waiting for it to be written.
+// Snapshots queued after close are discarded.
+func (w *historyWriter) save(store AlertHistoryStore, alerts []Alert) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+	w.store, w.pending, w.dirty = store, alerts, true
+	w.cond.Broadcast()
+}
+
+// flush waits until every snapshot queued before the call has been written
+func (w *historyWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for w.dirty || w.saving {
+		w.cond.Wait()
+	}
+}
+
+// close writes the pending snapshot and stops the worker
+func (w *historyWriter) close() {
+	w.mu.Lock()
+	w.closed = true
+	w.cond.Broadcast()
+	w.mu.Unlock()
+	<-w.done
+}
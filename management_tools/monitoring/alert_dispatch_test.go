@@ -0,0 +1,54 @@
+package monitoring_test
+
+import (
+	"management_tools/monitoring"
+	"testing"
+	"time"
+)
+
+// blockingHistoryStore holds every Save until release is closed
+type blockingHistoryStore struct {
+	release chan struct{}
+	saved   chan []monitoring.Alert
+}
+
+func (s *blockingHistoryStore) Save(alerts []monitoring.Alert) error {
+	<-s.release
+	s.saved <- alerts
+	return nil
+}
+
+func (s *blockingHistoryStore) Load() ([]monitoring.Alert, error) { return nil, nil }
+
+// Test case for persisting the alert history without blocking alerting on the store
+func TestAlertHistoryPersistedInBackground(t *testing.T) {
+	alerting := monitoring.NewAlertingSystem(monitoring.EmailConfig{})
+	store := &blockingHistoryStore{release: make(chan struct{}), saved: make(chan []monitoring.Alert, 10)}
+	if err := alerting.SetHistoryStore(store); err != nil {
+		t.Fatalf("Failed to set history store: %v", err)
+	}
+
+	fired := make(chan struct{})
+	go func() {
+		alerting.CollectMetric(monitoring.Metric{Type: monitoring.MetricTypeCPUUsage, Value: 95, Timestamp: time.Now()})
+		close(fired)
+	}()
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("Alerting blocked on a slow history store")
+	}
+	if len(alerting.GetRecentAlerts(0)) != 1 {
+		t.Errorf("Expected the alert in the history while it is being saved")
+	}
+
+	close(store.release)
+	alerting.Close()
+	var last []monitoring.Alert
+	for len(store.saved) > 0 {
+		last = <-store.saved
+	}
+	if len(last) != 1 || last[0].Metric != monitoring.MetricTypeCPUUsage {
+		t.Errorf("Expected the alert to be persisted by Close, got %v", last)
+	}
+}
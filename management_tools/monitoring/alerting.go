@@ -1,9 +1,12 @@
 package monitoring
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
-	"net/smtp"
+	"os"
+	"sort"
 	"sync"
 	"time"
 )
@@ -22,18 +25,54 @@ type AlertLevel string
 const (
 	AlertLevelWarning  AlertLevel = "WARNING"
 	AlertLevelCritical AlertLevel = "CRITICAL"
+	// AlertLevelResolved marks the alert emitted when a metric returns below its warning threshold
+	AlertLevelResolved AlertLevel = "RESOLVED"
+)
+
+const (
+	// DefaultAlertCooldown is how long a repeat alert for the same metric and level is
+	// suppressed while the alert fires
+	DefaultAlertCooldown = 5 * time.Minute
+	// DefaultAlertHistoryLimit is the number of alerts retained in the history
+	DefaultAlertHistoryLimit = 1000
 )
 
 type Alert struct {
-	Metric    MetricType
-	Level     AlertLevel
-	Message   string
-	Timestamp time.Time
+	Metric    MetricType `json:"metric"`
+	Level     AlertLevel `json:"level"`
+	Message   string     `json:"message"`
+	Timestamp time.Time  `json:"timestamp"`
+	// Resolved and ResolvedAt are set on a fired alert once its metric recovers
+	Resolved   bool      `json:"resolved,omitempty"`
+	ResolvedAt time.Time `json:"resolved_at,omitempty"`
+	// Escalated is set on a critical alert raised because a warning persisted
+	Escalated bool `json:"escalated,omitempty"`
 }
 
+// Threshold holds the trigger levels of a metric. The optional clear levels add hysteresis:
+// a firing alert only drops below a level once the value falls under its clear level.
+// A clear level that is unset or above its trigger level falls back to the trigger level.
 type Threshold struct {
-	Warning  float64
-	Critical float64
+	Warning       float64
+	Critical      float64
+	WarningClear  float64
+	CriticalClear float64
+}
+
+// warningClear returns the level below which a warning alert resolves
+func (t Threshold) warningClear() float64 {
+	if t.WarningClear <= 0 || t.WarningClear > t.Warning {
+		return t.Warning
+	}
+	return t.WarningClear
+}
+
+// criticalClear returns the level below which a critical alert drops to warning
+func (t Threshold) criticalClear() float64 {
+	if t.CriticalClear <= 0 || t.CriticalClear > t.Critical {
+		return t.Critical
+	}
+	return t.CriticalClear
 }
 
 type Metric struct {
@@ -43,22 +82,42 @@ type Metric struct {
 }
 
 type AlertingSystem struct {
-	mu          sync.Mutex
-	thresholds  map[MetricType]Threshold
-	alerts      []Alert
-	emailConfig EmailConfig
+	mu         sync.Mutex
+	thresholds map[MetricType]Threshold
+	alerts     []*Alert // ring buffer of the alert history
+	head       int      // index of the oldest alert
+	count      int      // number of alerts retained
+	history    AlertHistoryStore
+	notifiers  []Notifier
+	cooldown   time.Duration
+	active     map[MetricType]*activeAlert // alerts firing per metric until it recovers
+	lastFired  map[alertKey]time.Time      // last notification per metric and level
+	escalation time.Duration               // age after which a warning escalates; 0 disables
+	dispatcher *alertDispatcher
+	writer     *historyWriter
+}
+
+// activeAlert tracks a firing alert. level follows the metric between warning and
+// critical while record is the history entry of the notification that was sent.
+type activeAlert struct {
+	level     AlertLevel
+	record    *Alert
+	firstSeen time.Time
+	escalated bool
 }
 
-type EmailConfig struct {
-	SMTPServer string
-	Port       int
-	Username   string
-	Password   string
-	From       string
-	To         []string
+// alertKey identifies alerts of one level for one metric
+type alertKey struct {
+	metric MetricType
+	level  AlertLevel
 }
 
-func NewAlertingSystem(emailConfig EmailConfig) *AlertingSystem {
+// NewAlertingSystem creates an AlertingSystem that notifies by email when emailConfig has an
+// SMTP server set, and through any additional notifiers.
+func NewAlertingSystem(emailConfig EmailConfig, notifiers ...Notifier) *AlertingSystem {
+	if emailConfig.SMTPServer != "" {
+		notifiers = append([]Notifier{NewEmailNotifier(emailConfig)}, notifiers...)
+	}
 	return &AlertingSystem{
 		thresholds: map[MetricType]Threshold{
 			MetricTypeCPUUsage:     {Warning: 70.0, Critical: 90.0},
@@ -66,10 +125,34 @@ func NewAlertingSystem(emailConfig EmailConfig) *AlertingSystem {
 			MetricTypeDiskSpace:    {Warning: 80.0, Critical: 95.0},
 			MetricTypeResponseTime: {Warning: 200.0, Critical: 500.0},
 		},
-		emailConfig: emailConfig,
+		alerts:     make([]*Alert, DefaultAlertHistoryLimit),
+		notifiers:  notifiers,
+		cooldown:   DefaultAlertCooldown,
+		active:     make(map[MetricType]*activeAlert),
+		lastFired:  make(map[alertKey]time.Time),
+		dispatcher: newAlertDispatcher(DefaultAlertQueueSize),
+		writer:     newHistoryWriter(),
 	}
 }
 
+// SetCooldown sets how long repeat alerts for the same metric and level are suppressed
+// while the alert is still firing, so a metric flapping between warning and critical
+// doesn't spam notifications. A metric that recovers and triggers again always alerts.
+func (as *AlertingSystem) SetCooldown(cooldown time.Duration) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	as.cooldown = cooldown
+}
+
+// AddNotifier registers another destination for alerts
+func (as *AlertingSystem) AddNotifier(notifier Notifier) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	as.notifiers = append(as.notifiers, notifier)
+}
+
 func (as *AlertingSystem) CollectMetric(metric Metric) {
 	as.mu.Lock()
 	defer as.mu.Unlock()
@@ -79,23 +162,202 @@ func (as *AlertingSystem) CollectMetric(metric Metric) {
 		log.Printf("No thresholds set for metric type: %s\n", metric.Type)
 		return
 	}
+	if metric.Timestamp.IsZero() {
+		metric.Timestamp = time.Now()
+	}
 
-	alert := as.evaluateThresholds(metric, threshold)
-	if alert != nil {
-		as.alerts = append(as.alerts, *alert)
-		as.sendAlert(alert)
+	current, firing := as.active[metric.Type]
+	var currentLevel AlertLevel
+	if firing {
+		currentLevel = current.level
 	}
+	alert := as.evaluateThresholds(metric, threshold, currentLevel)
+
+	if alert == nil {
+		if firing {
+			delete(as.active, metric.Type)
+			// The cooldown only applies while the alert fires; after a resolve the next
+			// trigger is a new alert
+			delete(as.lastFired, alertKey{metric: metric.Type, level: AlertLevelWarning})
+			delete(as.lastFired, alertKey{metric: metric.Type, level: AlertLevelCritical})
+			current.record.Resolved = true
+			current.record.ResolvedAt = metric.Timestamp
+			as.fire(&Alert{
+				Metric:    metric.Type,
+				Level:     AlertLevelResolved,
+				Message:   fmt.Sprintf("%s has returned to normal at %.2f", metric.Type, metric.Value),
+				Timestamp: metric.Timestamp,
+			})
+		}
+		return
+	}
+
+	if firing && current.level == alert.Level {
+		if alert.Level == AlertLevelWarning && as.escalation > 0 && !current.escalated &&
+			metric.Timestamp.Sub(current.firstSeen) >= as.escalation {
+			as.escalate(current, metric)
+		}
+		// Still firing at the same level; wait for recovery before alerting again
+		return
+	}
+	if firing && current.escalated {
+		// An escalated alert stays critical until the metric recovers
+		return
+	}
+	if firing && current.level == AlertLevelCritical {
+		// Dropping from critical to warning doesn't notify, but a later return to
+		// critical should
+		current.level = alert.Level
+		return
+	}
+
+	key := alertKey{metric: alert.Metric, level: alert.Level}
+	if last, ok := as.lastFired[key]; firing && ok && metric.Timestamp.Sub(last) < as.cooldown {
+		// Returning to critical soon after dropping from it is tracked without notifying
+		log.Printf("Suppressing repeat %s alert on %s within cooldown", alert.Level, alert.Metric)
+		current.level = alert.Level
+		return
+	}
+	as.lastFired[key] = metric.Timestamp
+	firstSeen := metric.Timestamp
+	if firing {
+		// Escalating from warning to critical supersedes the warning
+		current.record.Resolved = true
+		current.record.ResolvedAt = metric.Timestamp
+		firstSeen = current.firstSeen
+	}
+	as.active[metric.Type] = &activeAlert{level: alert.Level, record: as.fire(alert), firstSeen: firstSeen}
+}
+
+// escalate raises a persisting warning to critical and notifies again
+func (as *AlertingSystem) escalate(current *activeAlert, metric Metric) {
+	age := metric.Timestamp.Sub(current.firstSeen).Round(time.Second)
+	current.record.Resolved = true
+	current.record.ResolvedAt = metric.Timestamp
+	current.level = AlertLevelCritical
+	current.escalated = true
+	current.record = as.fire(&Alert{
+		Metric:    metric.Type,
+		Level:     AlertLevelCritical,
+		Message:   fmt.Sprintf("%s has remained at warning level for %s (now %.2f), escalating", metric.Type, age, metric.Value),
+		Timestamp: metric.Timestamp,
+		Escalated: true,
+	})
 }
 
-func (as *AlertingSystem) evaluateThresholds(metric Metric, threshold Threshold) *Alert {
-	if metric.Value >= threshold.Critical {
+// SetEscalation makes a warning that stays unresolved for longer than after escalate to
+// critical with a new notification. Zero disables escalation.
+func (as *AlertingSystem) SetEscalation(after time.Duration) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	as.escalation = after
+}
+
+// fire records an alert in the history and notifies every notifier, returning the history entry
+func (as *AlertingSystem) fire(alert *Alert) *Alert {
+	record := *alert
+	as.appendLocked(&record)
+	as.persistLocked()
+	as.sendAlert(alert)
+	return &record
+}
+
+// appendLocked adds an alert to the history, overwriting the oldest once full; as.mu must be held
+func (as *AlertingSystem) appendLocked(alert *Alert) {
+	if as.count < len(as.alerts) {
+		as.alerts[(as.head+as.count)%len(as.alerts)] = alert
+		as.count++
+		return
+	}
+	as.alerts[as.head] = alert
+	as.head = (as.head + 1) % len(as.alerts)
+}
+
+// recentLocked returns up to n of the newest alerts in chronological order, or the whole
+// history when n is not positive; as.mu must be held
+func (as *AlertingSystem) recentLocked(n int) []Alert {
+	if n <= 0 || n > as.count {
+		n = as.count
+	}
+	alerts := make([]Alert, n)
+	start := as.head + as.count - n
+	for i := 0; i < n; i++ {
+		alerts[i] = *as.alerts[(start+i)%len(as.alerts)]
+	}
+	return alerts
+}
+
+// persistLocked queues a snapshot of the history for the configured store, which writes it
+// in the background; as.mu must be held
+func (as *AlertingSystem) persistLocked() {
+	if as.history == nil {
+		return
+	}
+	as.writer.save(as.history, as.recentLocked(0))
+}
+
+// SetHistoryLimit changes how many alerts are retained, keeping the newest ones
+func (as *AlertingSystem) SetHistoryLimit(limit int) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	if limit < 1 {
+		limit = 1
+	}
+	keep := as.count
+	if keep > limit {
+		keep = limit
+	}
+	// Keep the existing entries so active alerts still point into the history
+	retained := make([]*Alert, 0, keep)
+	for i := as.count - keep; i < as.count; i++ {
+		retained = append(retained, as.alerts[(as.head+i)%len(as.alerts)])
+	}
+	as.alerts = make([]*Alert, limit)
+	as.head, as.count = 0, 0
+	for _, alert := range retained {
+		as.appendLocked(alert)
+	}
+}
+
+// SetHistoryStore persists the alert history to store after every alert and replaces the
+// current history with the alerts previously saved there. Alerts restored this way are
+// history only; they are not treated as firing.
+func (as *AlertingSystem) SetHistoryStore(store AlertHistoryStore) error {
+	saved, err := store.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load alert history: %w", err)
+	}
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	as.history = store
+	as.head, as.count = 0, 0
+	for i := range saved {
+		as.appendLocked(&saved[i])
+	}
+	return nil
+}
+
+// evaluateThresholds returns the alert a metric value warrants, or nil when it is normal.
+// currentLevel is the level already firing for the metric, if any, and keeps the alert at
+// that level until the value falls below the corresponding clear level.
+func (as *AlertingSystem) evaluateThresholds(metric Metric, threshold Threshold, currentLevel AlertLevel) *Alert {
+	critical := metric.Value >= threshold.Critical ||
+		(currentLevel == AlertLevelCritical && metric.Value >= threshold.criticalClear())
+	warning := metric.Value >= threshold.Warning ||
+		(currentLevel != "" && metric.Value >= threshold.warningClear())
+
+	if critical {
 		return &Alert{
 			Metric:    metric.Type,
 			Level:     AlertLevelCritical,
 			Message:   fmt.Sprintf("%s has reached a critical value of %.2f", metric.Type, metric.Value),
 			Timestamp: metric.Timestamp,
 		}
-	} else if metric.Value >= threshold.Warning {
+	} else if warning {
 		return &Alert{
 			Metric:    metric.Type,
 			Level:     AlertLevelWarning,
@@ -106,48 +368,124 @@ func (as *AlertingSystem) evaluateThresholds(metric Metric, threshold Threshold)
 	return nil
 }
 
+// sendAlert queues an alert for delivery to every notifier without waiting for it
 func (as *AlertingSystem) sendAlert(alert *Alert) {
-	message := fmt.Sprintf(
-		"To: %s\r\nSubject: %s Alert: %s\r\n\r\n%s occurred at %s with the message: %s\r\n",
-		as.emailConfig.To,
-		alert.Level,
-		alert.Metric,
-		alert.Level,
-		alert.Timestamp.Format(time.RFC822),
-		alert.Message,
-	)
-
-	auth := smtp.PlainAuth("", as.emailConfig.Username, as.emailConfig.Password, as.emailConfig.SMTPServer)
-
-	err := smtp.SendMail(
-		fmt.Sprintf("%s:%d", as.emailConfig.SMTPServer, as.emailConfig.Port),
-		auth,
-		as.emailConfig.From,
-		as.emailConfig.To,
-		[]byte(message),
-	)
-	if err != nil {
-		log.Printf("Failed to send alert email: %v", err)
-	} else {
-		log.Printf("Alert email sent for %s alert on %s", alert.Level, alert.Metric)
-	}
+	notifiers := make([]Notifier, len(as.notifiers))
+	copy(notifiers, as.notifiers)
+	as.dispatcher.enqueue(*alert, notifiers)
+}
+
+// DroppedAlerts returns the number of alerts discarded because the dispatch queue was full
+// or the AlertingSystem was closed
+func (as *AlertingSystem) DroppedAlerts() uint64 {
+	return as.dispatcher.droppedCount()
+}
+
+// Drain blocks until every alert queued so far has been delivered and the history has been
+// persisted
+func (as *AlertingSystem) Drain() {
+	as.dispatcher.drain()
+	as.writer.flush()
+}
+
+// Close delivers the pending alerts, persists the history and stops the background
+// workers. Alerts raised after Close are dropped.
+func (as *AlertingSystem) Close() error {
+	as.dispatcher.close()
+	as.writer.close()
+	return nil
+}
+
+// GetRecentAlerts returns up to n of the most recent alerts in chronological order, including
+// resolved alerts and resolution events. A non-positive n returns the whole retained history.
+func (as *AlertingSystem) GetRecentAlerts(n int) []Alert {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	return as.recentLocked(n)
 }
 
-func (as *AlertingSystem) GetRecentAlerts() []Alert {
+// GetActiveAlerts returns the alerts still firing, oldest first, at their current level
+func (as *AlertingSystem) GetActiveAlerts() []Alert {
 	as.mu.Lock()
 	defer as.mu.Unlock()
 
-	return as.alerts
+	alerts := make([]Alert, 0, len(as.active))
+	for _, current := range as.active {
+		alert := *current.record
+		alert.Level = current.level
+		alerts = append(alerts, alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Timestamp.Before(alerts[j].Timestamp)
+	})
+	return alerts
 }
 
-func (as *AlertingSystem) ConfigureThresholds(metricType MetricType, warning float64, critical float64) {
+// ConfigureThresholds sets the trigger levels of a metric. Optional clearLevels set the
+// warning and critical clear levels, in that order; omitted ones fall back to the trigger level.
+func (as *AlertingSystem) ConfigureThresholds(metricType MetricType, warning float64, critical float64, clearLevels ...float64) {
 	as.mu.Lock()
 	defer as.mu.Unlock()
 
-	as.thresholds[metricType] = Threshold{
+	threshold := Threshold{
 		Warning:  warning,
 		Critical: critical,
 	}
+	if len(clearLevels) > 0 {
+		threshold.WarningClear = clearLevels[0]
+	}
+	if len(clearLevels) > 1 {
+		threshold.CriticalClear = clearLevels[1]
+	}
+	as.thresholds[metricType] = threshold
+
+	log.Printf("Thresholds updated for %s: Warning = %.2f (clear %.2f), Critical = %.2f (clear %.2f)",
+		metricType, warning, threshold.warningClear(), critical, threshold.criticalClear())
+}
 
-	log.Printf("Thresholds updated for %s: Warning = %.2f, Critical = %.2f", metricType, warning, critical)
+// AlertHistoryStore persists the alert history so it survives restarts
+type AlertHistoryStore interface {
+	Save(alerts []Alert) error
+	Load() ([]Alert, error)
+}
+
+// FileAlertHistoryStore keeps the alert history in a JSON file
+type FileAlertHistoryStore struct {
+	Path string
+}
+
+// Save writes the alert history to the file
+func (s *FileAlertHistoryStore) Save(alerts []Alert) error {
+	jsonData, err := json.Marshal(alerts)
+	if err != nil {
+		return fmt.Errorf("failed to serialize alerts: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated history
+	tmpPath := s.Path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, jsonData, 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.Path); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return nil
+}
+
+// Load reads the alert history from the file; a missing file is an empty history
+func (s *FileAlertHistoryStore) Load() ([]Alert, error) {
+	jsonData, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var alerts []Alert
+	if err := json.Unmarshal(jsonData, &alerts); err != nil {
+		return nil, fmt.Errorf("failed to deserialize alerts: %w", err)
+	}
+	return alerts, nil
 }
@@ -0,0 +1,177 @@
+package monitoring_test
+
+import (
+	"management_tools/monitoring"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingNotifier keeps every alert it is notified of
+type recordingNotifier struct {
+	mu     sync.Mutex
+	alerts []monitoring.Alert
+}
+
+func (n *recordingNotifier) Notify(alert monitoring.Alert) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+func (n *recordingNotifier) levels() []monitoring.AlertLevel {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	levels := make([]monitoring.AlertLevel, len(n.alerts))
+	for i, alert := range n.alerts {
+		levels[i] = alert.Level
+	}
+	return levels
+}
+
+func equalLevels(got, want []monitoring.AlertLevel) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// newRecordedAlerting creates an AlertingSystem notifying a recordingNotifier, and a
+// collect function feeding it CPU samples taken at offsets from a fixed start
+func newRecordedAlerting(t *testing.T) (*monitoring.AlertingSystem, *recordingNotifier, func(time.Duration, float64)) {
+	recorder := &recordingNotifier{}
+	alerting := monitoring.NewAlertingSystem(monitoring.EmailConfig{}, recorder)
+	t.Cleanup(func() { alerting.Close() })
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	collect := func(at time.Duration, value float64) {
+		alerting.CollectMetric(monitoring.Metric{Type: monitoring.MetricTypeCPUUsage, Value: value, Timestamp: start.Add(at)})
+	}
+	return alerting, recorder, collect
+}
+
+func activeLevel(t *testing.T, alerting *monitoring.AlertingSystem) monitoring.AlertLevel {
+	t.Helper()
+	active := alerting.GetActiveAlerts()
+	switch len(active) {
+	case 0:
+		return ""
+	case 1:
+		return active[0].Level
+	}
+	t.Fatalf("Expected at most one active alert, got %v", active)
+	return ""
+}
+
+// Test case for suppressing repeats while an alert fires and re-firing after a resolve
+func TestAlertCooldownAndRefire(t *testing.T) {
+	alerting, recorder, collect := newRecordedAlerting(t)
+	alerting.SetCooldown(time.Hour)
+	const (
+		W = monitoring.AlertLevelWarning
+		C = monitoring.AlertLevelCritical
+		R = monitoring.AlertLevelResolved
+	)
+
+	collect(0, 75)
+	collect(time.Second, 80) // still firing, no repeat
+	collect(2*time.Second, 50)
+	if level := activeLevel(t, alerting); level != "" {
+		t.Errorf("Expected the alert to be resolved, still active at %s", level)
+	}
+
+	// A new trigger after the resolve alerts even within the cooldown
+	collect(3*time.Second, 75)
+	if level := activeLevel(t, alerting); level != W {
+		t.Errorf("Expected the re-triggered warning to be active, got %q", level)
+	}
+
+	// Flapping between critical and warning notifies once per cooldown but tracks the level
+	collect(4*time.Second, 95)
+	collect(5*time.Second, 75)
+	if level := activeLevel(t, alerting); level != W {
+		t.Errorf("Expected the alert to drop to warning, got %q", level)
+	}
+	collect(6*time.Second, 95)
+	if level := activeLevel(t, alerting); level != C {
+		t.Errorf("Expected the suppressed return to critical to be tracked, got %q", level)
+	}
+	collect(time.Hour, 75)
+	collect(2*time.Hour, 95)
+
+	alerting.Drain()
+	if got, want := recorder.levels(), []monitoring.AlertLevel{W, R, W, C, C}; !equalLevels(got, want) {
+		t.Errorf("Expected notifications %v, got %v", want, got)
+	}
+	history := alerting.GetRecentAlerts(0)
+	if len(history) != 5 || !history[0].Resolved {
+		t.Errorf("Expected the history to mark the first warning resolved, got %+v", history)
+	}
+}
+
+// Test case for resolving an alert only once the metric falls below its clear level
+func TestAlertHysteresis(t *testing.T) {
+	alerting, recorder, collect := newRecordedAlerting(t)
+	alerting.ConfigureThresholds(monitoring.MetricTypeCPUUsage, 70, 90, 65, 85)
+
+	collect(0, 72)
+	collect(time.Second, 67)
+	if level := activeLevel(t, alerting); level != monitoring.AlertLevelWarning {
+		t.Errorf("Expected the warning to hold above its clear level, got %q", level)
+	}
+	collect(2*time.Second, 64)
+	if level := activeLevel(t, alerting); level != "" {
+		t.Errorf("Expected the warning to resolve below its clear level, got %q", level)
+	}
+
+	collect(3*time.Second, 95)
+	collect(4*time.Second, 87)
+	if level := activeLevel(t, alerting); level != monitoring.AlertLevelCritical {
+		t.Errorf("Expected the critical alert to hold above its clear level, got %q", level)
+	}
+	collect(5*time.Second, 80)
+	if level := activeLevel(t, alerting); level != monitoring.AlertLevelWarning {
+		t.Errorf("Expected the alert to drop to warning below the critical clear level, got %q", level)
+	}
+
+	alerting.Drain()
+	want := []monitoring.AlertLevel{monitoring.AlertLevelWarning, monitoring.AlertLevelResolved, monitoring.AlertLevelCritical}
+	if got := recorder.levels(); !equalLevels(got, want) {
+		t.Errorf("Expected notifications %v, got %v", want, got)
+	}
+}
+
+// Test case for escalating a persisting warning and routing it by level
+func TestAlertEscalation(t *testing.T) {
+	alerting, recorder, collect := newRecordedAlerting(t)
+	oncall := &recordingNotifier{}
+	alerting.AddNotifier(monitoring.NewLevelNotifier(oncall, monitoring.AlertLevelCritical))
+	alerting.SetEscalation(10 * time.Minute)
+
+	collect(0, 75)
+	collect(5*time.Minute, 75)
+	if level := activeLevel(t, alerting); level != monitoring.AlertLevelWarning {
+		t.Errorf("Expected no escalation before the escalation time, got %q", level)
+	}
+	collect(11*time.Minute, 75)
+	active := alerting.GetActiveAlerts()
+	if len(active) != 1 || active[0].Level != monitoring.AlertLevelCritical || !active[0].Escalated {
+		t.Errorf("Expected the warning to escalate to critical, got %+v", active)
+	}
+	collect(12*time.Minute, 75) // escalated alerts stay critical
+	collect(13*time.Minute, 50)
+
+	alerting.Drain()
+	want := []monitoring.AlertLevel{monitoring.AlertLevelWarning, monitoring.AlertLevelCritical, monitoring.AlertLevelResolved}
+	if got := recorder.levels(); !equalLevels(got, want) {
+		t.Errorf("Expected notifications %v, got %v", want, got)
+	}
+	if got := oncall.levels(); !equalLevels(got, []monitoring.AlertLevel{monitoring.AlertLevelCritical}) {
+		t.Errorf("Expected only the escalation to be routed to the critical notifier, got %v", got)
+	}
+}
@@ -1,11 +1,16 @@
 package monitoring
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,138 +22,482 @@ import (
 
 // MetricsData stores all the metrics
 type MetricsData struct {
-	CPUUsage     []float64            `json:"cpu_usage"`
-	MemoryUsage  uint64               `json:"memory_usage"`
-	DiskUsage    uint64               `json:"disk_usage"`
-	NetworkStats []net.IOCountersStat `json:"network_stats"`
-	Timestamp    time.Time            `json:"timestamp"`
+	CPUUsage          []float64            `json:"cpu_usage"`
+	MemoryUsage       uint64               `json:"memory_usage"`
+	MemoryUsedPercent float64              `json:"memory_used_percent"`
+	DiskUsage         map[string]uint64    `json:"disk_usage"`        // used bytes keyed by mountpoint
+	DiskUsedPercent   map[string]float64   `json:"disk_used_percent"` // keyed by mountpoint
+	NetworkStats      []net.IOCountersStat `json:"network_stats"`
+	// NetworkThroughput is the per-interface rate since the previous network sample
+	NetworkThroughput []NetworkThroughput `json:"network_throughput,omitempty"`
+	Timestamp         time.Time           `json:"timestamp"`
 }
 
-// MetricsCollector collects and stores system performance metrics
+// NetworkThroughput stores the send and receive rates of a network interface
+type NetworkThroughput struct {
+	Name            string  `json:"name"`
+	BytesSentPerSec float64 `json:"bytes_sent_per_sec"`
+	BytesRecvPerSec float64 `json:"bytes_recv_per_sec"`
+}
+
+// CollectorOptions selects which metrics are collected and how often. Every metric is
+// collected unless disabled, so options set only for DiskPaths or Alerting still collect
+// everything. A zero interval collects the metric on every tick; a longer interval carries
+// the previous value forward in samples taken in between. DiskPaths lists the mountpoints
+// whose usage is collected and defaults to "/". Push, when set, also sends samples to a
+// remote endpoint. Alerting, when set, receives the CPU, memory, and disk usage
+// percentages of every collected sample.
+type CollectorOptions struct {
+	DisableCPU      bool
+	DisableMemory   bool
+	DisableDisk     bool
+	DisableNetwork  bool
+	CPUInterval     time.Duration
+	MemoryInterval  time.Duration
+	DiskInterval    time.Duration
+	NetworkInterval time.Duration
+	DiskPaths       []string
+	Push            *PushTarget
+	Alerting        *AlertingSystem
+}
+
+// DefaultCollectorOptions collects every metric on every tick
+func DefaultCollectorOptions() CollectorOptions {
+	return CollectorOptions{
+		DiskPaths: []string{"/"},
+	}
+}
+
+var (
+	// ErrUnknownMetric is returned by Aggregate for an unsupported metric name
+	ErrUnknownMetric = errors.New("unknown metric")
+	// ErrNoMetricsData is returned by Aggregate when no samples fall within the window
+	ErrNoMetricsData = errors.New("no metrics data in window")
+)
+
+// MetricsCollector collects and stores system performance metrics. Samples are kept in
+// a fixed-size ring buffer of dataLimit entries so appends are O(1) and memory is bounded.
 type MetricsCollector struct {
-	data       []MetricsData
-	dataLock   sync.Mutex
-	interval   time.Duration
-	dataLimit  int
-	stopSignal chan struct{}
+	data        []MetricsData // ring buffer storage
+	head        int           // index of the oldest sample
+	count       int           // number of samples stored
+	dataLock    sync.Mutex
+	interval    time.Duration
+	dataLimit   int
+	runLock     sync.Mutex
+	runCtx      context.Context    // context of the running collection loop
+	cancel      context.CancelFunc // stops the running collection loop
+	done        chan struct{}      // closed when the collection loop exits
+	options     CollectorOptions
+	last        MetricsData
+	lastCollect map[string]time.Time
 }
 
-// NewMetricsCollector creates a new MetricsCollector
-func NewMetricsCollector(interval time.Duration, dataLimit int) *MetricsCollector {
+// NewMetricsCollector creates a new MetricsCollector. Options are optional; without them
+// every metric is collected on every tick.
+func NewMetricsCollector(interval time.Duration, dataLimit int, opts ...CollectorOptions) *MetricsCollector {
+	options := DefaultCollectorOptions()
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	if len(options.DiskPaths) == 0 {
+		options.DiskPaths = []string{"/"}
+	}
+	if dataLimit < 1 {
+		dataLimit = 1
+	}
 	return &MetricsCollector{
-		data:       make([]MetricsData, 0),
-		interval:   interval,
-		dataLimit:  dataLimit,
-		stopSignal: make(chan struct{}),
+		data:        make([]MetricsData, dataLimit),
+		interval:    interval,
+		dataLimit:   dataLimit,
+		options:     options,
+		lastCollect: make(map[string]time.Time),
+	}
+}
+
+// due reports whether a metric is enabled and its sampling interval has elapsed
+func (mc *MetricsCollector) due(metric string, enabled bool, interval time.Duration, now time.Time) bool {
+	if !enabled {
+		return false
+	}
+	last, ok := mc.lastCollect[metric]
+	if ok && interval > 0 && now.Sub(last) < interval {
+		return false
 	}
+	mc.lastCollect[metric] = now
+	return true
 }
 
-// Start begins the metric collection process
-func (mc *MetricsCollector) Start() {
-	ticker := time.NewTicker(mc.interval)
+// Start begins the metric collection process. Collection runs until ctx is cancelled or
+// Stop is called, after which the collector can be started again with a fresh context.
+// Calling Start while the collector is already running has no effect; if the running
+// loop's context was cancelled, Start waits for it to exit and starts a new one.
+func (mc *MetricsCollector) Start(ctx context.Context) {
+	mc.runLock.Lock()
+	defer mc.runLock.Unlock()
+
+	if mc.done != nil {
+		select {
+		case <-mc.done:
+		default:
+			if mc.runCtx.Err() == nil {
+				return
+			}
+			<-mc.done
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	mc.runCtx = ctx
+	mc.cancel = cancel
+	mc.done = done
+
+	var wg sync.WaitGroup
+	if mc.options.Push != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mc.pushLoop(ctx, *mc.options.Push)
+		}()
+	}
+
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(mc.interval)
+		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				mc.collect()
-			case <-mc.stopSignal:
-				ticker.Stop()
+				mc.collect(ctx)
+			case <-ctx.Done():
 				return
 			}
 		}
 	}()
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
 }
 
-// Stop stops the metric collection process
+// Stop stops the metric collection process, cancelling any in-progress collection,
+// and waits for the collection and push loops to exit
 func (mc *MetricsCollector) Stop() {
-	close(mc.stopSignal)
-}
+	mc.runLock.Lock()
+	cancel, done := mc.cancel, mc.done
+	mc.runLock.Unlock()
 
-// collect collects system metrics and stores them in the MetricsCollector
-func (mc *MetricsCollector) collect() {
-	cpuUsage, err := mc.collectCPUUsage()
-	if err != nil {
-		log.Printf("Error collecting CPU usage: %v", err)
+	if cancel == nil {
 		return
 	}
+	cancel()
+	<-done
+}
 
-	memUsage, err := mc.collectMemoryUsage()
-	if err != nil {
-		log.Printf("Error collecting memory usage: %v", err)
-		return
+// collect collects the enabled system metrics and stores them in the MetricsCollector
+func (mc *MetricsCollector) collect(ctx context.Context) {
+	now := time.Now()
+	// Metrics not due this tick keep their previous value
+	sample := mc.last
+	sample.Timestamp = now
+	var collected []string
+
+	if mc.due("cpu", !mc.options.DisableCPU, mc.options.CPUInterval, now) {
+		cpuUsage, err := mc.collectCPUUsage(ctx)
+		if err != nil {
+			log.Printf("Error collecting CPU usage: %v", err)
+			return
+		}
+		sample.CPUUsage = cpuUsage
+		collected = append(collected, "cpu")
 	}
 
-	diskUsage, err := mc.collectDiskUsage()
-	if err != nil {
-		log.Printf("Error collecting disk usage: %v", err)
+	if mc.due("memory", !mc.options.DisableMemory, mc.options.MemoryInterval, now) {
+		memUsage, memPercent, err := mc.collectMemoryUsage(ctx)
+		if err != nil {
+			log.Printf("Error collecting memory usage: %v", err)
+			return
+		}
+		sample.MemoryUsage = memUsage
+		sample.MemoryUsedPercent = memPercent
+		collected = append(collected, "memory")
+	}
+
+	if mc.due("disk", !mc.options.DisableDisk, mc.options.DiskInterval, now) {
+		sample.DiskUsage, sample.DiskUsedPercent = mc.collectDiskUsage(ctx)
+		collected = append(collected, "disk")
+	}
+
+	prevNetworkAt, hasPrevNetwork := mc.lastCollect["network"]
+	if mc.due("network", !mc.options.DisableNetwork, mc.options.NetworkInterval, now) {
+		netStats, err := mc.collectNetworkStats(ctx)
+		if err != nil {
+			log.Printf("Error collecting network stats: %v", err)
+			return
+		}
+		sample.NetworkThroughput = nil
+		if hasPrevNetwork {
+			sample.NetworkThroughput = networkThroughput(mc.last.NetworkStats, netStats, now.Sub(prevNetworkAt))
+		}
+		sample.NetworkStats = netStats
+	}
+
+	mc.last = sample
+
+	mc.dataLock.Lock()
+	mc.appendLocked(sample)
+	mc.dataLock.Unlock()
+
+	if mc.options.Alerting != nil {
+		mc.reportToAlerting(sample, collected)
+	}
+}
+
+// reportToAlerting converts the freshly collected metrics of a sample into percentages
+// and passes them to the alerting system. Values carried forward from earlier samples
+// are skipped so they don't raise the same alert again.
+func (mc *MetricsCollector) reportToAlerting(sample MetricsData, collected []string) {
+	for _, metric := range collected {
+		switch metric {
+		case "cpu":
+			if len(sample.CPUUsage) == 0 {
+				continue
+			}
+			var sum float64
+			for _, pct := range sample.CPUUsage {
+				sum += pct
+			}
+			mc.options.Alerting.CollectMetric(Metric{
+				Type:      MetricTypeCPUUsage,
+				Value:     sum / float64(len(sample.CPUUsage)),
+				Timestamp: sample.Timestamp,
+			})
+		case "memory":
+			mc.options.Alerting.CollectMetric(Metric{
+				Type:      MetricTypeMemoryUsage,
+				Value:     sample.MemoryUsedPercent,
+				Timestamp: sample.Timestamp,
+			})
+		case "disk":
+			// All mounts share one alert, so report the fullest; sending each mount in turn
+			// would fire and resolve the alert on every tick when only some are full
+			if len(sample.DiskUsedPercent) == 0 {
+				continue
+			}
+			var fullest float64
+			for _, pct := range sample.DiskUsedPercent {
+				fullest = math.Max(fullest, pct)
+			}
+			mc.options.Alerting.CollectMetric(Metric{
+				Type:      MetricTypeDiskSpace,
+				Value:     fullest,
+				Timestamp: sample.Timestamp,
+			})
+		}
+	}
+}
+
+// appendLocked stores a sample, overwriting the oldest once the buffer is full; dataLock must be held
+func (mc *MetricsCollector) appendLocked(sample MetricsData) {
+	if mc.count < len(mc.data) {
+		mc.data[(mc.head+mc.count)%len(mc.data)] = sample
+		mc.count++
 		return
 	}
+	mc.data[mc.head] = sample
+	mc.head = (mc.head + 1) % len(mc.data)
+}
+
+// snapshotLocked returns the stored samples in chronological order; dataLock must be held
+func (mc *MetricsCollector) snapshotLocked() []MetricsData {
+	samples := make([]MetricsData, mc.count)
+	for i := 0; i < mc.count; i++ {
+		samples[i] = mc.data[(mc.head+i)%len(mc.data)]
+	}
+	return samples
+}
 
-	netStats, err := mc.collectNetworkStats()
+// Aggregate computes the minimum, maximum, average, and 95th percentile of a metric over
+// the samples collected within window. A window longer than the retained history uses the
+// samples that are available, and a non-positive window covers all retained samples.
+// Supported metrics are "cpu", "memory", "disk" (total across mountpoints),
+// "disk:<mountpoint>", "network_sent", and "network_received".
+func (mc *MetricsCollector) Aggregate(metric string, window time.Duration) (min, max, avg, p95 float64, err error) {
+	extract, err := metricExtractor(metric)
 	if err != nil {
-		log.Printf("Error collecting network stats: %v", err)
-		return
+		return 0, 0, 0, 0, err
 	}
 
+	cutoff := time.Now().Add(-window)
+	var values []float64
+
 	mc.dataLock.Lock()
-	defer mc.dataLock.Unlock()
+	for i := 0; i < mc.count; i++ {
+		sample := mc.data[(mc.head+i)%len(mc.data)]
+		if window > 0 && sample.Timestamp.Before(cutoff) {
+			continue
+		}
+		if value, ok := extract(sample); ok {
+			values = append(values, value)
+		}
+	}
+	mc.dataLock.Unlock()
 
-	// Limit the number of stored data points
-	if len(mc.data) >= mc.dataLimit {
-		mc.data = mc.data[1:]
+	if len(values) == 0 {
+		return 0, 0, 0, 0, ErrNoMetricsData
 	}
 
-	mc.data = append(mc.data, MetricsData{
-		CPUUsage:     cpuUsage,
-		MemoryUsage:  memUsage,
-		DiskUsage:    diskUsage,
-		NetworkStats: netStats,
-		Timestamp:    time.Now(),
-	})
+	sort.Float64s(values)
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	// Nearest-rank percentile
+	rank := int(math.Ceil(0.95*float64(len(values)))) - 1
+	return values[0], values[len(values)-1], sum / float64(len(values)), values[rank], nil
+}
+
+// metricExtractor returns a function reading the named metric from a sample
+func metricExtractor(metric string) (func(MetricsData) (float64, bool), error) {
+	switch {
+	case metric == "cpu":
+		return func(d MetricsData) (float64, bool) {
+			if len(d.CPUUsage) == 0 {
+				return 0, false
+			}
+			var sum float64
+			for _, pct := range d.CPUUsage {
+				sum += pct
+			}
+			return sum / float64(len(d.CPUUsage)), true
+		}, nil
+	case metric == "memory":
+		return func(d MetricsData) (float64, bool) {
+			return float64(d.MemoryUsage), true
+		}, nil
+	case metric == "disk":
+		return func(d MetricsData) (float64, bool) {
+			if len(d.DiskUsage) == 0 {
+				return 0, false
+			}
+			var total uint64
+			for _, used := range d.DiskUsage {
+				total += used
+			}
+			return float64(total), true
+		}, nil
+	case strings.HasPrefix(metric, "disk:"):
+		mountpoint := strings.TrimPrefix(metric, "disk:")
+		return func(d MetricsData) (float64, bool) {
+			used, ok := d.DiskUsage[mountpoint]
+			return float64(used), ok
+		}, nil
+	case metric == "network_sent", metric == "network_received":
+		return func(d MetricsData) (float64, bool) {
+			if len(d.NetworkStats) == 0 {
+				return 0, false
+			}
+			var total uint64
+			for _, stat := range d.NetworkStats {
+				if metric == "network_sent" {
+					total += stat.BytesSent
+				} else {
+					total += stat.BytesRecv
+				}
+			}
+			return float64(total), true
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownMetric, metric)
 }
 
 // collectCPUUsage collects CPU usage data
-func (mc *MetricsCollector) collectCPUUsage() ([]float64, error) {
-	percentages, err := cpu.Percent(0, false)
+func (mc *MetricsCollector) collectCPUUsage(ctx context.Context) ([]float64, error) {
+	percentages, err := cpu.PercentWithContext(ctx, 0, false)
 	if err != nil {
 		return nil, err
 	}
 	return percentages, nil
 }
 
-// collectMemoryUsage collects memory usage data
-func (mc *MetricsCollector) collectMemoryUsage() (uint64, error) {
-	v, err := mem.VirtualMemory()
+// collectMemoryUsage collects used memory in bytes and as a percentage of the total
+func (mc *MetricsCollector) collectMemoryUsage(ctx context.Context) (uint64, float64, error) {
+	v, err := mem.VirtualMemoryWithContext(ctx)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
-	return v.Used, nil
+	return v.Used, v.UsedPercent, nil
 }
 
-// collectDiskUsage collects disk usage data
-func (mc *MetricsCollector) collectDiskUsage() (uint64, error) {
-	d, err := disk.Usage("/")
-	if err != nil {
-		return 0, err
+// collectDiskUsage collects disk usage data for each configured path. A path that
+// fails is logged and skipped so the remaining paths are still reported.
+func (mc *MetricsCollector) collectDiskUsage(ctx context.Context) (map[string]uint64, map[string]float64) {
+	usage := make(map[string]uint64, len(mc.options.DiskPaths))
+	percent := make(map[string]float64, len(mc.options.DiskPaths))
+	for _, path := range mc.options.DiskPaths {
+		d, err := disk.UsageWithContext(ctx, path)
+		if err != nil {
+			log.Printf("Error collecting disk usage for %s: %v", path, err)
+			continue
+		}
+		usage[path] = d.Used
+		percent[path] = d.UsedPercent
 	}
-	return d.Used, nil
+	return usage, percent
 }
 
 // collectNetworkStats collects network usage data
-func (mc *MetricsCollector) collectNetworkStats() ([]net.IOCountersStat, error) {
-	stats, err := net.IOCounters(false)
+func (mc *MetricsCollector) collectNetworkStats(ctx context.Context) ([]net.IOCountersStat, error) {
+	stats, err := net.IOCountersWithContext(ctx, false)
 	if err != nil {
 		return nil, err
 	}
 	return stats, nil
 }
 
+// networkThroughput computes per-interface rates between two counter samples taken elapsed apart
+func networkThroughput(prev, cur []net.IOCountersStat, elapsed time.Duration) []NetworkThroughput {
+	if elapsed <= 0 {
+		return nil
+	}
+	prevByName := make(map[string]net.IOCountersStat, len(prev))
+	for _, stat := range prev {
+		prevByName[stat.Name] = stat
+	}
+
+	rates := make([]NetworkThroughput, 0, len(cur))
+	for _, stat := range cur {
+		before, ok := prevByName[stat.Name]
+		if !ok {
+			continue
+		}
+		rates = append(rates, NetworkThroughput{
+			Name:            stat.Name,
+			BytesSentPerSec: float64(counterDelta(before.BytesSent, stat.BytesSent)) / elapsed.Seconds(),
+			BytesRecvPerSec: float64(counterDelta(before.BytesRecv, stat.BytesRecv)) / elapsed.Seconds(),
+		})
+	}
+	return rates
+}
+
+// counterDelta returns the increase of a cumulative counter. A counter that went backwards
+// was reset (e.g. after a reboot), so its current value is the increase since the reset.
+func counterDelta(prev, cur uint64) uint64 {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
+
 // ServeMetrics serves the collected metrics as JSON over HTTP
 func (mc *MetricsCollector) ServeMetrics(w http.ResponseWriter, r *http.Request) {
 	mc.dataLock.Lock()
 	defer mc.dataLock.Unlock()
 
-	jsonData, err := json.Marshal(mc.data)
+	jsonData, err := json.Marshal(mc.snapshotLocked())
 	if err != nil {
 		http.Error(w, "Failed to serialize data", http.StatusInternalServerError)
 		return
@@ -158,12 +507,71 @@ func (mc *MetricsCollector) ServeMetrics(w http.ResponseWriter, r *http.Request)
 	w.Write(jsonData)
 }
 
+// ServePrometheus serves the latest collected metrics in the Prometheus text exposition format
+func (mc *MetricsCollector) ServePrometheus(w http.ResponseWriter, r *http.Request) {
+	latest, ok := mc.latest()
+	if !ok {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		return
+	}
+
+	var b strings.Builder
+
+	writePrometheusHeader(&b, "db_cpu_usage_percent", "CPU usage in percent.", "gauge")
+	for i, pct := range latest.CPUUsage {
+		cpuLabel := fmt.Sprintf("%d", i)
+		if len(latest.CPUUsage) == 1 {
+			cpuLabel = "total"
+		}
+		fmt.Fprintf(&b, "db_cpu_usage_percent{cpu=\"%s\"} %g\n", cpuLabel, pct)
+	}
+
+	writePrometheusHeader(&b, "db_memory_used_bytes", "Used virtual memory in bytes.", "gauge")
+	fmt.Fprintf(&b, "db_memory_used_bytes %d\n", latest.MemoryUsage)
+
+	writePrometheusHeader(&b, "db_disk_used_bytes", "Used disk space in bytes per mountpoint.", "gauge")
+	mountpoints := make([]string, 0, len(latest.DiskUsage))
+	for mountpoint := range latest.DiskUsage {
+		mountpoints = append(mountpoints, mountpoint)
+	}
+	sort.Strings(mountpoints)
+	for _, mountpoint := range mountpoints {
+		fmt.Fprintf(&b, "db_disk_used_bytes{mountpoint=\"%s\"} %d\n", escapePrometheusLabel(mountpoint), latest.DiskUsage[mountpoint])
+	}
+
+	writePrometheusHeader(&b, "db_network_bytes_sent_total", "Bytes sent per network interface.", "counter")
+	for _, stat := range latest.NetworkStats {
+		fmt.Fprintf(&b, "db_network_bytes_sent_total{interface=\"%s\"} %d\n", escapePrometheusLabel(stat.Name), stat.BytesSent)
+	}
+	writePrometheusHeader(&b, "db_network_bytes_received_total", "Bytes received per network interface.", "counter")
+	for _, stat := range latest.NetworkStats {
+		fmt.Fprintf(&b, "db_network_bytes_received_total{interface=\"%s\"} %d\n", escapePrometheusLabel(stat.Name), stat.BytesRecv)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
+
+// writePrometheusHeader writes the HELP and TYPE lines for a metric family
+func writePrometheusHeader(b *strings.Builder, name, help, metricType string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, metricType)
+}
+
+// prometheusLabelEscaper escapes label values as required by the exposition format
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapePrometheusLabel escapes a label value for the exposition format
+func escapePrometheusLabel(value string) string {
+	return prometheusLabelEscaper.Replace(value)
+}
+
 // SaveMetricsToFile saves the collected metrics to a file
 func (mc *MetricsCollector) SaveMetricsToFile(filePath string) error {
 	mc.dataLock.Lock()
 	defer mc.dataLock.Unlock()
 
-	jsonData, err := json.Marshal(mc.data)
+	jsonData, err := json.Marshal(mc.snapshotLocked())
 	if err != nil {
 		return fmt.Errorf("failed to serialize data: %w", err)
 	}
@@ -186,17 +594,25 @@ func (mc *MetricsCollector) LoadMetricsFromFile(filePath string) error {
 		return fmt.Errorf("failed to read file: %w", err)
 	}
 
-	err = json.Unmarshal(jsonData, &mc.data)
+	var samples []MetricsData
+	err = json.Unmarshal(jsonData, &samples)
 	if err != nil {
 		return fmt.Errorf("failed to deserialize data: %w", err)
 	}
 
+	// Replace the buffer contents, keeping only the newest dataLimit samples
+	mc.head, mc.count = 0, 0
+	for _, sample := range samples {
+		mc.appendLocked(sample)
+	}
+
 	return nil
 }
 
 // StartHTTPServer starts an HTTP server to expose metrics
 func StartHTTPServer(mc *MetricsCollector, port int) {
 	http.HandleFunc("/metrics", mc.ServeMetrics)
+	http.HandleFunc("/metrics/prometheus", mc.ServePrometheus)
 	log.Printf("Starting HTTP server on port %d", port)
 	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil); err != nil {
 		log.Fatalf("Failed to start HTTP server: %v", err)
@@ -210,7 +626,7 @@ func main() {
 	dataLimit := 100
 
 	collector := NewMetricsCollector(interval, dataLimit)
-	collector.Start()
+	collector.Start(context.Background())
 
 	// Start the HTTP server for serving metrics on port 8080
 	go StartHTTPServer(collector, 8080)
@@ -0,0 +1,50 @@
+package monitoring_test
+
+import (
+	"context"
+	"encoding/json"
+	"management_tools/monitoring"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Test case for stopping and restarting the metrics collector without panicking
+func TestMetricsCollectorRestart(t *testing.T) {
+	collector := monitoring.NewMetricsCollector(10*time.Millisecond, 100)
+
+	collector.Start(context.Background())
+	time.Sleep(50 * time.Millisecond)
+	collector.Stop()
+
+	// Restarting after Stop must not panic on a closed channel
+	collector.Start(context.Background())
+	time.Sleep(50 * time.Millisecond)
+	collector.Stop()
+	collector.Stop() // Stopping twice is a no-op
+
+	// A cancelled context also stops collection, and starting again right away waits for
+	// the old loop to exit rather than leaving the collector stopped
+	ctx, cancel := context.WithCancel(context.Background())
+	collector.Start(ctx)
+	cancel()
+	restarted := time.Now()
+	collector.Start(context.Background())
+	time.Sleep(50 * time.Millisecond)
+	collector.Stop()
+
+	rec := httptest.NewRecorder()
+	collector.ServeMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	var samples []monitoring.MetricsData
+	if err := json.Unmarshal(rec.Body.Bytes(), &samples); err != nil {
+		t.Fatalf("Failed to decode metrics: %v", err)
+	}
+	if len(samples) == 0 {
+		t.Fatalf("Expected samples to be collected across restarts, got none")
+	}
+	if last := samples[len(samples)-1].Timestamp; !last.After(restarted) {
+		t.Errorf("Expected a sample collected after the restart, the last is from %v", last)
+	}
+}
@@ -0,0 +1,136 @@
+package monitoring
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultPushInterval   = 10 * time.Second
+	defaultPushRetries    = 3
+	defaultPushBackoff    = 500 * time.Millisecond
+	defaultPushTimeout    = 5 * time.Second
+	maxPushBackoff        = 30 * time.Second
+	pushErrorBodyMaxBytes = 512
+)
+
+// PushTarget configures pushing the latest sample to a remote ingest endpoint as JSON
+type PushTarget struct {
+	URL        string
+	Interval   time.Duration // defaults to 10s
+	AuthHeader string        // sent as the Authorization header when set
+	MaxRetries int           // retries after the first attempt, defaults to 3
+	Backoff    time.Duration // initial retry delay, doubled on each retry
+	HTTPClient *http.Client  // defaults to a client with a 5s timeout
+}
+
+// pushLoop pushes the latest sample every target interval until ctx is cancelled. It runs
+// separately from the collection loop so a slow or failing endpoint never delays collection.
+func (mc *MetricsCollector) pushLoop(ctx context.Context, target PushTarget) {
+	interval := target.Interval
+	if interval <= 0 {
+		interval = defaultPushInterval
+	}
+	client := target.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: defaultPushTimeout}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastPushed time.Time
+	for {
+		select {
+		case <-ticker.C:
+			sample, ok := mc.latest()
+			if !ok || !sample.Timestamp.After(lastPushed) {
+				continue
+			}
+			if err := pushWithRetry(ctx, client, target, sample); err != nil {
+				log.Printf("Error pushing metrics to %s: %v", target.URL, err)
+				continue
+			}
+			lastPushed = sample.Timestamp
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// latest returns the most recently collected sample
+func (mc *MetricsCollector) latest() (MetricsData, bool) {
+	mc.dataLock.Lock()
+	defer mc.dataLock.Unlock()
+	if mc.count == 0 {
+		return MetricsData{}, false
+	}
+	return mc.data[(mc.head+mc.count-1)%len(mc.data)], true
+}
+
+// pushWithRetry posts a sample, retrying failures with exponential backoff
+func pushWithRetry(ctx context.Context, client *http.Client, target PushTarget, sample MetricsData) error {
+	body, err := json.Marshal(sample)
+	if err != nil {
+		return fmt.Errorf("failed to serialize data: %w", err)
+	}
+
+	retries := target.MaxRetries
+	if retries <= 0 {
+		retries = defaultPushRetries
+	}
+	backoff := target.Backoff
+	if backoff <= 0 {
+		backoff = defaultPushBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = pushSample(ctx, client, target, body)
+		if err == nil || attempt >= retries {
+			return err
+		}
+		log.Printf("Push to %s failed (attempt %d/%d): %v", target.URL, attempt+1, retries+1, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+		if backoff > maxPushBackoff {
+			backoff = maxPushBackoff
+		}
+	}
+}
+
+// pushSample performs a single POST of an encoded sample
+func pushSample(ctx context.Context, client *http.Client, target PushTarget, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if target.AuthHeader != "" {
+		req.Header.Set("Authorization", target.AuthHeader)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, pushErrorBodyMaxBytes))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,246 @@
+package monitoring
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultWebhookTimeout bounds webhook requests when no HTTP client is configured
+const defaultWebhookTimeout = 5 * time.Second
+
+// Notifier delivers alerts to an external destination
+type Notifier interface {
+	Notify(alert Alert) error
+}
+
+// EmailConfig holds SMTP settings. LevelRecipients routes alerts of a level to their own
+// recipient list; levels without an entry go to To.
+type EmailConfig struct {
+	SMTPServer      string
+	Port            int
+	Username        string
+	Password        string
+	From            string
+	To              []string
+	LevelRecipients map[AlertLevel][]string
+}
+
+// recipients returns the recipient list for an alert level
+func (c EmailConfig) recipients(level AlertLevel) []string {
+	if to, ok := c.LevelRecipients[level]; ok && len(to) > 0 {
+		return to
+	}
+	return c.To
+}
+
+// EmailNotifier sends alerts as plain-text email over SMTP
+type EmailNotifier struct {
+	config EmailConfig
+}
+
+// NewEmailNotifier creates an EmailNotifier for the given SMTP settings
+func NewEmailNotifier(config EmailConfig) *EmailNotifier {
+	return &EmailNotifier{config: config}
+}
+
+// Notify sends an alert email to the recipients configured for its level
+func (n *EmailNotifier) Notify(alert Alert) error {
+	to := n.config.recipients(alert.Level)
+	message := fmt.Sprintf(
+		"To: %s\r\nSubject: %s Alert: %s\r\n\r\n%s occurred at %s with the message: %s\r\n",
+		to,
+		alert.Level,
+		alert.Metric,
+		alert.Level,
+		alert.Timestamp.Format(time.RFC822),
+		alert.Message,
+	)
+
+	auth := smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.SMTPServer)
+
+	err := smtp.SendMail(
+		fmt.Sprintf("%s:%d", n.config.SMTPServer, n.config.Port),
+		auth,
+		n.config.From,
+		to,
+		[]byte(message),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to send alert email: %w", err)
+	}
+	log.Printf("Alert email sent for %s alert on %s", alert.Level, alert.Metric)
+	return nil
+}
+
+// LevelNotifier forwards only alerts of the given levels to another notifier, so different
+// levels can be routed to different destinations
+type LevelNotifier struct {
+	Notifier Notifier
+	Levels   []AlertLevel
+}
+
+// NewLevelNotifier routes alerts of levels to notifier
+func NewLevelNotifier(notifier Notifier, levels ...AlertLevel) *LevelNotifier {
+	return &LevelNotifier{Notifier: notifier, Levels: levels}
+}
+
+// Notify forwards the alert if its level is routed to this notifier
+func (n *LevelNotifier) Notify(alert Alert) error {
+	for _, level := range n.Levels {
+		if level == alert.Level {
+			return n.Notifier.Notify(alert)
+		}
+	}
+	return nil
+}
+
+// WebhookNotifier posts alerts as JSON to a URL. The payload carries a "text" field so it
+// can be used directly with Slack incoming webhooks.
+type WebhookNotifier struct {
+	URL        string
+	Headers    map[string]string
+	HTTPClient *http.Client
+}
+
+// NewWebhookNotifier creates a WebhookNotifier posting to url
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url}
+}
+
+// webhookPayload is the JSON body sent by WebhookNotifier
+type webhookPayload struct {
+	Text string `json:"text"`
+	Alert
+}
+
+// Notify posts an alert to the webhook URL
+func (n *WebhookNotifier) Notify(alert Alert) error {
+	body, err := json.Marshal(webhookPayload{
+		Text:  fmt.Sprintf("[%s] %s", alert.Level, alert.Message),
+		Alert: alert,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to serialize alert: %w", err)
+	}
+	return postJSON(n.HTTPClient, n.URL, n.Headers, body)
+}
+
+// postJSON posts a JSON body and treats any non-2xx response as an error
+func postJSON(client *http.Client, url string, headers map[string]string, body []byte) error {
+	if client == nil {
+		client = &http.Client{Timeout: defaultWebhookTimeout}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+// DefaultPagerDutyEventsURL is the PagerDuty Events API v2 endpoint
+const DefaultPagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutyNotifier sends alerts as PagerDuty Events API v2 events. Alerts trigger an
+// incident keyed by their metric type and a resolved alert closes it.
+type PagerDutyNotifier struct {
+	RoutingKey string
+	Source     string // defaults to the hostname
+	URL        string // defaults to DefaultPagerDutyEventsURL
+	HTTPClient *http.Client
+}
+
+// NewPagerDutyNotifier creates a PagerDutyNotifier for an integration routing key
+func NewPagerDutyNotifier(routingKey string) *PagerDutyNotifier {
+	return &PagerDutyNotifier{RoutingKey: routingKey}
+}
+
+// pagerDutyEvent is the Events API v2 request body
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+// pagerDutyPayload describes the triggering alert
+type pagerDutyPayload struct {
+	Summary   string `json:"summary"`
+	Source    string `json:"source"`
+	Severity  string `json:"severity"`
+	Timestamp string `json:"timestamp,omitempty"`
+	Component string `json:"component,omitempty"`
+}
+
+// pagerDutyDedupKey derives the incident key of a metric so its trigger and resolve events match
+func pagerDutyDedupKey(metric MetricType) string {
+	return "db-monitoring-" + strings.ToLower(string(metric))
+}
+
+// Notify triggers or resolves the PagerDuty incident for the alert's metric
+func (n *PagerDutyNotifier) Notify(alert Alert) error {
+	if n.RoutingKey == "" {
+		return fmt.Errorf("pagerduty routing key is not configured")
+	}
+
+	event := pagerDutyEvent{
+		RoutingKey: n.RoutingKey,
+		DedupKey:   pagerDutyDedupKey(alert.Metric),
+	}
+	if alert.Level == AlertLevelResolved {
+		event.EventAction = "resolve"
+	} else {
+		source := n.Source
+		if source == "" {
+			source, _ = os.Hostname()
+		}
+		severity := "warning"
+		if alert.Level == AlertLevelCritical {
+			severity = "critical"
+		}
+		event.EventAction = "trigger"
+		event.Payload = &pagerDutyPayload{
+			Summary:   alert.Message,
+			Source:    source,
+			Severity:  severity,
+			Timestamp: alert.Timestamp.Format(time.RFC3339),
+			Component: string(alert.Metric),
+		}
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to serialize event: %w", err)
+	}
+
+	url := n.URL
+	if url == "" {
+		url = DefaultPagerDutyEventsURL
+	}
+	return postJSON(n.HTTPClient, url, nil, body)
+}
@@ -0,0 +1,123 @@
+package monitoring_test
+
+import (
+	"encoding/json"
+	"errors"
+	"management_tools/monitoring"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failingNotifier counts its calls and fails every one
+type failingNotifier struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (n *failingNotifier) Notify(alert monitoring.Alert) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls++
+	return errors.New("notifier down")
+}
+
+// newEventServer starts a server decoding the JSON body of every request it receives
+func newEventServer(t *testing.T) (*httptest.Server, func() []map[string]interface{}) {
+	var mu sync.Mutex
+	var events []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []map[string]interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]map[string]interface{}(nil), events...)
+	}
+}
+
+// Test case for posting alerts to a webhook even when another notifier fails
+func TestWebhookNotifier(t *testing.T) {
+	server, received := newEventServer(t)
+	failing := &failingNotifier{}
+	alerting := monitoring.NewAlertingSystem(monitoring.EmailConfig{}, failing, monitoring.NewWebhookNotifier(server.URL))
+	defer alerting.Close()
+
+	alerting.CollectMetric(monitoring.Metric{Type: monitoring.MetricTypeMemoryUsage, Value: 80, Timestamp: time.Now()})
+	alerting.Drain()
+
+	if failing.calls != 1 {
+		t.Errorf("Expected the failing notifier to be called once, got %d", failing.calls)
+	}
+	events := received()
+	if len(events) != 1 {
+		t.Fatalf("Expected one webhook request, got %d", len(events))
+	}
+	if text, _ := events[0]["text"].(string); !strings.HasPrefix(text, "[WARNING] MEMORY_USAGE") {
+		t.Errorf("Expected a Slack-style text field, got %q", text)
+	}
+	if events[0]["metric"] != string(monitoring.MetricTypeMemoryUsage) {
+		t.Errorf("Expected the alert fields in the payload, got %v", events[0])
+	}
+
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such hook", http.StatusNotFound)
+	}))
+	defer rejecting.Close()
+	err := monitoring.NewWebhookNotifier(rejecting.URL).Notify(monitoring.Alert{Level: monitoring.AlertLevelWarning})
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected a non-2xx response to fail, got %v", err)
+	}
+}
+
+// Test case for triggering and resolving a PagerDuty incident under one dedup key
+func TestPagerDutyNotifier(t *testing.T) {
+	server, received := newEventServer(t)
+	pagerDuty := monitoring.NewPagerDutyNotifier("routing-key")
+	pagerDuty.URL = server.URL
+	pagerDuty.Source = "db-1"
+	alerting := monitoring.NewAlertingSystem(monitoring.EmailConfig{}, pagerDuty)
+	defer alerting.Close()
+
+	alerting.CollectMetric(monitoring.Metric{Type: monitoring.MetricTypeCPUUsage, Value: 95, Timestamp: time.Now()})
+	alerting.CollectMetric(monitoring.Metric{Type: monitoring.MetricTypeCPUUsage, Value: 10, Timestamp: time.Now()})
+	alerting.Drain()
+
+	events := received()
+	if len(events) != 2 {
+		t.Fatalf("Expected a trigger and a resolve event, got %v", events)
+	}
+	trigger, resolve := events[0], events[1]
+	if trigger["event_action"] != "trigger" || resolve["event_action"] != "resolve" {
+		t.Errorf("Expected trigger then resolve, got %v and %v", trigger["event_action"], resolve["event_action"])
+	}
+	if trigger["dedup_key"] != "db-monitoring-cpu_usage" || resolve["dedup_key"] != trigger["dedup_key"] {
+		t.Errorf("Expected both events keyed by the metric, got %v and %v", trigger["dedup_key"], resolve["dedup_key"])
+	}
+	if trigger["routing_key"] != "routing-key" {
+		t.Errorf("Expected the configured routing key, got %v", trigger["routing_key"])
+	}
+	payload, _ := trigger["payload"].(map[string]interface{})
+	if payload["severity"] != "critical" || payload["source"] != "db-1" {
+		t.Errorf("Expected a critical payload from db-1, got %v", payload)
+	}
+	if _, ok := resolve["payload"]; ok {
+		t.Errorf("Expected the resolve event without a payload, got %v", resolve)
+	}
+
+	if err := monitoring.NewPagerDutyNotifier("").Notify(monitoring.Alert{}); err == nil {
+		t.Errorf("Expected an error without a routing key")
+	}
+}
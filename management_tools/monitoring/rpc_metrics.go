@@ -0,0 +1,97 @@
+package monitoring
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RPCCallStats summarizes the calls of one RPC method that ended with one status code
+type RPCCallStats struct {
+	Method       string        `json:"method"`
+	Code         string        `json:"code"`
+	Count        uint64        `json:"count"`
+	TotalLatency time.Duration `json:"total_latency"`
+	MaxLatency   time.Duration `json:"max_latency"`
+}
+
+// rpcCallKey identifies the calls counted together
+type rpcCallKey struct {
+	method, code string
+}
+
+// RPCMetrics records the latency and outcome of RPCs, keyed by method and status code.
+// It satisfies the recorder interface of the RPC client interceptors.
+type RPCMetrics struct {
+	mu    sync.Mutex
+	calls map[rpcCallKey]*RPCCallStats
+}
+
+// NewRPCMetrics creates an empty RPCMetrics
+func NewRPCMetrics() *RPCMetrics {
+	return &RPCMetrics{calls: make(map[rpcCallKey]*RPCCallStats)}
+}
+
+// ObserveRPC records one finished call
+func (m *RPCMetrics) ObserveRPC(method, code string, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := rpcCallKey{method: method, code: code}
+	stats, ok := m.calls[key]
+	if !ok {
+		stats = &RPCCallStats{Method: method, Code: code}
+		m.calls[key] = stats
+	}
+	stats.Count++
+	stats.TotalLatency += latency
+	if latency > stats.MaxLatency {
+		stats.MaxLatency = latency
+	}
+}
+
+// Snapshot returns the recorded stats ordered by method and code
+func (m *RPCMetrics) Snapshot() []RPCCallStats {
+	m.mu.Lock()
+	snapshot := make([]RPCCallStats, 0, len(m.calls))
+	for _, stats := range m.calls {
+		snapshot = append(snapshot, *stats)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(snapshot, func(i, j int) bool {
+		if snapshot[i].Method != snapshot[j].Method {
+			return snapshot[i].Method < snapshot[j].Method
+		}
+		return snapshot[i].Code < snapshot[j].Code
+	})
+	return snapshot
+}
+
+// ServePrometheus serves the recorded RPC stats in the Prometheus text exposition format
+func (m *RPCMetrics) ServePrometheus(w http.ResponseWriter, r *http.Request) {
+	snapshot := m.Snapshot()
+	var b strings.Builder
+
+	writePrometheusHeader(&b, "db_rpc_client_calls_total", "Completed RPCs per method and status code.", "counter")
+	for _, stats := range snapshot {
+		fmt.Fprintf(&b, "db_rpc_client_calls_total{method=\"%s\",code=\"%s\"} %d\n",
+			escapePrometheusLabel(stats.Method), escapePrometheusLabel(stats.Code), stats.Count)
+	}
+	writePrometheusHeader(&b, "db_rpc_client_latency_seconds_sum", "Total latency of completed RPCs in seconds.", "counter")
+	for _, stats := range snapshot {
+		fmt.Fprintf(&b, "db_rpc_client_latency_seconds_sum{method=\"%s\",code=\"%s\"} %g\n",
+			escapePrometheusLabel(stats.Method), escapePrometheusLabel(stats.Code), stats.TotalLatency.Seconds())
+	}
+	writePrometheusHeader(&b, "db_rpc_client_latency_seconds_max", "Slowest completed RPC in seconds.", "gauge")
+	for _, stats := range snapshot {
+		fmt.Fprintf(&b, "db_rpc_client_latency_seconds_max{method=\"%s\",code=\"%s\"} %g\n",
+			escapePrometheusLabel(stats.Method), escapePrometheusLabel(stats.Code), stats.MaxLatency.Seconds())
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
@@ -0,0 +1,32 @@
+package monitoring_test
+
+import (
+	"management_tools/monitoring"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test case for recording RPC outcomes per method and status code
+func TestRPCMetrics(t *testing.T) {
+	metrics := monitoring.NewRPCMetrics()
+	metrics.ObserveRPC("/rpc.RPCService/UnaryCall", "OK", 10*time.Millisecond)
+	metrics.ObserveRPC("/rpc.RPCService/UnaryCall", "OK", 30*time.Millisecond)
+	metrics.ObserveRPC("/rpc.RPCService/UnaryCall", "Unavailable", 5*time.Millisecond)
+
+	stats := metrics.Snapshot()
+	if len(stats) != 2 {
+		t.Fatalf("Expected stats for 2 status codes, got %v", stats)
+	}
+	if stats[0].Code != "OK" || stats[0].Count != 2 || stats[0].TotalLatency != 40*time.Millisecond || stats[0].MaxLatency != 30*time.Millisecond {
+		t.Errorf("Unexpected stats for successful calls: %+v", stats[0])
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.ServePrometheus(rec, httptest.NewRequest(http.MethodGet, "/metrics/rpc", nil))
+	if !strings.Contains(rec.Body.String(), `db_rpc_client_calls_total{method="/rpc.RPCService/UnaryCall",code="Unavailable"} 1`) {
+		t.Errorf("Expected the failed call in the exposition output, got:\n%s", rec.Body.String())
+	}
+}
@@ -1,16 +1,23 @@
 package grpc_protocol
 
 import (
-	pb "/protofile" // Import the compiled protocol buffer
 	"context"
+	"fmt"
+	"io"
 	"log"
 	"net"
+	"rpc"
+	"strings"
 	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
+	pb "website.com/networking/protocols/protofile" // Import the compiled protocol buffer
 )
 
+// reflectionMethod is served by the reflection service, which is left open for inspection
+const reflectionMethod = "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo"
+
 // Server is used to implement the gRPC server
 type Server struct {
 	pb.UnimplementedServiceServer
@@ -36,12 +43,13 @@ func (s *Server) ServerStreaming(in *pb.RequestMessage, stream pb.Service_Server
 	return nil
 }
 
-// Client-side streaming
+// Client-side streaming, answering once the client closes its side of the stream with a
+// summary of every message received
 func (s *Server) ClientStreaming(stream pb.Service_ClientStreamingServer) error {
 	var messages []string
 	for {
 		req, err := stream.Recv()
-		if err == grpc.ErrServerStopped {
+		if err == io.EOF {
 			break
 		}
 		if err != nil {
@@ -50,7 +58,9 @@ func (s *Server) ClientStreaming(stream pb.Service_ClientStreamingServer) error
 		log.Printf("Received stream request: %s", req.GetMessage())
 		messages = append(messages, req.GetMessage())
 	}
-	return stream.SendAndClose(&pb.ResponseMessage{Message: "All messages received."})
+	return stream.SendAndClose(&pb.ResponseMessage{
+		Message: fmt.Sprintf("All %d messages received: %s", len(messages), strings.Join(messages, ", ")),
+	})
 }
 
 // Bidirectional streaming
@@ -69,20 +79,79 @@ func (s *Server) BidirectionalStreaming(stream pb.Service_BidirectionalStreaming
 	return nil
 }
 
-// Start the gRPC server
-func StartGRPCServer() {
+// defaultDrainTimeout bounds how long in-flight RPCs may drain on shutdown when no timeout
+// is given
+const defaultDrainTimeout = 15 * time.Second
+
+// StartGRPCServer serves gRPC on port 50051 until ctx is cancelled, then stops accepting new
+// RPCs and waits for active ones, streams included, to finish. Connections still open after
+// drainTimeout are closed. Callers wanting to shut down on SIGTERM pass a context from
+// signal.NotifyContext. The reflection and health services are always served without
+// authentication.
+//
+// The server reports SERVING over the gRPC health checking protocol once it is listening,
+// and NOT_SERVING from the start of shutdown. config.Health, if set, is used so the caller
+// can flip the status; otherwise a new HealthStatus is created.
+func StartGRPCServer(ctx context.Context, config rpc.ServerConfig, drainTimeout time.Duration) error {
+	if drainTimeout <= 0 {
+		drainTimeout = defaultDrainTimeout
+	}
+
+	validate, err := rpc.JWTValidatorFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to load token validation config: %w", err)
+	}
+	skipMethods := append([]string{reflectionMethod}, rpc.HealthCheckMethods...)
+	config.SkipAuthMethods = append(skipMethods, config.SkipAuthMethods...)
+	if config.Health == nil {
+		config.Health = rpc.NewHealthStatus()
+	}
+
 	lis, err := net.Listen("tcp", ":50051")
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		return fmt.Errorf("failed to listen: %w", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(rpc.ServerOptions(validate, config)...)
 	pb.RegisterServiceServer(grpcServer, &Server{})
 	reflection.Register(grpcServer) // For easier inspection
+	config.Health.Register(grpcServer)
 
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- grpcServer.Serve(lis)
+	}()
 	log.Printf("gRPC server is running on port 50051")
-	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	config.Health.SetServing(true)
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("failed to serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down gRPC server...")
+	config.Health.Shutdown()
+	stopGracefully(grpcServer, drainTimeout)
+	return nil
+}
+
+// stopGracefully drains active RPCs, forcing the remaining connections closed after timeout
+func stopGracefully(grpcServer *grpc.Server, timeout time.Duration) {
+	drained := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(drained)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-drained:
+	case <-timer.C:
+		log.Printf("Drain timeout of %v exceeded, closing remaining connections", timeout)
+		grpcServer.Stop()
+		<-drained
 	}
 }
 
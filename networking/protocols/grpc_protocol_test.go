@@ -0,0 +1,49 @@
+package grpc_protocol
+
+import (
+	"io"
+	"testing"
+
+	"google.golang.org/grpc"
+	"website.com/networking/protocols/protofile"
+)
+
+// Client stream replaying a fixed list of messages, recording the server's reply
+type recordedClientStream struct {
+	grpc.ServerStream
+	requests []*protofile.RequestMessage
+	response *protofile.ResponseMessage
+}
+
+func (s *recordedClientStream) Recv() (*protofile.RequestMessage, error) {
+	if len(s.requests) == 0 {
+		return nil, io.EOF
+	}
+	req := s.requests[0]
+	s.requests = s.requests[1:]
+	return req, nil
+}
+
+func (s *recordedClientStream) SendAndClose(resp *protofile.ResponseMessage) error {
+	s.response = resp
+	return nil
+}
+
+func TestClientStreamingAggregatesMessages(t *testing.T) {
+	stream := &recordedClientStream{requests: []*protofile.RequestMessage{
+		{Message: "first"},
+		{Message: "second"},
+		{Message: "third"},
+	}}
+
+	if err := new(Server).ClientStreaming(stream); err != nil {
+		t.Fatalf("Expected the stream to complete at EOF, got %v", err)
+	}
+	if stream.response == nil {
+		t.Fatalf("Expected a response once the client closed the stream")
+	}
+	want := "All 3 messages received: first, second, third"
+	if stream.response.Message != want {
+		t.Errorf("Expected '%s', got '%s'", want, stream.response.Message)
+	}
+}
@@ -0,0 +1,46 @@
+package rpc
+
+import (
+	"errors"
+
+	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/health" // registers the client-side health checker
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+)
+
+// ErrNoAddresses is returned when a client is given no server addresses
+var ErrNoAddresses = errors.New("no server addresses")
+
+// staticScheme names the resolver serving a fixed list of backends
+const staticScheme = "static"
+
+// serviceConfig spreads calls over every ready backend and uses the standard gRPC health
+// service to skip backends reporting NOT_SERVING. Backends that don't implement the
+// health service are treated as healthy.
+const serviceConfig = `{
+	"loadBalancingConfig": [{"round_robin": {}}],
+	"healthCheckConfig": {"serviceName": ""}
+}`
+
+// dialTarget returns the target to dial for the addresses, with the dial options needed to
+// resolve it. A single address is dialled directly, so it may also be a name resolved by
+// gRPC, such as dns:///db.internal:50051, whose every record becomes a backend. Several
+// addresses are served by a static resolver.
+func dialTarget(addresses []string) (string, []grpc.DialOption, error) {
+	switch len(addresses) {
+	case 0:
+		return "", nil, ErrNoAddresses
+	case 1:
+		return addresses[0], nil, nil
+	}
+
+	// Each connection gets its own resolver, as a manual resolver serves one ClientConn
+	r := manual.NewBuilderWithScheme(staticScheme)
+	state := resolver.State{}
+	for _, address := range addresses {
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: address})
+	}
+	r.InitialState(state)
+	return staticScheme + ":///backends", []grpc.DialOption{grpc.WithResolvers(r)}, nil
+}
@@ -0,0 +1,52 @@
+package rpc
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"security/encryption"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// ErrNoTransportSecurity is returned when a client has neither a CA certificate nor an
+// explicit request for an insecure connection
+var ErrNoTransportSecurity = errors.New("no CA certificate configured and insecure connections not requested")
+
+// ClientTLSOptions configures how an RpcClient secures its connections
+type ClientTLSOptions struct {
+	CACertFile string // CA certificate used to verify the server
+	CertFile   string // client certificate for mutual TLS; optional
+	KeyFile    string // key of the client certificate
+	ServerName string // name expected in the server's certificate, if not the dialled host
+
+	// Insecure connects without TLS. It must be set explicitly, and is meant for local
+	// development only.
+	Insecure bool
+}
+
+// transportCredentials builds the credentials described by the options
+func (o ClientTLSOptions) transportCredentials() (credentials.TransportCredentials, error) {
+	if o.Insecure {
+		return insecure.NewCredentials(), nil
+	}
+	if o.CACertFile == "" {
+		return nil, ErrNoTransportSecurity
+	}
+
+	tlsConfig, err := encryption.LoadClientTLSConfig(o.CACertFile)
+	if err != nil {
+		return nil, err
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate and key: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	tlsConfig.ServerName = o.ServerName
+	tlsConfig.MinVersion = tls.VersionTLS12
+	return credentials.NewTLS(tlsConfig), nil
+}
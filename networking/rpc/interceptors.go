@@ -0,0 +1,103 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// MetricsRecorder receives the outcome of each RPC. monitoring.RPCMetrics implements it.
+type MetricsRecorder interface {
+	ObserveRPC(method, code string, latency time.Duration)
+}
+
+// UnaryInterceptor records the method, status code, and latency of every unary call, and
+// logs failed calls. A nil recorder only logs.
+func UnaryInterceptor(recorder MetricsRecorder) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		observe(recorder, method, start, err)
+		return err
+	}
+}
+
+// StreamInterceptor records streaming calls like UnaryInterceptor. A stream is observed
+// when it ends: when it can't be opened, when receiving returns an error or io.EOF, when
+// the single response of a stream without server streaming is received, or when ctx is
+// done first.
+func StreamInterceptor(recorder MetricsRecorder) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			observe(recorder, method, start, err)
+			return nil, err
+		}
+		observed := &observedStream{
+			ClientStream:  stream,
+			serverStreams: desc.ServerStreams,
+			done:          make(chan struct{}),
+			finish: func(err error) {
+				observe(recorder, method, start, err)
+			},
+		}
+		// A stream abandoned before it is read to the end is observed once it is cancelled
+		go func() {
+			select {
+			case <-ctx.Done():
+				observed.end(status.FromContextError(ctx.Err()).Err())
+			case <-observed.done:
+			}
+		}()
+		return observed, nil
+	}
+}
+
+// observe reports a finished call to the recorder and logs it if it failed
+func observe(recorder MetricsRecorder, method string, start time.Time, err error) {
+	latency := time.Since(start)
+	if err != nil {
+		log.Printf("RPC %s failed after %v: %v", method, latency, err)
+	}
+	if recorder != nil {
+		recorder.ObserveRPC(method, status.Code(err).String(), latency)
+	}
+}
+
+// observedStream reports its call once the stream ends
+type observedStream struct {
+	grpc.ClientStream
+	serverStreams bool
+	once          sync.Once
+	done          chan struct{} // closed once the call is reported
+	finish        func(err error)
+}
+
+func (s *observedStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == io.EOF:
+		s.end(nil)
+	case err != nil:
+		s.end(err)
+	case !s.serverStreams:
+		// Without server streaming the call is over once its only response arrives,
+		// which is how CloseAndRecv succeeds
+		s.end(nil)
+	}
+	return err
+}
+
+// end reports the call the first time the stream ends
+func (s *observedStream) end(err error) {
+	s.once.Do(func() {
+		close(s.done)
+		s.finish(err)
+	})
+}
@@ -0,0 +1,82 @@
+package rpc_test
+
+import (
+	"context"
+	"io"
+	"rpc"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Metrics recorder collecting the status codes of the observed calls
+type recordingMetrics struct {
+	mu    sync.Mutex
+	codes []string
+}
+
+func (m *recordingMetrics) ObserveRPC(method, code string, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes = append(m.codes, code)
+}
+
+func (m *recordingMetrics) observed() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.codes...)
+}
+
+// Client stream answering one response and then io.EOF
+type singleResponseClientStream struct {
+	grpc.ClientStream
+	received bool
+}
+
+func (s *singleResponseClientStream) RecvMsg(m interface{}) error {
+	if s.received {
+		return io.EOF
+	}
+	s.received = true
+	return nil
+}
+
+func TestStreamInterceptorObservesEnd(t *testing.T) {
+	open := func(ctx context.Context, desc *grpc.StreamDesc, recorder rpc.MetricsRecorder) grpc.ClientStream {
+		streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &singleResponseClientStream{}, nil
+		}
+		stream, err := rpc.StreamInterceptor(recorder)(ctx, desc, nil, "/protos.RPCService/StreamingCall", streamer)
+		if err != nil {
+			t.Fatalf("Failed to open stream: %v", err)
+		}
+		return stream
+	}
+
+	// A client stream ends once CloseAndRecv receives its only response
+	recorder := &recordingMetrics{}
+	stream := open(context.Background(), &grpc.StreamDesc{ClientStreams: true}, recorder)
+	if err := stream.RecvMsg(nil); err != nil {
+		t.Fatalf("Failed to receive response: %v", err)
+	}
+	if got := recorder.observed(); len(got) != 1 || got[0] != codes.OK.String() {
+		t.Errorf("Expected one successful call after the response, got %v", got)
+	}
+
+	// A server stream abandoned before io.EOF is observed when its context is cancelled
+	recorder = &recordingMetrics{}
+	ctx, cancel := context.WithCancel(context.Background())
+	stream = open(ctx, &grpc.StreamDesc{ServerStreams: true}, recorder)
+	stream.RecvMsg(nil)
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for len(recorder.observed()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := recorder.observed(); len(got) != 1 || got[0] != codes.Canceled.String() {
+		t.Errorf("Expected one cancelled call, got %v", got)
+	}
+}
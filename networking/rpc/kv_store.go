@@ -0,0 +1,138 @@
+package rpc
+
+import (
+	"container/heap"
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// kvEntry is a stored value and the time it expires; a zero expiresAt never expires
+type kvEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// expired reports whether the entry's TTL has run out at now
+func (e *kvEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// expiryItem schedules the eviction of one entry
+type expiryItem struct {
+	key   string
+	entry *kvEntry
+}
+
+// expiryQueue is a min-heap of expiryItems ordered by expiry time
+type expiryQueue []expiryItem
+
+func (q expiryQueue) Len() int           { return len(q) }
+func (q expiryQueue) Less(i, j int) bool { return q[i].entry.expiresAt.Before(q[j].entry.expiresAt) }
+func (q expiryQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *expiryQueue) Push(x interface{}) { *q = append(*q, x.(expiryItem)) }
+
+func (q *expiryQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// KVStore is a concurrent key-value store whose keys may expire. Reads are served from a
+// sync.Map without locking. Since sync.Map has no notion of order, keys set with a TTL are
+// also pushed onto a min-heap by expiry time, so Sweep only visits keys that are due.
+// Expired keys are hidden from reads as soon as they expire, even before they are swept.
+type KVStore struct {
+	data   sync.Map   // key to *kvEntry
+	mu     sync.Mutex // serializes writes with Sweep and guards expiry
+	expiry expiryQueue
+}
+
+// NewKVStore creates an empty KVStore
+func NewKVStore() *KVStore {
+	return &KVStore{}
+}
+
+// Set stores a value, replacing any previous value and TTL for the key. The key expires
+// after ttl, or never if ttl is not positive.
+func (s *KVStore) Set(key, value string, ttl time.Duration) {
+	entry := &kvEntry{value: value}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ttl > 0 {
+		entry.expiresAt = time.Now().Add(ttl)
+		heap.Push(&s.expiry, expiryItem{key: key, entry: entry})
+	}
+	s.data.Store(key, entry)
+}
+
+// Get returns the value stored for a key that has not expired
+func (s *KVStore) Get(key string) (string, bool) {
+	value, ok := s.data.Load(key)
+	if !ok {
+		return "", false
+	}
+	entry := value.(*kvEntry)
+	if entry.expired(time.Now()) {
+		return "", false
+	}
+	return entry.value, true
+}
+
+// Delete removes a key, reporting whether it held a value that had not expired. A pending
+// expiry for the key is dropped when Sweep reaches it.
+func (s *KVStore) Delete(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.data.LoadAndDelete(key)
+	return ok && !value.(*kvEntry).expired(time.Now())
+}
+
+// Range calls f for each key that has not expired, in no particular order, until f
+// returns false
+func (s *KVStore) Range(f func(key, value string) bool) {
+	now := time.Now()
+	s.data.Range(func(key, value interface{}) bool {
+		entry := value.(*kvEntry)
+		if entry.expired(now) {
+			return true
+		}
+		return f(key.(string), entry.value)
+	})
+}
+
+// Sweep evicts every expired key and returns how many were evicted. Heap items whose key has
+// since been overwritten or deleted are discarded without touching the key.
+func (s *KVStore) Sweep() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	evicted := 0
+	for len(s.expiry) > 0 && s.expiry[0].entry.expired(now) {
+		item := heap.Pop(&s.expiry).(expiryItem)
+		if current, ok := s.data.Load(item.key); ok && current.(*kvEntry) == item.entry {
+			s.data.Delete(item.key)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// RunSweeper calls Sweep every interval until ctx is done
+func (s *KVStore) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if evicted := s.Sweep(); evicted > 0 {
+				log.Printf("Evicted %d expired keys", evicted)
+			}
+		}
+	}
+}
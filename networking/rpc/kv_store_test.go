@@ -0,0 +1,66 @@
+package rpc_test
+
+import (
+	"rpc"
+	"testing"
+	"time"
+)
+
+func TestKVStoreExpiry(t *testing.T) {
+	store := rpc.NewKVStore()
+	ttl := 100 * time.Millisecond
+	store.Set("session", "abc", ttl)
+	store.Set("config", "static", 0)
+	store.Set("renewed", "old", ttl)
+	store.Set("renewed", "new", 0)
+
+	if value, ok := store.Get("session"); !ok || value != "abc" {
+		t.Fatalf("Expected 'abc' before the TTL elapsed, got '%s' (found %v)", value, ok)
+	}
+
+	time.Sleep(ttl + 50*time.Millisecond)
+	if _, ok := store.Get("session"); ok {
+		t.Errorf("Expected an expired key to be hidden before it is swept")
+	}
+	if evicted := store.Sweep(); evicted != 1 {
+		t.Errorf("Expected 1 key to be evicted, got %d", evicted)
+	}
+	if value, ok := store.Get("config"); !ok || value != "static" {
+		t.Errorf("Expected a key without TTL to remain, got '%s' (found %v)", value, ok)
+	}
+	if value, ok := store.Get("renewed"); !ok || value != "new" {
+		t.Errorf("Expected overwriting a key to clear its TTL, got '%s' (found %v)", value, ok)
+	}
+
+	keys := 0
+	store.Range(func(key, value string) bool {
+		keys++
+		return true
+	})
+	if keys != 2 {
+		t.Errorf("Expected 2 keys after the sweep, got %d", keys)
+	}
+}
+
+func TestKVStoreDelete(t *testing.T) {
+	store := rpc.NewKVStore()
+	store.Set("key", "value", time.Minute)
+
+	if !store.Delete("key") {
+		t.Fatalf("Expected deleting a stored key to succeed")
+	}
+	if _, ok := store.Get("key"); ok {
+		t.Errorf("Expected a deleted key to be gone")
+	}
+	if store.Delete("key") {
+		t.Errorf("Expected deleting a missing key to report it was not found")
+	}
+
+	store.Set("key", "recreated", 0)
+	if evicted := store.Sweep(); evicted != 0 {
+		t.Errorf("Expected the deleted key's TTL not to evict its replacement, evicted %d", evicted)
+	}
+	if value, ok := store.Get("key"); !ok || value != "recreated" {
+		t.Errorf("Expected 'recreated', got '%s' (found %v)", value, ok)
+	}
+}
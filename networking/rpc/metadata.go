@@ -0,0 +1,38 @@
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata keys set by the helpers below. gRPC lowercases every metadata key, so lookups
+// on the server side must use lowercase keys as well.
+const (
+	RequestIDKey     = "x-request-id"
+	AuthorizationKey = "authorization"
+	// ItemsSentKey is set in the trailer of server streams to the number of items sent
+	ItemsSentKey = "x-items-sent"
+)
+
+// WithMetadata returns a context whose outgoing calls, unary and streaming alike, carry md
+// in addition to any metadata already attached to ctx. Build md with metadata.New or
+// metadata.Pairs, which lowercase the keys; a literal MD with uppercase keys is invalid.
+func WithMetadata(ctx context.Context, md metadata.MD) context.Context {
+	if existing, ok := metadata.FromOutgoingContext(ctx); ok {
+		md = metadata.Join(existing, md)
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// WithRequestID tags outgoing calls with a request ID so they can be correlated across
+// services
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, RequestIDKey, requestID)
+}
+
+// WithBearerToken authenticates outgoing calls with an access token, such as one issued by
+// the authentication server
+func WithBearerToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, AuthorizationKey, "Bearer "+token)
+}
@@ -2,182 +2,409 @@ package rpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"rpc/protos" // Import the generated protobuf code
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
 )
 
-// RpcClient struct holds the connection and client
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative protos/rpc_service.proto
+
+const (
+	defaultPoolSize         = 4
+	defaultKeepaliveTime    = time.Minute
+	defaultKeepaliveTimeout = 20 * time.Second
+	defaultInitialBackoff   = 100 * time.Millisecond
+	defaultMaxBackoff       = 5 * time.Second
+	defaultMaxRetryElapsed  = 30 * time.Second
+	defaultCallTimeout      = 10 * time.Second
+	defaultDialTimeout      = 5 * time.Second
+)
+
+// ClientConfig configures an RpcClient
+type ClientConfig struct {
+	PoolSize int // connections opened to the server; values below 1 mean one
+
+	// Idle connections are pinged every KeepaliveTime, and dropped if a ping isn't
+	// acknowledged within KeepaliveTimeout. The server's keepalive enforcement policy must
+	// allow pings this frequent, or it will close the connection.
+	KeepaliveTime    time.Duration
+	KeepaliveTimeout time.Duration
+
+	TLS ClientTLSOptions // how connections are secured; TLS is required unless TLS.Insecure is set
+
+	// DefaultTimeout bounds a unary call whose context has no deadline. Deadlines are
+	// always propagated to the server with the call.
+	DefaultTimeout time.Duration
+
+	DialTimeout time.Duration // how long to wait for a healthy backend when connecting
+
+	// RetryUnaryCall waits a random time of up to InitialBackoff before the first retry,
+	// doubling the bound each retry up to MaxBackoff, and gives up once MaxRetryElapsed
+	// has passed since the first attempt
+	InitialBackoff  time.Duration
+	MaxBackoff      time.Duration
+	MaxRetryElapsed time.Duration
+
+	// Metrics, if set, receives the method, status code, and latency of every call.
+	// UnaryInterceptors and StreamInterceptors run after the built-in metrics interceptors.
+	Metrics            MetricsRecorder
+	UnaryInterceptors  []grpc.UnaryClientInterceptor
+	StreamInterceptors []grpc.StreamClientInterceptor
+}
+
+// DefaultClientConfig returns the configuration used when none is given
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{
+		PoolSize:         defaultPoolSize,
+		KeepaliveTime:    defaultKeepaliveTime,
+		KeepaliveTimeout: defaultKeepaliveTimeout,
+		InitialBackoff:   defaultInitialBackoff,
+		MaxBackoff:       defaultMaxBackoff,
+		MaxRetryElapsed:  defaultMaxRetryElapsed,
+		DefaultTimeout:   defaultCallTimeout,
+		DialTimeout:      defaultDialTimeout,
+	}
+}
+
+// RpcClient struct holds a pool of connections and a client for each, used in turn
 type RpcClient struct {
-	connection *grpc.ClientConn
-	client     protos.RPCServiceClient
+	config      ClientConfig
+	connections []*grpc.ClientConn
+	clients     []protos.RPCServiceClient
+	next        uint64 // round-robin counter over the pool
 }
 
-// NewRpcClient initializes a new RpcClient
-func NewRpcClient(serverAddress string) *RpcClient {
-	// Set up a connection to the server
-	conn, err := grpc.Dial(serverAddress, grpc.WithInsecure(), grpc.WithBlock())
+// NewRpcClient initializes a new RpcClient with a pool of connections to the servers at
+// addresses. Each connection balances calls round-robin across the healthy servers, so a
+// failing server is skipped until it recovers.
+func NewRpcClient(addresses []string, config ClientConfig) (*RpcClient, error) {
+	if config.PoolSize < 1 {
+		config.PoolSize = 1
+	}
+	if config.KeepaliveTime <= 0 {
+		config.KeepaliveTime = defaultKeepaliveTime
+	}
+	if config.KeepaliveTimeout <= 0 {
+		config.KeepaliveTimeout = defaultKeepaliveTimeout
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = defaultInitialBackoff
+	}
+	if config.MaxBackoff < config.InitialBackoff {
+		config.MaxBackoff = config.InitialBackoff
+	}
+	if config.MaxRetryElapsed <= 0 {
+		config.MaxRetryElapsed = defaultMaxRetryElapsed
+	}
+	if config.DefaultTimeout <= 0 {
+		config.DefaultTimeout = defaultCallTimeout
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = defaultDialTimeout
+	}
+
+	creds, err := config.TLS.transportCredentials()
 	if err != nil {
-		log.Fatalf("Failed to connect to server: %v", err)
+		return nil, fmt.Errorf("failed to configure transport security: %w", err)
 	}
 
-	client := protos.NewRPCServiceClient(conn)
+	unary := append([]grpc.UnaryClientInterceptor{UnaryInterceptor(config.Metrics)}, config.UnaryInterceptors...)
+	stream := append([]grpc.StreamClientInterceptor{StreamInterceptor(config.Metrics)}, config.StreamInterceptors...)
 
-	return &RpcClient{
-		connection: conn,
-		client:     client,
+	c := &RpcClient{config: config}
+	for i := 0; i < config.PoolSize; i++ {
+		target, resolverOpts, err := dialTarget(addresses)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+
+		// Set up a connection to the servers
+		ctx, cancel := context.WithTimeout(context.Background(), config.DialTimeout)
+		conn, err := grpc.DialContext(ctx, target, append(resolverOpts,
+			grpc.WithTransportCredentials(creds),
+			grpc.WithDefaultServiceConfig(serviceConfig),
+			grpc.WithChainUnaryInterceptor(unary...),
+			grpc.WithChainStreamInterceptor(stream...),
+			grpc.WithBlock(),
+			grpc.WithKeepaliveParams(keepalive.ClientParameters{
+				Time:                config.KeepaliveTime,
+				Timeout:             config.KeepaliveTimeout,
+				PermitWithoutStream: true,
+			}),
+		)...)
+		cancel()
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("failed to connect to %v: %w", addresses, err)
+		}
+		c.connections = append(c.connections, conn)
+		c.clients = append(c.clients, protos.NewRPCServiceClient(conn))
 	}
+	return c, nil
 }
 
-// Close the connection when done
-func (c *RpcClient) Close() {
-	err := c.connection.Close()
-	if err != nil {
-		log.Fatalf("Error closing the connection: %v", err)
+// client picks the next client in the pool
+func (c *RpcClient) client() protos.RPCServiceClient {
+	n := atomic.AddUint64(&c.next, 1)
+	return c.clients[(n-1)%uint64(len(c.clients))]
+}
+
+// Close the connections when done, returning the first error encountered
+func (c *RpcClient) Close() error {
+	var firstErr error
+	for _, conn := range c.connections {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error closing the connection: %w", err)
+		}
+	}
+	return firstErr
+}
+
+// withDefaultTimeout applies DefaultTimeout to a context without a deadline
+func (c *RpcClient) withDefaultTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
 	}
+	return context.WithTimeout(ctx, c.config.DefaultTimeout)
 }
 
-// UnaryCall sends a unary request to the server
+// UnaryCall sends a unary request to the server, bounded by DefaultTimeout if ctx has no
+// deadline
 func (c *RpcClient) UnaryCall(ctx context.Context, request *protos.Request) (*protos.Response, error) {
-	response, err := c.client.UnaryCall(ctx, request)
+	ctx, cancel := c.withDefaultTimeout(ctx)
+	defer cancel()
+	response, err := c.client().UnaryCall(ctx, request)
 	if err != nil {
-		return nil, fmt.Errorf("UnaryCall failed: %v", err)
+		return nil, fmt.Errorf("UnaryCall failed: %w", err)
 	}
 	return response, nil
 }
 
-// ServerStreamingCall initiates a server-side streaming call
-func (c *RpcClient) ServerStreamingCall(ctx context.Context, request *protos.Request) error {
-	stream, err := c.client.ServerStreamingCall(ctx, request)
+// ErrNotServing is returned by HealthCheck when the server reports a status other than
+// SERVING, or when no backend is left to ask
+var ErrNotServing = errors.New("server not serving")
+
+// HealthCheck asks the server for its overall status over the gRPC health checking
+// protocol, the same check load balancers make, and fails unless it reports SERVING. The
+// client-side health checker takes backends that aren't serving out of the pool, so the
+// check failing with codes.Unavailable also means none is serving. It is bounded by
+// DefaultTimeout if ctx has no deadline.
+func (c *RpcClient) HealthCheck(ctx context.Context) error {
+	ctx, cancel := c.withDefaultTimeout(ctx)
+	defer cancel()
+	n := atomic.AddUint64(&c.next, 1)
+	conn := c.connections[(n-1)%uint64(len(c.connections))]
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if status.Code(err) == codes.Unavailable {
+		return fmt.Errorf("%w: %v", ErrNotServing, err)
+	}
 	if err != nil {
-		return fmt.Errorf("ServerStreamingCall failed: %v", err)
+		return fmt.Errorf("HealthCheck failed: %w", err)
 	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("%w: status %v", ErrNotServing, resp.Status)
+	}
+	return nil
+}
 
+// ServerStreamingCall initiates a server-side streaming call and returns every response
+// the server sent. If the stream fails, the responses received so far are returned with
+// the error.
+func (c *RpcClient) ServerStreamingCall(ctx context.Context, request *protos.Request) ([]*protos.Response, error) {
+	stream, err := c.client().ServerStreamingCall(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("ServerStreamingCall failed: %w", err)
+	}
+
+	var responses []*protos.Response
 	for {
 		response, err := stream.Recv()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("Error receiving stream: %v", err)
+			return responses, fmt.Errorf("Error receiving stream: %w", err)
 		}
-		log.Printf("Received: %v", response)
+		responses = append(responses, response)
 	}
 
-	return nil
+	return responses, nil
 }
 
 // ClientStreamingCall sends a stream of requests to the server
 func (c *RpcClient) ClientStreamingCall(ctx context.Context, requests []*protos.Request) (*protos.Response, error) {
-	stream, err := c.client.ClientStreamingCall(ctx)
+	stream, err := c.client().ClientStreamingCall(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("ClientStreamingCall failed: %v", err)
+		return nil, fmt.Errorf("ClientStreamingCall failed: %w", err)
 	}
 
 	for _, req := range requests {
 		if err := stream.Send(req); err != nil {
-			return nil, fmt.Errorf("Error sending stream: %v", err)
+			// io.EOF means the server ended the stream; its status comes from CloseAndRecv
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("Error sending stream: %w", err)
 		}
 	}
 
 	response, err := stream.CloseAndRecv()
 	if err != nil {
-		return nil, fmt.Errorf("Error receiving response: %v", err)
+		return nil, fmt.Errorf("Error receiving response: %w", err)
 	}
 
 	return response, nil
 }
 
-// BidirectionalStreamingCall handles bidirectional streaming between client and server
-func (c *RpcClient) BidirectionalStreamingCall(ctx context.Context, requests []*protos.Request) error {
-	stream, err := c.client.BidirectionalStreamingCall(ctx)
+// BidirectionalStreamingCall sends the requests while receiving the server's responses, and
+// returns the responses with the first error from either direction. Both directions are
+// finished before it returns.
+func (c *RpcClient) BidirectionalStreamingCall(ctx context.Context, requests []*protos.Request) ([]*protos.Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.client().BidirectionalStreamingCall(ctx)
 	if err != nil {
-		return fmt.Errorf("BidirectionalStreamingCall failed: %v", err)
+		return nil, fmt.Errorf("BidirectionalStreamingCall failed: %w", err)
 	}
 
-	done := make(chan bool)
+	// The first outcome wins; cancelling the stream then unblocks the other direction
+	var once sync.Once
+	var firstErr error
+	finish := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
 
-	// Goroutine to send requests
+	sendDone := make(chan struct{})
 	go func() {
+		defer close(sendDone)
 		for _, req := range requests {
 			if err := stream.Send(req); err != nil {
-				log.Printf("Error sending request: %v", err)
+				// io.EOF means the server ended the stream; Recv reports its status
+				if err != io.EOF {
+					finish(fmt.Errorf("Error sending request: %w", err))
+				}
 				return
 			}
 		}
-		err := stream.CloseSend()
-		if err != nil {
-			log.Printf("Error closing send: %v", err)
+		if err := stream.CloseSend(); err != nil {
+			finish(fmt.Errorf("Error closing send: %w", err))
 		}
 	}()
 
-	// Goroutine to receive responses
-	go func() {
-		for {
-			response, err := stream.Recv()
-			if err == io.EOF {
-				done <- true
-				return
-			}
-			if err != nil {
-				log.Printf("Error receiving response: %v", err)
-				done <- true
-				return
-			}
-			log.Printf("Received: %v", response)
+	var responses []*protos.Response
+	for {
+		response, err := stream.Recv()
+		if err == io.EOF {
+			finish(nil)
+			break
 		}
-	}()
+		if err != nil {
+			finish(fmt.Errorf("Error receiving response: %w", err))
+			break
+		}
+		responses = append(responses, response)
+	}
 
-	<-done
-	return nil
+	<-sendDone
+	return responses, firstErr
+}
+
+// retryable reports whether a failed call may succeed if repeated
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// backoff returns a random wait of up to InitialBackoff doubled once per earlier retry,
+// capped at MaxBackoff
+func (c *RpcClient) backoff(retry int) time.Duration {
+	bound := c.config.MaxBackoff
+	if retry < 32 {
+		if d := c.config.InitialBackoff << uint(retry); d > 0 && d < bound {
+			bound = d
+		}
+	}
+	return time.Duration(rand.Int63n(int64(bound) + 1))
 }
 
-// RetryUnaryCall attempts a retry of UnaryCall on failure
-func (c *RpcClient) RetryUnaryCall(ctx context.Context, request *protos.Request, retries int) (*protos.Response, error) {
+// RetryUnaryCall makes up to attempts UnaryCalls, retrying only transient failures with
+// exponential backoff and jitter. Each attempt is bounded by DefaultTimeout if ctx has no
+// deadline. It stops as soon as ctx is done or MaxRetryElapsed has passed.
+func (c *RpcClient) RetryUnaryCall(ctx context.Context, request *protos.Request, attempts int) (*protos.Response, error) {
+	start := time.Now()
 	var lastErr error
-	for attempt := 0; attempt < retries; attempt++ {
-		response, err := c.UnaryCall(ctx, request)
+	for attempt := 0; attempt < attempts; attempt++ {
+		callCtx, cancel := c.withDefaultTimeout(ctx)
+		response, err := c.client().UnaryCall(callCtx, request)
+		cancel()
 		if err == nil {
 			return response, nil
 		}
 		lastErr = err
-		log.Printf("Retry attempt %d failed: %v", attempt+1, err)
-		time.Sleep(2 * time.Second) // Exponential backoff can be applied here
-	}
-	return nil, fmt.Errorf("RetryUnaryCall failed after %d attempts: %v", retries, lastErr)
-}
-
-// StreamInterceptor can be used to wrap streaming RPC calls with additional functionality like logging
-func (c *RpcClient) StreamInterceptor(
-	ctx context.Context,
-	method string,
-	req, resp interface{},
-	cc *grpc.ClientConn,
-	invoker grpc.Streamer) error {
+		if ctx.Err() != nil || !retryable(err) || attempt == attempts-1 {
+			break
+		}
 
-	log.Printf("Invoking method: %s with request: %v", method, req)
-	err := invoker(ctx, method, req, resp, cc, invoker)
-	if err != nil {
-		log.Printf("StreamInterceptor: error invoking method: %s, err: %v", method, err)
-		return err
+		wait := c.backoff(attempt)
+		if time.Since(start)+wait > c.config.MaxRetryElapsed {
+			break
+		}
+		log.Printf("Retry attempt %d failed: %v, retrying in %v", attempt+1, err, wait)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("RetryUnaryCall cancelled after %d attempts: %w", attempt+1, ctx.Err())
+		case <-timer.C:
+		}
 	}
-	log.Printf("Method %s invoked successfully with response: %v", method, resp)
-	return nil
+	return nil, fmt.Errorf("RetryUnaryCall failed: %w", lastErr)
 }
 
 func main() {
-	serverAddress := "localhost:50051"
+	serverAddresses := []string{"localhost:50051", "localhost:50052", "localhost:50053"}
 
-	client := NewRpcClient(serverAddress)
-	defer client.Close()
+	config := DefaultClientConfig()
+	config.TLS = ClientTLSOptions{
+		CACertFile: "certs/ca.crt",
+		CertFile:   "certs/client.crt",
+		KeyFile:    "certs/client.key",
+	}
+	client, err := NewRpcClient(serverAddresses, config)
+	if err != nil {
+		log.Fatalf("Failed to create client: %v", err)
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			log.Printf("Failed to close client: %v", err)
+		}
+	}()
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
+	ctx = WithRequestID(ctx, "example-request")
+
 	request := &protos.Request{
 		Message: "Hello from client",
 	}
@@ -190,10 +417,11 @@ func main() {
 	log.Printf("UnaryCall response: %v", response)
 
 	// Server streaming call
-	err = client.ServerStreamingCall(ctx, request)
+	responses, err := client.ServerStreamingCall(ctx, request)
 	if err != nil {
 		log.Fatalf("Error in ServerStreamingCall: %v", err)
 	}
+	log.Printf("ServerStreamingCall responses: %v", responses)
 
 	// Client streaming call
 	requests := []*protos.Request{
@@ -209,8 +437,9 @@ func main() {
 	log.Printf("ClientStreamingCall response: %v", response)
 
 	// Bidirectional streaming call
-	err = client.BidirectionalStreamingCall(ctx, requests)
+	responses, err = client.BidirectionalStreamingCall(ctx, requests)
 	if err != nil {
 		log.Fatalf("Error in BidirectionalStreamingCall: %v", err)
 	}
+	log.Printf("BidirectionalStreamingCall responses: %v", responses)
 }
@@ -0,0 +1,115 @@
+package rpc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"rpc"
+	"rpc/protos"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Mock RPC service whose bidirectional stream fails after answering the first request
+type abortingStreamServer struct {
+	protos.UnimplementedRPCServiceServer
+}
+
+func (s *abortingStreamServer) BidirectionalStreamingCall(stream protos.RPCService_BidirectionalStreamingCallServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&protos.Response{Message: "Echo: " + req.Message}); err != nil {
+		return err
+	}
+	return status.Error(codes.Aborted, "aborting mid-stream")
+}
+
+func TestBidirectionalStreamingCallServerAbort(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	protos.RegisterRPCServiceServer(grpcServer, &abortingStreamServer{})
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	config := rpc.DefaultClientConfig()
+	config.PoolSize = 1
+	config.TLS.Insecure = true
+	client, err := rpc.NewRpcClient([]string{lis.Addr().String()}, config)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	requests := make([]*protos.Request, 100)
+	for i := range requests {
+		requests[i] = &protos.Request{Message: fmt.Sprintf("message %d", i)}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	responses, err := client.BidirectionalStreamingCall(ctx, requests)
+	if err == nil || !strings.Contains(err.Error(), "aborting mid-stream") {
+		t.Fatalf("Expected the server's abort to be returned, got %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Errorf("Expected the call to return as soon as the stream failed")
+	}
+	if len(responses) != 1 || responses[0].Message != "Echo: message 0" {
+		t.Errorf("Expected the response sent before the abort, got %v", responses)
+	}
+}
+
+func TestRpcClientHealthCheck(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	health := rpc.NewHealthStatus()
+	health.Register(grpcServer)
+	health.SetServing(true)
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	config := rpc.DefaultClientConfig()
+	config.PoolSize = 1
+	config.TLS.Insecure = true
+	client, err := rpc.NewRpcClient([]string{lis.Addr().String()}, config)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.HealthCheck(context.Background()); err != nil {
+		t.Errorf("Expected the health check to pass while serving, got %v", err)
+	}
+
+	// The health checker's view of the backend catches up with the server asynchronously
+	expectEventually := func(step string, want func(error) bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		err := client.HealthCheck(context.Background())
+		for !want(err) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+			err = client.HealthCheck(context.Background())
+		}
+		if !want(err) {
+			t.Errorf("%s: unexpected health check result %v", step, err)
+		}
+	}
+	health.SetServing(false)
+	expectEventually("not serving", func(err error) bool { return errors.Is(err, rpc.ErrNotServing) })
+	health.SetServing(true)
+	expectEventually("serving again", func(err error) bool { return err == nil })
+}
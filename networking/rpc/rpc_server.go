@@ -1,18 +1,43 @@
 package rpc
 
 import (
-	pb "/proto"
 	"context"
 	"fmt"
 	"log"
-	"sync"
+	pb "rpc/proto"
+	"strconv"
 	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative proto/service.proto
+
+// sweepInterval is how often expired keys are evicted
+const sweepInterval = time.Second
+
 // Define a server struct that implements the RPC methods
 type server struct {
 	pb.UnimplementedServiceServer
-	data sync.Map // thread-safe map for storing key-value pairs
+	data *KVStore // thread-safe store for key-value pairs
+}
+
+// NewServer creates a gRPC server for the key-value service. Every call must carry a bearer
+// token accepted by validate, except calls to config.SkipAuthMethods. Expired keys are
+// evicted in the background until ctx is done.
+func NewServer(ctx context.Context, validate TokenValidator, config ServerConfig) *grpc.Server {
+	s := &server{data: NewKVStore()}
+	go s.data.RunSweeper(ctx, sweepInterval)
+
+	grpcServer := grpc.NewServer(ServerOptions(validate, config)...)
+	pb.RegisterServiceServer(grpcServer, s)
+	if config.Health != nil {
+		config.Health.Register(grpcServer)
+	}
+	return grpcServer
 }
 
 // RPC method to greet a client
@@ -26,9 +51,13 @@ func (s *server) Greet(ctx context.Context, req *pb.GreetRequest) (*pb.GreetResp
 	}, nil
 }
 
-// RPC method for setting key-value pairs
+// RPC method for setting key-value pairs. A positive TTL makes the key expire after that
+// many seconds.
 func (s *server) SetData(ctx context.Context, req *pb.SetDataRequest) (*pb.SetDataResponse, error) {
-	s.data.Store(req.GetKey(), req.GetValue())
+	if req.GetTtlSeconds() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "ttl cannot be negative")
+	}
+	s.data.Set(req.GetKey(), req.GetValue(), time.Duration(req.GetTtlSeconds())*time.Second)
 	return &pb.SetDataResponse{
 		Status: "Success",
 	}, nil
@@ -36,12 +65,22 @@ func (s *server) SetData(ctx context.Context, req *pb.SetDataRequest) (*pb.SetDa
 
 // RPC method for retrieving key-value pairs
 func (s *server) GetData(ctx context.Context, req *pb.GetDataRequest) (*pb.GetDataResponse, error) {
-	value, ok := s.data.Load(req.GetKey())
+	value, ok := s.data.Get(req.GetKey())
 	if !ok {
 		return nil, fmt.Errorf("key not found")
 	}
 	return &pb.GetDataResponse{
-		Value: value.(string),
+		Value: value,
+	}, nil
+}
+
+// RPC method for deleting key-value pairs
+func (s *server) DeleteData(ctx context.Context, req *pb.DeleteDataRequest) (*pb.DeleteDataResponse, error) {
+	if !s.data.Delete(req.GetKey()) {
+		return nil, fmt.Errorf("key not found")
+	}
+	return &pb.DeleteDataResponse{
+		Status: "Success",
 	}, nil
 }
 
@@ -62,23 +101,39 @@ func (s *server) TimeUpdates(req *pb.TimeRequest, stream pb.Service_TimeUpdatesS
 	}
 }
 
-// Server-side streaming RPC for sending a list of data items
+// Server-side streaming RPC for sending a list of data items. At most req.Limit items are
+// sent, or every item when no limit is set, and the stream stops as soon as the client goes
+// away. The number of items sent is reported in the ItemsSentKey trailer.
 func (s *server) ListData(req *pb.ListDataRequest, stream pb.Service_ListDataServer) error {
-	count := 0
-	s.data.Range(func(key, value interface{}) bool {
-		if err := stream.Send(&pb.ListDataResponse{
-			Key:   key.(string),
-			Value: value.(string),
-		}); err != nil {
+	sent, err := s.sendData(stream.Context(), int(req.GetLimit()), stream.Send)
+	stream.SetTrailer(metadata.Pairs(ItemsSentKey, strconv.Itoa(sent)))
+	if err != nil {
+		log.Printf("ListData stopped after %d items: %v", sent, err)
+		return err
+	}
+	return nil
+}
+
+// sendData sends up to limit stored items, or all of them when limit is not positive, and
+// returns how many were sent. Cancellation of ctx is checked before every send.
+func (s *server) sendData(ctx context.Context, limit int, send func(*pb.ListDataResponse) error) (int, error) {
+	sent := 0
+	var err error
+	s.data.Range(func(key, value string) bool {
+		if ctx.Err() != nil {
+			err = status.FromContextError(ctx.Err()).Err()
 			return false
 		}
-		count++
-		if count >= int(req.GetLimit()) {
+		if err = send(&pb.ListDataResponse{
+			Key:   key,
+			Value: value,
+		}); err != nil {
 			return false
 		}
-		return true
+		sent++
+		return limit <= 0 || sent < limit
 	})
-	return nil
+	return sent, err
 }
 
 // A unary RPC that simulates a long-running task
@@ -0,0 +1,169 @@
+package rpc
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// HealthCheckMethods are the gRPC health checking methods, which load balancers and
+// orchestrators call without credentials
+var HealthCheckMethods = []string{
+	"/grpc.health.v1.Health/Check",
+	"/grpc.health.v1.Health/Watch",
+}
+
+// TokenValidator checks a bearer token presented by a caller
+type TokenValidator func(token string) error
+
+// JWTValidatorConfig holds the key and expected claims used to verify access tokens issued
+// by the authentication server
+type JWTValidatorConfig struct {
+	// HMACSecret verifies HS256 tokens
+	HMACSecret []byte
+	// RSAPublicKey verifies RS256 tokens; when set it takes precedence over HMACSecret
+	RSAPublicKey *rsa.PublicKey
+	// Issuer is required as the iss claim when set
+	Issuer string
+	// Audience is required as the aud claim when set
+	Audience string
+}
+
+// NewJWTValidator returns a TokenValidator applying the same checks as the authentication
+// server: the signing algorithm, signature, expiry, issuer and audience. Tokens revoked by
+// logout are only known to the authentication server and are not rejected here.
+func NewJWTValidator(config JWTValidatorConfig) (TokenValidator, error) {
+	var method jwt.SigningMethod
+	var key interface{}
+	switch {
+	case config.RSAPublicKey != nil:
+		method, key = jwt.SigningMethodRS256, config.RSAPublicKey
+	case len(config.HMACSecret) > 0:
+		method, key = jwt.SigningMethodHS256, config.HMACSecret
+	default:
+		return nil, errors.New("no JWT verification key provided")
+	}
+
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		if token.Method.Alg() != method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key, nil
+	}
+	return func(tokenStr string) error {
+		claims := &jwt.StandardClaims{}
+		tkn, err := jwt.ParseWithClaims(tokenStr, claims, keyFunc)
+		if err != nil {
+			return err
+		}
+		if !tkn.Valid {
+			return errors.New("invalid token")
+		}
+		if config.Issuer != "" && !claims.VerifyIssuer(config.Issuer, true) {
+			return errors.New("unexpected token issuer")
+		}
+		if config.Audience != "" && !claims.VerifyAudience(config.Audience, true) {
+			return errors.New("unexpected token audience")
+		}
+		return nil
+	}, nil
+}
+
+// JWTValidatorFromEnv builds a TokenValidator from the environment variables read by the
+// authentication server: JWT_SIGNING_METHOD, JWT_SECRET, JWT_ISSUER and JWT_AUDIENCE. RS256
+// tokens are verified with the public key at JWT_RSA_PUBLIC_KEY_PATH.
+func JWTValidatorFromEnv() (TokenValidator, error) {
+	config := JWTValidatorConfig{
+		Issuer:   os.Getenv("JWT_ISSUER"),
+		Audience: os.Getenv("JWT_AUDIENCE"),
+	}
+	switch method := os.Getenv("JWT_SIGNING_METHOD"); method {
+	case "", "HS256":
+		config.HMACSecret = []byte(os.Getenv("JWT_SECRET"))
+	case "RS256":
+		keyPath := os.Getenv("JWT_RSA_PUBLIC_KEY_PATH")
+		if keyPath == "" {
+			return nil, errors.New("JWT_RSA_PUBLIC_KEY_PATH must be set for RS256")
+		}
+		keyData, err := ioutil.ReadFile(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read RSA public key: %w", err)
+		}
+		config.RSAPublicKey, err = jwt.ParseRSAPublicKeyFromPEM(keyData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RSA public key: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWT signing method: %s", method)
+	}
+	return NewJWTValidator(config)
+}
+
+// UnaryAuthInterceptor rejects unary calls that do not carry a valid bearer token with
+// codes.Unauthenticated. Calls to skipMethods, given as full method names such as
+// HealthCheckMethods, are let through unauthenticated.
+func UnaryAuthInterceptor(validate TokenValidator, skipMethods ...string) grpc.UnaryServerInterceptor {
+	skip := methodSet(skipMethods)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !skip[info.FullMethod] {
+			if err := authenticate(ctx, validate); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuthInterceptor is the streaming counterpart of UnaryAuthInterceptor. The token is
+// checked once when the stream is opened.
+func StreamAuthInterceptor(validate TokenValidator, skipMethods ...string) grpc.StreamServerInterceptor {
+	skip := methodSet(skipMethods)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !skip[info.FullMethod] {
+			if err := authenticate(stream.Context(), validate); err != nil {
+				return err
+			}
+		}
+		return handler(srv, stream)
+	}
+}
+
+// methodSet indexes full method names for lookup
+func methodSet(methods []string) map[string]bool {
+	set := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		set[method] = true
+	}
+	return set
+}
+
+// authenticate validates the bearer token in the incoming metadata of ctx. The reason a
+// token was rejected is not returned to the caller.
+func authenticate(ctx context.Context, validate TokenValidator) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing metadata")
+	}
+	values := md.Get(AuthorizationKey)
+	if len(values) == 0 {
+		return status.Error(codes.Unauthenticated, "missing authorization token")
+	}
+	const prefix = "bearer "
+	if len(values[0]) <= len(prefix) || !strings.EqualFold(values[0][:len(prefix)], prefix) {
+		return status.Error(codes.Unauthenticated, "authorization must be a bearer token")
+	}
+	if err := validate(values[0][len(prefix):]); err != nil {
+		return status.Error(codes.Unauthenticated, "invalid token")
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package rpc_test
+
+import (
+	"context"
+	"errors"
+	"rpc"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryAuthInterceptor(t *testing.T) {
+	validate := func(token string) error {
+		if token != "valid-token" {
+			return errors.New("bad token")
+		}
+		return nil
+	}
+	interceptor := rpc.UnaryAuthInterceptor(validate, rpc.HealthCheckMethods...)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	cases := []struct {
+		name          string
+		method        string
+		authorization string
+		want          codes.Code
+	}{
+		{"valid token", "/protos.RPCService/UnaryCall", "Bearer valid-token", codes.OK},
+		{"invalid token", "/protos.RPCService/UnaryCall", "Bearer forged-token", codes.Unauthenticated},
+		{"not a bearer token", "/protos.RPCService/UnaryCall", "Basic dXNlcjpwYXNz", codes.Unauthenticated},
+		{"missing token", "/protos.RPCService/UnaryCall", "", codes.Unauthenticated},
+		{"allowlisted method", "/grpc.health.v1.Health/Check", "", codes.OK},
+	}
+	for _, tc := range cases {
+		md := metadata.MD{}
+		if tc.authorization != "" {
+			md = metadata.Pairs(rpc.AuthorizationKey, tc.authorization)
+		}
+		ctx := metadata.NewIncomingContext(context.Background(), md)
+		info := &grpc.UnaryServerInfo{FullMethod: tc.method}
+
+		_, err := interceptor(ctx, nil, info, handler)
+		if code := status.Code(err); code != tc.want {
+			t.Errorf("%s: expected %v, got %v (%v)", tc.name, tc.want, code, err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package rpc
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultMaxMsgSize raises gRPC's 4MB message limit so large values can be stored
+const defaultMaxMsgSize = 16 << 20
+
+// ServerConfig configures the gRPC servers built with ServerOptions
+type ServerConfig struct {
+	// Messages larger than these sizes, in bytes, are rejected with codes.ResourceExhausted.
+	// Values below 1 keep gRPC's defaults.
+	MaxRecvMsgSize int
+	MaxSendMsgSize int
+
+	// SkipAuthMethods are full method names served without a bearer token
+	SkipAuthMethods []string
+
+	// Health, if set, is registered as the server's grpc.health.v1 service
+	Health *HealthStatus
+}
+
+// DefaultServerConfig returns the configuration used when none is given. Health checks are
+// served without authentication.
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		MaxRecvMsgSize:  defaultMaxMsgSize,
+		MaxSendMsgSize:  defaultMaxMsgSize,
+		SkipAuthMethods: append([]string(nil), HealthCheckMethods...),
+	}
+}
+
+// ServerOptions returns the options for a server that recovers from handler panics and
+// authenticates callers with validate. Recovery runs first so that a panic anywhere in the
+// chain is caught.
+func ServerOptions(validate TokenValidator, config ServerConfig) []grpc.ServerOption {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			UnaryRecoveryInterceptor(),
+			UnaryAuthInterceptor(validate, config.SkipAuthMethods...),
+		),
+		grpc.ChainStreamInterceptor(
+			StreamRecoveryInterceptor(),
+			StreamAuthInterceptor(validate, config.SkipAuthMethods...),
+		),
+	}
+	if config.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(config.MaxRecvMsgSize))
+	}
+	if config.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(config.MaxSendMsgSize))
+	}
+	return opts
+}
+
+// UnaryRecoveryInterceptor turns a panic in a unary handler into a codes.Internal error,
+// logging the stack trace, so one bad request can't take down the server
+func UnaryRecoveryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(info.FullMethod, r)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamRecoveryInterceptor is the streaming counterpart of UnaryRecoveryInterceptor
+func StreamRecoveryInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(info.FullMethod, r)
+			}
+		}()
+		return handler(srv, stream)
+	}
+}
+
+// recovered logs a recovered panic and returns the error sent to the caller, which does
+// not reveal the panic value
+func recovered(method string, r interface{}) error {
+	log.Printf("Recovered from panic in %s: %v\n%s", method, r, debug.Stack())
+	return status.Error(codes.Internal, "internal server error")
+}
@@ -0,0 +1,32 @@
+package rpc_test
+
+import (
+	"context"
+	"rpc"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRecoveryInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/protos.RPCService/UnaryCall"}
+	panicking := func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("handler bug")
+	}
+
+	_, err := rpc.UnaryRecoveryInterceptor()(context.Background(), nil, info, panicking)
+	if code := status.Code(err); code != codes.Internal {
+		t.Errorf("Expected a panicking unary handler to fail with %v, got %v (%v)", codes.Internal, code, err)
+	}
+
+	streamInfo := &grpc.StreamServerInfo{FullMethod: "/protos.RPCService/BidirectionalStreamingCall"}
+	panickingStream := func(srv interface{}, stream grpc.ServerStream) error {
+		panic("stream handler bug")
+	}
+	err = rpc.StreamRecoveryInterceptor()(nil, nil, streamInfo, panickingStream)
+	if code := status.Code(err); code != codes.Internal {
+		t.Errorf("Expected a panicking stream handler to fail with %v, got %v (%v)", codes.Internal, code, err)
+	}
+}
@@ -0,0 +1,46 @@
+package rpc
+
+import (
+	"log"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// HealthStatus serves the standard gRPC health checking protocol, reporting the status of
+// the server as a whole. Load balancers and RpcClient.HealthCheck, which the query
+// processor pings nodes with, both read it, so flipping it takes a server out of rotation
+// everywhere at once.
+type HealthStatus struct {
+	server *health.Server
+}
+
+// NewHealthStatus creates a HealthStatus reporting NOT_SERVING until SetServing is called
+func NewHealthStatus() *HealthStatus {
+	h := &HealthStatus{server: health.NewServer()}
+	h.server.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	return h
+}
+
+// Register adds the health service to a server
+func (h *HealthStatus) Register(grpcServer *grpc.Server) {
+	healthpb.RegisterHealthServer(grpcServer, h.server)
+}
+
+// SetServing reports the server as SERVING or NOT_SERVING, such as when a dependency it
+// needs becomes available or goes away. It has no effect after Shutdown.
+func (h *HealthStatus) SetServing(serving bool) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	log.Printf("Health status set to %v", status)
+	h.server.SetServingStatus("", status)
+}
+
+// Shutdown reports NOT_SERVING for good, so clients stop sending new calls while the
+// server drains
+func (h *HealthStatus) Shutdown() {
+	h.server.Shutdown()
+}
@@ -0,0 +1,55 @@
+package rpc_test
+
+import (
+	"context"
+	"net"
+	"rpc"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestHealthStatus(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	health := rpc.NewHealthStatus()
+	health.Register(grpcServer)
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	expectStatus := func(step string, want healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatalf("%s: health check failed: %v", step, err)
+		}
+		if resp.Status != want {
+			t.Errorf("%s: expected %v, got %v", step, want, resp.Status)
+		}
+	}
+
+	expectStatus("before startup", healthpb.HealthCheckResponse_NOT_SERVING)
+	health.SetServing(true)
+	expectStatus("once ready", healthpb.HealthCheckResponse_SERVING)
+	health.SetServing(false)
+	expectStatus("dependency lost", healthpb.HealthCheckResponse_NOT_SERVING)
+	health.SetServing(true)
+	health.Shutdown()
+	expectStatus("during shutdown", healthpb.HealthCheckResponse_NOT_SERVING)
+	health.SetServing(true)
+	expectStatus("after shutdown", healthpb.HealthCheckResponse_NOT_SERVING)
+}
@@ -1,19 +1,276 @@
-package main
+package authentication
 
 import (
+	"context"
+	"crypto/rsa"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io/ioutil"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"sync"
 	"time"
+	"unicode"
 
 	"github.com/golang-jwt/jwt"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// Secret key used for signing JWT tokens
-var jwtKey = []byte("my_secret_key")
+// AuthConfig holds the JWT signing configuration
+type AuthConfig struct {
+	// SigningMethod is either jwt.SigningMethodHS256 or jwt.SigningMethodRS256
+	SigningMethod jwt.SigningMethod
+	// HMACSecret signs tokens when SigningMethod is HS256
+	HMACSecret []byte
+	// RSAPrivateKey signs tokens when SigningMethod is RS256
+	RSAPrivateKey *rsa.PrivateKey
+	// TokenTTL is the lifetime of issued tokens
+	TokenTTL time.Duration
+	// RefreshTokenTTL is the lifetime of issued refresh tokens
+	RefreshTokenTTL time.Duration
+	// Issuer is set as the iss claim and required on incoming tokens
+	Issuer string
+	// Audience is set as the aud claim and required on incoming tokens
+	Audience string
+	// MaxFailedLogins is the number of failed logins within LockoutWindow that locks an account
+	MaxFailedLogins int
+	// LockoutWindow is the failure counting window and the lockout duration
+	LockoutWindow time.Duration
+	// PasswordPolicy is enforced on registration before hashing
+	PasswordPolicy PasswordPolicy
+	// BcryptCost is the bcrypt work factor used to hash passwords
+	BcryptCost int
+}
+
+// defaultBcryptCost is the bcrypt work factor used when none is configured
+const defaultBcryptCost = 14
+
+// PasswordPolicy describes the minimum requirements for a new password
+type PasswordPolicy struct {
+	MinLength      int
+	RequireUpper   bool
+	RequireLower   bool
+	RequireDigit   bool
+	RequireSpecial bool
+}
+
+// DefaultPasswordPolicy requires 8 characters with upper, lower and digit characters
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:    8,
+	RequireUpper: true,
+	RequireLower: true,
+	RequireDigit: true,
+}
+
+// Validate returns an error naming the first rule the password violates
+func (p PasswordPolicy) Validate(password string) error {
+	if len(password) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+	var hasUpper, hasLower, hasDigit, hasSpecial bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSpecial = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		return errors.New("password must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		return errors.New("password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		return errors.New("password must contain a digit")
+	}
+	if p.RequireSpecial && !hasSpecial {
+		return errors.New("password must contain a special character")
+	}
+	return nil
+}
+
+// defaultTokenTTL is used when no token lifetime is configured
+const defaultTokenTTL = 5 * time.Minute
+
+// LoadAuthConfigFromEnv builds an AuthConfig from JWT_SIGNING_METHOD, JWT_SECRET,
+// JWT_RSA_PRIVATE_KEY_PATH, JWT_TOKEN_TTL, JWT_REFRESH_TOKEN_TTL, JWT_ISSUER, JWT_AUDIENCE,
+// LOGIN_MAX_FAILURES, LOGIN_LOCKOUT_WINDOW, PASSWORD_MIN_LENGTH and BCRYPT_COST
+func LoadAuthConfigFromEnv() (*AuthConfig, error) {
+	config := &AuthConfig{
+		TokenTTL:        defaultTokenTTL,
+		RefreshTokenTTL: defaultRefreshTokenTTL,
+		Issuer:          os.Getenv("JWT_ISSUER"),
+		Audience:        os.Getenv("JWT_AUDIENCE"),
+		MaxFailedLogins: defaultMaxFailedLogins,
+		LockoutWindow:   defaultLockoutWindow,
+		PasswordPolicy:  DefaultPasswordPolicy,
+		BcryptCost:      defaultBcryptCost,
+	}
+
+	switch method := os.Getenv("JWT_SIGNING_METHOD"); method {
+	case "", "HS256":
+		config.SigningMethod = jwt.SigningMethodHS256
+		config.HMACSecret = []byte(os.Getenv("JWT_SECRET"))
+	case "RS256":
+		config.SigningMethod = jwt.SigningMethodRS256
+		keyPath := os.Getenv("JWT_RSA_PRIVATE_KEY_PATH")
+		if keyPath == "" {
+			return nil, errors.New("JWT_RSA_PRIVATE_KEY_PATH must be set for RS256")
+		}
+		keyData, err := ioutil.ReadFile(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read RSA private key: %w", err)
+		}
+		config.RSAPrivateKey, err = jwt.ParseRSAPrivateKeyFromPEM(keyData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RSA private key: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWT signing method: %s", method)
+	}
+
+	if ttl := os.Getenv("JWT_TOKEN_TTL"); ttl != "" {
+		parsed, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT_TOKEN_TTL: %w", err)
+		}
+		config.TokenTTL = parsed
+	}
+	if ttl := os.Getenv("JWT_REFRESH_TOKEN_TTL"); ttl != "" {
+		parsed, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT_REFRESH_TOKEN_TTL: %w", err)
+		}
+		config.RefreshTokenTTL = parsed
+	}
+	if maxFailures := os.Getenv("LOGIN_MAX_FAILURES"); maxFailures != "" {
+		parsed, err := strconv.Atoi(maxFailures)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LOGIN_MAX_FAILURES: %w", err)
+		}
+		config.MaxFailedLogins = parsed
+	}
+	if window := os.Getenv("LOGIN_LOCKOUT_WINDOW"); window != "" {
+		parsed, err := time.ParseDuration(window)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LOGIN_LOCKOUT_WINDOW: %w", err)
+		}
+		config.LockoutWindow = parsed
+	}
+	if minLength := os.Getenv("PASSWORD_MIN_LENGTH"); minLength != "" {
+		parsed, err := strconv.Atoi(minLength)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PASSWORD_MIN_LENGTH: %w", err)
+		}
+		config.PasswordPolicy.MinLength = parsed
+	}
+	if cost := os.Getenv("BCRYPT_COST"); cost != "" {
+		parsed, err := strconv.Atoi(cost)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BCRYPT_COST: %w", err)
+		}
+		config.BcryptCost = parsed
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate ensures a signing key matching the signing method is present
+func (c *AuthConfig) Validate() error {
+	switch c.SigningMethod {
+	case jwt.SigningMethodHS256:
+		if len(c.HMACSecret) == 0 {
+			return errors.New("no JWT signing secret provided for HS256")
+		}
+	case jwt.SigningMethodRS256:
+		if c.RSAPrivateKey == nil {
+			return errors.New("no RSA private key provided for RS256")
+		}
+	default:
+		return errors.New("unsupported or missing JWT signing method")
+	}
+	if c.TokenTTL <= 0 {
+		return errors.New("token TTL must be positive")
+	}
+	if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return nil
+}
+
+// signingKey returns the key used to sign new tokens
+func (c *AuthConfig) signingKey() interface{} {
+	if c.SigningMethod == jwt.SigningMethodRS256 {
+		return c.RSAPrivateKey
+	}
+	return c.HMACSecret
+}
+
+// verificationKey is the jwt.Keyfunc for parsing tokens; it rejects tokens signed with another algorithm
+func (c *AuthConfig) verificationKey(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != c.SigningMethod.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	if c.SigningMethod == jwt.SigningMethodRS256 {
+		return &c.RSAPrivateKey.PublicKey, nil
+	}
+	return c.HMACSecret, nil
+}
+
+// signToken stamps the registered claims (iss, aud, iat, nbf, jti) and signs the token.
+// Each signed token receives a fresh jti.
+func (c *AuthConfig) signToken(claims *Claims) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().Unix()
+	claims.Issuer = c.Issuer
+	claims.Audience = c.Audience
+	claims.IssuedAt = now
+	claims.NotBefore = now
+	claims.Id = jti
+
+	token := jwt.NewWithClaims(c.SigningMethod, claims)
+	return token.SignedString(c.signingKey())
+}
+
+// deniedTokenIDs holds the jti of every access token invalidated by logout
+var deniedTokenIDs = newRevocationList()
+
+// parseToken verifies a token's signature, expiry, issuer, audience and denylist status and returns its claims
+func (c *AuthConfig) parseToken(tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+	tkn, err := jwt.ParseWithClaims(tokenStr, claims, c.verificationKey)
+	if err != nil {
+		return nil, err
+	}
+	if !tkn.Valid {
+		return nil, errors.New("invalid token")
+	}
+	if c.Issuer != "" && !claims.VerifyIssuer(c.Issuer, true) {
+		return nil, errors.New("unexpected token issuer")
+	}
+	if c.Audience != "" && !claims.VerifyAudience(c.Audience, true) {
+		return nil, errors.New("unexpected token audience")
+	}
+	if claims.Id != "" && deniedTokenIDs.Contains(claims.Id) {
+		return nil, errors.New("token has been revoked")
+	}
+	return claims, nil
+}
 
 // User struct for storing user details
 type User struct {
@@ -23,16 +280,126 @@ type User struct {
 
 // Claims struct for JWT payload
 type Claims struct {
-	Username string `json:"username"`
+	Username string   `json:"username"`
+	Roles    []string `json:"roles,omitempty"`
 	jwt.StandardClaims
 }
 
-// User database simulation
-var userDB = map[string]string{}
+// defaultRoles are granted to newly registered users
+var defaultRoles = []string{"user"}
+
+// hasRole reports whether the claims grant the given role
+func (c *Claims) hasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// ErrUserExists is returned when registering a username that is already taken
+	ErrUserExists = errors.New("user already exists")
+	// ErrUserNotFound is returned when looking up an unknown username
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// UserStore persists user credentials for the auth server
+type UserStore interface {
+	// CreateUser stores a new user, returning ErrUserExists if the username is taken
+	CreateUser(username, passwordHash string) error
+	// GetPasswordHash returns the stored password hash, or ErrUserNotFound
+	GetPasswordHash(username string) (string, error)
+	// UserExists reports whether the username is registered
+	UserExists(username string) bool
+	// GetRoles returns the roles granted to a user, or ErrUserNotFound
+	GetRoles(username string) ([]string, error)
+	// SetRoles replaces the roles granted to a user
+	SetRoles(username string, roles []string) error
+}
+
+// userRecord is a stored user in the InMemoryUserStore
+type userRecord struct {
+	passwordHash string
+	roles        []string
+}
+
+// InMemoryUserStore is a mutex-guarded, map-backed UserStore
+type InMemoryUserStore struct {
+	mu    sync.RWMutex
+	users map[string]*userRecord
+}
+
+// NewInMemoryUserStore creates an empty InMemoryUserStore
+func NewInMemoryUserStore() *InMemoryUserStore {
+	return &InMemoryUserStore{users: make(map[string]*userRecord)}
+}
+
+// CreateUser stores a new user atomically with the default roles
+func (s *InMemoryUserStore) CreateUser(username, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[username]; exists {
+		return ErrUserExists
+	}
+	s.users[username] = &userRecord{
+		passwordHash: passwordHash,
+		roles:        append([]string(nil), defaultRoles...),
+	}
+	return nil
+}
+
+// GetPasswordHash returns the stored password hash for a user
+func (s *InMemoryUserStore) GetPasswordHash(username string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return "", ErrUserNotFound
+	}
+	return user.passwordHash, nil
+}
+
+// GetRoles returns a copy of the roles granted to a user
+func (s *InMemoryUserStore) GetRoles(username string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return append([]string(nil), user.roles...), nil
+}
+
+// SetRoles replaces the roles granted to a user
+func (s *InMemoryUserStore) SetRoles(username string, roles []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.roles = append([]string(nil), roles...)
+	return nil
+}
+
+// UserExists reports whether a user is registered
+func (s *InMemoryUserStore) UserExists(username string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.users[username]
+	return ok
+}
 
 // Helper function to create a password hash
-func hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+func hashPassword(password string, cost int) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), cost)
 	return string(bytes), err
 }
 
@@ -42,63 +409,122 @@ func checkPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
+// authServer holds the configuration and state shared by the authentication handlers
+type authServer struct {
+	config        *AuthConfig
+	users         UserStore
+	refreshTokens *RefreshTokenStore
+	limiter       *LoginAttemptLimiter
+}
+
 // Register endpoint to add new users
-func registerHandler(w http.ResponseWriter, r *http.Request) {
+func (s *authServer) registerHandler(w http.ResponseWriter, r *http.Request) {
 	var user User
 	err := json.NewDecoder(r.Body).Decode(&user)
 	if err != nil {
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
-	if _, exists := userDB[user.Username]; exists {
+	if s.users.UserExists(user.Username) {
 		http.Error(w, "User already exists", http.StatusConflict)
 		return
 	}
-	hashedPassword, err := hashPassword(user.Password)
+	if err := s.config.PasswordPolicy.Validate(user.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hashedPassword, err := hashPassword(user.Password, s.config.BcryptCost)
 	if err != nil {
 		http.Error(w, "Error hashing password", http.StatusInternalServerError)
 		return
 	}
-	userDB[user.Username] = hashedPassword
+	// CreateUser re-checks existence atomically in case of a concurrent registration
+	if err := s.users.CreateUser(user.Username, hashedPassword); err != nil {
+		if err == ErrUserExists {
+			http.Error(w, "User already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error storing user", http.StatusInternalServerError)
+		return
+	}
 	w.WriteHeader(http.StatusCreated)
 }
 
-// Login endpoint to authenticate users and return JWT
-func loginHandler(w http.ResponseWriter, r *http.Request) {
+// TokenResponse is returned by endpoints that issue a refresh token
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// issueAccessToken signs a new access token for a user and sets it as the token cookie
+func (s *authServer) issueAccessToken(w http.ResponseWriter, username string, roles []string) (string, error) {
+	expirationTime := time.Now().Add(s.config.TokenTTL)
+	claims := &Claims{
+		Username: username,
+		Roles:    roles,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: expirationTime.Unix(),
+		},
+	}
+	tokenString, err := s.config.signToken(claims)
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:    "token",
+		Value:   tokenString,
+		Expires: expirationTime,
+	})
+	return tokenString, nil
+}
+
+// Login endpoint to authenticate users and return JWT along with an opaque refresh token
+func (s *authServer) loginHandler(w http.ResponseWriter, r *http.Request) {
 	var user User
 	err := json.NewDecoder(r.Body).Decode(&user)
 	if err != nil {
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
-	storedPassword, ok := userDB[user.Username]
-	if !ok || !checkPasswordHash(user.Password, storedPassword) {
+	if retryAfter, locked := s.limiter.Locked(user.Username); locked {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, "Account temporarily locked", http.StatusTooManyRequests)
+		return
+	}
+	storedPassword, err := s.users.GetPasswordHash(user.Username)
+	if err != nil || !checkPasswordHash(user.Password, storedPassword) {
+		s.limiter.RecordFailure(user.Username)
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
-	// Create JWT token
-	expirationTime := time.Now().Add(5 * time.Minute)
-	claims := &Claims{
-		Username: user.Username,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-		},
+	s.limiter.Reset(user.Username)
+	roles, err := s.users.GetRoles(user.Username)
+	if err != nil {
+		http.Error(w, "Error loading user roles", http.StatusInternalServerError)
+		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	// Create JWT token
+	tokenString, err := s.issueAccessToken(w, user.Username, roles)
 	if err != nil {
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:    "token",
-		Value:   tokenString,
-		Expires: expirationTime,
+	refreshToken, err := s.refreshTokens.Issue(user.Username)
+	if err != nil {
+		http.Error(w, "Error generating refresh token", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TokenResponse{
+		AccessToken:  tokenString,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.config.TokenTTL.Seconds()),
 	})
 }
 
 // Middleware to authenticate and authorize users
-func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+func (s *authServer) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		c, err := r.Cookie("token")
 		if err != nil {
@@ -110,25 +536,51 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 		tokenStr := c.Value
-		claims := &Claims{}
-		tkn, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
-		if err != nil || !tkn.Valid {
+		claims, err := s.config.parseToken(tokenStr)
+		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		next(w, r)
+		next(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey, claims)))
 	}
 }
 
+// contextKey is the type for request context keys set by this server
+type contextKey string
+
+// claimsContextKey holds the authenticated *Claims in the request context
+const claimsContextKey contextKey = "claims"
+
+// claimsFromContext returns the claims stored by authMiddleware, if any
+func claimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*Claims)
+	return claims, ok
+}
+
+// Middleware to authenticate users and require a role, returning 403 if it is missing
+func (s *authServer) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return s.authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := claimsFromContext(r.Context())
+		if !ok || !claims.hasRole(role) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
+
 // Protected endpoint that requires JWT authentication
 func protectedHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Protected content"))
 }
 
-// Refresh token endpoint
-func refreshHandler(w http.ResponseWriter, r *http.Request) {
+// Admin endpoint that requires the admin role
+func adminHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("Admin content"))
+}
+
+// Refresh token endpoint; the parsed claims, including roles, are carried into the new token
+func (s *authServer) refreshHandler(w http.ResponseWriter, r *http.Request) {
 	c, err := r.Cookie("token")
 	if err != nil {
 		if err == http.ErrNoCookie {
@@ -139,11 +591,8 @@ func refreshHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	tokenStr := c.Value
-	claims := &Claims{}
-	tkn, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-	if err != nil || !tkn.Valid {
+	claims, err := s.config.parseToken(tokenStr)
+	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -152,10 +601,9 @@ func refreshHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Token not expired yet", http.StatusBadRequest)
 		return
 	}
-	expirationTime := time.Now().Add(5 * time.Minute)
+	expirationTime := time.Now().Add(s.config.TokenTTL)
 	claims.ExpiresAt = expirationTime.Unix()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	tokenString, err := s.config.signToken(claims)
 	if err != nil {
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
@@ -167,8 +615,49 @@ func refreshHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// Logout endpoint to clear JWT token
+// Refresh token rotation endpoint: exchanges an opaque refresh token for a new
+// access token and a new refresh token, invalidating the one presented
+func (s *authServer) rotateRefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	username, refreshToken, err := s.refreshTokens.Rotate(req.RefreshToken)
+	if err != nil {
+		if err == ErrRefreshTokenInvalid || err == ErrRefreshTokenExpired || err == ErrRefreshTokenReused {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Error rotating refresh token", http.StatusInternalServerError)
+		return
+	}
+	// Roles are reloaded so the new access token reflects any changes since login
+	roles, err := s.users.GetRoles(username)
+	if err != nil {
+		http.Error(w, "Error loading user roles", http.StatusInternalServerError)
+		return
+	}
+	tokenString, err := s.issueAccessToken(w, username, roles)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TokenResponse{
+		AccessToken:  tokenString,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.config.TokenTTL.Seconds()),
+	})
+}
+
+// Logout endpoint to clear JWT token and denylist its jti for the rest of its lifetime
 func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if claims, ok := claimsFromContext(r.Context()); ok && claims.Id != "" {
+		deniedTokenIDs.Add(claims.Id, time.Unix(claims.ExpiresAt, 0))
+	}
 	http.SetCookie(w, &http.Cookie{
 		Name:    "token",
 		Value:   "",
@@ -182,20 +671,24 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Welcome to the Authentication Server"))
 }
 
-func main() {
-	// Setting up routes
-	http.HandleFunc("/register", registerHandler)
-	http.HandleFunc("/login", loginHandler)
-	http.HandleFunc("/logout", authMiddleware(logoutHandler))
-	http.HandleFunc("/refresh", authMiddleware(refreshHandler))
-	http.HandleFunc("/protected", authMiddleware(protectedHandler))
-	http.HandleFunc("/", homeHandler)
-
-	// Starting server
-	port := "8080"
-	if os.Getenv("PORT") != "" {
-		port = os.Getenv("PORT")
+// NewServeMux returns the authentication server's routes, signing and verifying tokens
+// with config and backed by an in-memory user store
+func NewServeMux(config *AuthConfig) *http.ServeMux {
+	s := &authServer{
+		config:        config,
+		users:         NewInMemoryUserStore(),
+		refreshTokens: NewRefreshTokenStore(config.RefreshTokenTTL),
+		limiter:       NewLoginAttemptLimiter(config.MaxFailedLogins, config.LockoutWindow),
 	}
-	fmt.Printf("Authentication server running on port %s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", s.registerHandler)
+	mux.HandleFunc("/login", s.loginHandler)
+	mux.HandleFunc("/logout", s.authMiddleware(logoutHandler))
+	mux.HandleFunc("/refresh", s.authMiddleware(s.refreshHandler))
+	mux.HandleFunc("/token/refresh", s.rotateRefreshTokenHandler)
+	mux.HandleFunc("/protected", s.authMiddleware(protectedHandler))
+	mux.HandleFunc("/admin", s.requireRole("admin", adminHandler))
+	mux.HandleFunc("/", homeHandler)
+	return mux
 }
@@ -0,0 +1,124 @@
+package authentication
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// defaultMaxFailedLogins is the number of failures within the window that locks an account
+	defaultMaxFailedLogins = 5
+	// defaultLockoutWindow is both the failure counting window and the lockout duration
+	defaultLockoutWindow = 15 * time.Minute
+	// loginAttemptsSweepInterval is how often stale failure counts are removed
+	loginAttemptsSweepInterval = time.Minute
+)
+
+// loginAttempts tracks recent failed logins for one username
+type loginAttempts struct {
+	failures    int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+// stale reports whether the failures no longer count at now and no lockout is in effect
+func (a *loginAttempts) stale(now time.Time, window time.Duration) bool {
+	return now.Sub(a.windowStart) > window && !now.Before(a.lockedUntil)
+}
+
+// LoginAttemptLimiter locks accounts after too many failed logins within a window
+type LoginAttemptLimiter struct {
+	mu          sync.Mutex
+	attempts    map[string]*loginAttempts
+	maxFailures int
+	window      time.Duration
+	lastPrune   time.Time
+	sweepOnce   sync.Once
+}
+
+// NewLoginAttemptLimiter creates a limiter that locks an account for window after
+// maxFailures failed logins within window
+func NewLoginAttemptLimiter(maxFailures int, window time.Duration) *LoginAttemptLimiter {
+	if maxFailures <= 0 {
+		maxFailures = defaultMaxFailedLogins
+	}
+	if window <= 0 {
+		window = defaultLockoutWindow
+	}
+	return &LoginAttemptLimiter{
+		attempts:    make(map[string]*loginAttempts),
+		maxFailures: maxFailures,
+		window:      window,
+	}
+}
+
+// Locked reports whether the account is locked and how long until it is released
+func (l *LoginAttemptLimiter) Locked(username string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	attempt, ok := l.attempts[username]
+	if !ok || attempt.lockedUntil.IsZero() {
+		return 0, false
+	}
+	remaining := time.Until(attempt.lockedUntil)
+	if remaining <= 0 {
+		// The lockout has elapsed; start counting afresh
+		delete(l.attempts, username)
+		return 0, false
+	}
+	return remaining, true
+}
+
+// RecordFailure counts a failed login and locks the account once the threshold is reached.
+// Stale failure counts of other usernames are pruned at most once per window, and by a
+// sweeper started on first use.
+func (l *LoginAttemptLimiter) RecordFailure(username string) {
+	l.sweepOnce.Do(func() { go l.sweep(loginAttemptsSweepInterval) })
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastPrune) > l.window {
+		l.pruneLocked(now)
+	}
+	attempt, ok := l.attempts[username]
+	if !ok || now.Sub(attempt.windowStart) > l.window {
+		attempt = &loginAttempts{windowStart: now}
+		l.attempts[username] = attempt
+	}
+	attempt.failures++
+	if attempt.failures >= l.maxFailures {
+		attempt.lockedUntil = now.Add(l.window)
+	}
+}
+
+// Reset clears the failure count after a successful login
+func (l *LoginAttemptLimiter) Reset(username string) {
+	l.mu.Lock()
+	delete(l.attempts, username)
+	l.mu.Unlock()
+}
+
+// pruneLocked removes the stale failure counts at now; l.mu must be held
+func (l *LoginAttemptLimiter) pruneLocked(now time.Time) {
+	for username, attempt := range l.attempts {
+		if attempt.stale(now, l.window) {
+			delete(l.attempts, username)
+		}
+	}
+	l.lastPrune = now
+}
+
+// sweep periodically removes failure counts of usernames that stopped failing
+func (l *LoginAttemptLimiter) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		l.mu.Lock()
+		l.pruneLocked(now)
+		l.mu.Unlock()
+	}
+}
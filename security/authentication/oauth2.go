@@ -1,16 +1,21 @@
-package main
+package authentication
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math/big"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
+	"time"
 )
 
 // OAuth2Config holds the OAuth 2.0 configuration
@@ -20,7 +25,60 @@ type OAuth2Config struct {
 	RedirectURI  string
 	AuthURL      string
 	TokenURL     string
+	UserInfoURL  string
 	Scope        string
+	// IntrospectURL is the RFC 7662 token introspection endpoint
+	IntrospectURL string
+	// IntrospectionCacheTTL is how long an active introspection result is reused
+	IntrospectionCacheTTL time.Duration
+	// HTTPClient is used for outbound calls to the provider; a client with
+	// HTTPTimeout (or DefaultHTTPTimeout) is used when nil
+	HTTPClient *http.Client
+	// HTTPTimeout bounds each outbound request to the provider
+	HTTPTimeout time.Duration
+	// AllowedRedirectURIs lists the registered redirect URIs; when empty only RedirectURI is accepted
+	AllowedRedirectURIs []string
+}
+
+// isAllowedRedirectURI reports whether uri exactly matches a registered redirect URI
+func (c OAuth2Config) isAllowedRedirectURI(uri string) bool {
+	if len(c.AllowedRedirectURIs) == 0 {
+		return uri == c.RedirectURI
+	}
+	for _, allowed := range c.AllowedRedirectURIs {
+		if uri == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveRedirectURI returns the presented redirect URI, or the configured one when none was presented
+func (c OAuth2Config) resolveRedirectURI(r *http.Request) (string, bool) {
+	redirectURI := r.URL.Query().Get("redirect_uri")
+	if redirectURI == "" {
+		redirectURI = c.RedirectURI
+	}
+	return redirectURI, c.isAllowedRedirectURI(redirectURI)
+}
+
+// DefaultHTTPTimeout bounds outbound provider requests when no timeout is configured
+const DefaultHTTPTimeout = 10 * time.Second
+
+// httpClient returns the configured HTTP client or a default one with a timeout
+func (c OAuth2Config) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return &http.Client{Timeout: c.requestTimeout()}
+}
+
+// requestTimeout returns the configured per-request timeout or DefaultHTTPTimeout
+func (c OAuth2Config) requestTimeout() time.Duration {
+	if c.HTTPTimeout > 0 {
+		return c.HTTPTimeout
+	}
+	return DefaultHTTPTimeout
 }
 
 // OAuth2Token represents the access and refresh tokens
@@ -31,60 +89,267 @@ type OAuth2Token struct {
 	TokenType    string
 }
 
-// sessionStore stores OAuth2 states for CSRF protection (in-memory for simplicity)
-var sessionStore = struct {
-	sync.Mutex
-	state map[string]bool
-}{state: make(map[string]bool)}
+// OAuth2Error is the RFC 6749 error response body
+type OAuth2Error struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// writeOAuth2Error writes an RFC 6749 JSON error response
+func writeOAuth2Error(w http.ResponseWriter, errorCode, description string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(OAuth2Error{Error: errorCode, ErrorDescription: description})
+}
+
+// TokenEndpointError is returned when the token endpoint rejects a grant with a non-200 status
+type TokenEndpointError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *TokenEndpointError) Error() string {
+	return fmt.Sprintf("token endpoint returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// writeTokenExchangeError maps a failed grant to an RFC 6749 error response
+func writeTokenExchangeError(w http.ResponseWriter, err error) {
+	var endpointErr *TokenEndpointError
+	if errors.As(err, &endpointErr) && endpointErr.StatusCode >= 400 && endpointErr.StatusCode < 500 {
+		writeOAuth2Error(w, "invalid_grant", "the authorization grant was rejected by the provider", http.StatusBadRequest)
+		return
+	}
+	writeOAuth2Error(w, "server_error", "failed to contact the token endpoint", http.StatusInternalServerError)
+}
+
+// DefaultStateTTL bounds how long a generated state remains valid unless overridden
+const DefaultStateTTL = 10 * time.Minute
+
+// stateSweepInterval is how often expired states are removed from the in-memory store
+const stateSweepInterval = time.Minute
+
+var (
+	// ErrInvalidState is returned when a state was never issued or was already consumed
+	ErrInvalidState = errors.New("invalid state")
+	// ErrStateExpired is returned when a state is presented after its TTL elapsed
+	ErrStateExpired = errors.New("state expired")
+)
+
+// StateStore persists OAuth2 states for CSRF protection between the authorize and
+// token steps, along with the PKCE code verifier generated for each state.
+// Implementations must be safe for concurrent use.
+type StateStore interface {
+	// Save stores a state and its code verifier for at most ttl
+	Save(state, codeVerifier string, ttl time.Duration)
+	// Consume removes a state and returns its code verifier, or ErrInvalidState/ErrStateExpired
+	Consume(state string) (string, error)
+}
+
+// stateEntry is a stored state with its code verifier and expiry
+type stateEntry struct {
+	codeVerifier string
+	expiresAt    time.Time
+}
+
+// InMemoryStateStore is a map-backed StateStore for single-node deployments
+type InMemoryStateStore struct {
+	mu        sync.Mutex
+	state     map[string]stateEntry
+	sweepOnce sync.Once
+}
+
+// NewInMemoryStateStore creates an empty InMemoryStateStore
+func NewInMemoryStateStore() *InMemoryStateStore {
+	return &InMemoryStateStore{state: make(map[string]stateEntry)}
+}
+
+// Save stores a state and its code verifier, starting the expiry sweeper on first use
+func (s *InMemoryStateStore) Save(state, codeVerifier string, ttl time.Duration) {
+	s.sweepOnce.Do(func() { go s.sweep(stateSweepInterval) })
+
+	s.mu.Lock()
+	s.state[state] = stateEntry{codeVerifier: codeVerifier, expiresAt: time.Now().Add(ttl)}
+	s.mu.Unlock()
+}
+
+// Consume removes a state and returns its code verifier
+func (s *InMemoryStateStore) Consume(state string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.state[state]
+	if !ok {
+		return "", ErrInvalidState
+	}
+	delete(s.state, state)
+
+	if time.Now().After(entry.expiresAt) {
+		return "", ErrStateExpired
+	}
+	return entry.codeVerifier, nil
+}
+
+// sweep periodically removes states that were issued but never consumed
+func (s *InMemoryStateStore) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		s.mu.Lock()
+		for state, entry := range s.state {
+			if now.After(entry.expiresAt) {
+				delete(s.state, state)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// defaultStateStore backs the package-level helpers and handlers
+var defaultStateStore StateStore = NewInMemoryStateStore()
+
+// OAuth2Server wires the OAuth2 handlers to a configuration and a StateStore
+type OAuth2Server struct {
+	Config   OAuth2Config
+	Store    StateStore
+	StateTTL time.Duration
+
+	introspection *introspectionCache // active introspection results; nil disables caching
+}
+
+// NewOAuth2Server creates an OAuth2Server, falling back to an in-memory store when store is nil
+func NewOAuth2Server(config OAuth2Config, store StateStore) *OAuth2Server {
+	if store == nil {
+		store = NewInMemoryStateStore()
+	}
+	return &OAuth2Server{
+		Config:        config,
+		Store:         store,
+		StateTTL:      DefaultStateTTL,
+		introspection: newIntrospectionCache(),
+	}
+}
 
-// GenerateState generates a random state for OAuth2 flow and stores it
-func GenerateState() string {
+// randomState generates a random state value for the OAuth2 flow
+func randomState() (string, error) {
 	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	var result strings.Builder
 	for i := 0; i < 16; i++ {
-		num, _ := rand.Int(rand.Reader, big.NewInt(int64(len(letters))))
+		num, err := rand.Int(rand.Reader, big.NewInt(int64(len(letters))))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate state: %w", err)
+		}
 		result.WriteByte(letters[num.Int64()])
 	}
-	state := result.String()
+	return result.String(), nil
+}
 
-	// Store state in sessionStore for later validation
-	sessionStore.Lock()
-	sessionStore.state[state] = true
-	sessionStore.Unlock()
+// GenerateState generates a random state for the OAuth2 flow together with a PKCE pair. The
+// state is stored with the code verifier for TokenHandler, and the code challenge is
+// returned to be sent with the authorization request.
+func (s *OAuth2Server) GenerateState() (state, challenge string, err error) {
+	state, err = randomState()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, challenge, err := GeneratePKCEChallenge()
+	if err != nil {
+		return "", "", err
+	}
+
+	// Store state for later validation
+	s.Store.Save(state, verifier, s.StateTTL)
 
-	return state
+	return state, challenge, nil
 }
 
-// OAuth2AuthorizeHandler handles the authorization request
-func OAuth2AuthorizeHandler(config OAuth2Config) http.HandlerFunc {
+// GenerateState generates a random state and PKCE pair, storing them in the default state store
+func GenerateState() (state, challenge string, err error) {
+	return NewOAuth2Server(OAuth2Config{}, defaultStateStore).GenerateState()
+}
+
+// GeneratePKCEChallenge generates a PKCE code verifier and its S256 code challenge (RFC 7636)
+func GeneratePKCEChallenge() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("failed to generate code verifier: %w", err)
+	}
+	verifier := base64.RawURLEncoding.EncodeToString(buf)
+
+	hash := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(hash[:])
+
+	return verifier, challenge, nil
+}
+
+// AuthorizeHandler handles the authorization request
+func (s *OAuth2Server) AuthorizeHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		state := GenerateState()
-		authURL := fmt.Sprintf("%s?response_type=code&client_id=%s&redirect_uri=%s&scope=%s&state=%s",
-			config.AuthURL, config.ClientID, config.RedirectURI, config.Scope, state)
+		if s.Config.AuthURL == "" || s.Config.ClientID == "" {
+			writeOAuth2Error(w, "server_error", "authorization endpoint is not configured", http.StatusInternalServerError)
+			return
+		}
+
+		redirectURI, allowed := s.Config.resolveRedirectURI(r)
+		if !allowed {
+			writeOAuth2Error(w, "invalid_request", "redirect_uri is not registered", http.StatusBadRequest)
+			return
+		}
+
+		state, challenge, err := s.GenerateState()
+		if err != nil {
+			log.Printf("OAuth2 authorization failed: %v", err)
+			writeOAuth2Error(w, "server_error", "failed to start authorization", http.StatusInternalServerError)
+			return
+		}
+
+		authURL := fmt.Sprintf("%s?response_type=code&client_id=%s&redirect_uri=%s&scope=%s&state=%s&code_challenge=%s&code_challenge_method=S256",
+			s.Config.AuthURL, s.Config.ClientID, url.QueryEscape(redirectURI), s.Config.Scope, state, challenge)
 		http.Redirect(w, r, authURL, http.StatusFound)
 	}
 }
 
-// OAuth2TokenHandler exchanges authorization code for an access token
-func OAuth2TokenHandler(config OAuth2Config) http.HandlerFunc {
+// TokenHandler exchanges authorization code for an access token
+func (s *OAuth2Server) TokenHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		code := r.URL.Query().Get("code")
 		state := r.URL.Query().Get("state")
 
-		// Validate the state to prevent CSRF attacks
-		sessionStore.Lock()
-		_, validState := sessionStore.state[state]
-		if !validState {
-			sessionStore.Unlock()
-			http.Error(w, "Invalid state", http.StatusBadRequest)
+		// Reject unregistered redirect URIs before touching the state to close the open-redirect hole
+		redirectURI, allowed := s.Config.resolveRedirectURI(r)
+		if !allowed {
+			writeOAuth2Error(w, "invalid_request", "redirect_uri is not registered", http.StatusBadRequest)
 			return
 		}
-		delete(sessionStore.state, state) // Remove the state after validation
-		sessionStore.Unlock()
 
-		token, err := exchangeCodeForToken(config, code)
+		// Validate the state to prevent CSRF attacks; consuming it removes the state and its verifier
+		verifier, err := s.Store.Consume(state)
+		if err == ErrStateExpired {
+			writeOAuth2Error(w, "invalid_request", "state expired", http.StatusBadRequest)
+			return
+		}
 		if err != nil {
-			http.Error(w, "Failed to exchange token", http.StatusInternalServerError)
+			writeOAuth2Error(w, "invalid_request", "invalid state", http.StatusBadRequest)
+			return
+		}
+
+		if code == "" {
+			writeOAuth2Error(w, "invalid_request", "missing authorization code", http.StatusBadRequest)
+			return
+		}
+		if verifier == "" {
+			writeOAuth2Error(w, "invalid_request", "missing PKCE code verifier for state", http.StatusBadRequest)
+			return
+		}
+
+		config := s.Config
+		config.RedirectURI = redirectURI
+
+		token, err := exchangeCodeForToken(r.Context(), config, code, verifier)
+		if err != nil {
+			log.Printf("Token exchange failed: %v", err)
+			writeTokenExchangeError(w, err)
 			return
 		}
 
@@ -92,24 +357,53 @@ func OAuth2TokenHandler(config OAuth2Config) http.HandlerFunc {
 	}
 }
 
-// exchangeCodeForToken exchanges the authorization code for a token
-func exchangeCodeForToken(config OAuth2Config, code string) (OAuth2Token, error) {
-	data := fmt.Sprintf("grant_type=authorization_code&code=%s&redirect_uri=%s&client_id=%s&client_secret=%s",
-		code, config.RedirectURI, config.ClientID, config.ClientSecret)
+// OAuth2AuthorizeHandler handles the authorization request using the default state store
+func OAuth2AuthorizeHandler(config OAuth2Config) http.HandlerFunc {
+	return NewOAuth2Server(config, defaultStateStore).AuthorizeHandler()
+}
+
+// OAuth2TokenHandler exchanges authorization code for an access token using the default state store
+func OAuth2TokenHandler(config OAuth2Config) http.HandlerFunc {
+	return NewOAuth2Server(config, defaultStateStore).TokenHandler()
+}
+
+// exchangeCodeForToken exchanges the authorization code and PKCE code verifier for a token
+func exchangeCodeForToken(ctx context.Context, config OAuth2Config, code, codeVerifier string) (OAuth2Token, error) {
+	if codeVerifier == "" {
+		return OAuth2Token{}, errors.New("missing PKCE code verifier")
+	}
+
+	data := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {config.RedirectURI},
+		"client_id":     {config.ClientID},
+		"client_secret": {config.ClientSecret},
+		"code_verifier": {codeVerifier},
+	}.Encode()
+
+	// Respect cancellation of the incoming request while bounding the outbound call
+	ctx, cancel := context.WithTimeout(ctx, config.requestTimeout())
+	defer cancel()
 
-	req, err := http.NewRequest("POST", config.TokenURL, strings.NewReader(data))
+	req, err := http.NewRequestWithContext(ctx, "POST", config.TokenURL, strings.NewReader(data))
 	if err != nil {
 		return OAuth2Token{}, err
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := config.httpClient().Do(req)
 	if err != nil {
 		return OAuth2Token{}, err
 	}
 	defer resp.Body.Close()
 
+	// A mismatched code verifier is reported by the provider as an error response
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return OAuth2Token{}, &TokenEndpointError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
 	var token OAuth2Token
 	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
 		return OAuth2Token{}, err
@@ -118,8 +412,51 @@ func exchangeCodeForToken(config OAuth2Config, code string) (OAuth2Token, error)
 	return token, nil
 }
 
-// OAuth2TokenValidationHandler validates the access token
-func OAuth2TokenValidationHandler() http.HandlerFunc {
+// UserInfoError is returned by FetchUserInfo when the provider responds with a non-200 status
+type UserInfoError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *UserInfoError) Error() string {
+	return fmt.Sprintf("userinfo request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// FetchUserInfo retrieves the authenticated user's profile from the provider's userinfo endpoint
+func FetchUserInfo(config OAuth2Config, token OAuth2Token) (map[string]interface{}, error) {
+	if config.UserInfoURL == "" {
+		return nil, errors.New("userinfo URL is not configured")
+	}
+
+	req, err := http.NewRequest("GET", config.UserInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := config.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// A 401 here usually means the access token has expired or been revoked
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, &UserInfoError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var profile map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// TokenValidationHandler validates the access token
+func (s *OAuth2Server) TokenValidationHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if !strings.HasPrefix(authHeader, "Bearer ") {
@@ -128,7 +465,13 @@ func OAuth2TokenValidationHandler() http.HandlerFunc {
 		}
 
 		accessToken := strings.TrimPrefix(authHeader, "Bearer ")
-		if !validateToken(accessToken) {
+		valid, err := s.validateToken(accessToken)
+		if err != nil {
+			log.Printf("Token introspection failed: %v", err)
+			http.Error(w, "Failed to validate token", http.StatusInternalServerError)
+			return
+		}
+		if !valid {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
@@ -138,13 +481,167 @@ func OAuth2TokenValidationHandler() http.HandlerFunc {
 	}
 }
 
-// validateToken simulates token validation (for simplicity)
-func validateToken(token string) bool {
-	return token != "" // Validation logic
+// introspectionResponse holds the fields of an RFC 7662 introspection response we rely on
+type introspectionResponse struct {
+	Active bool  `json:"active"`
+	Exp    int64 `json:"exp"`
 }
 
-// OAuth2TokenRevocationHandler handles token revocation
-func OAuth2TokenRevocationHandler() http.HandlerFunc {
+// OAuth2TokenValidationHandler validates the access token with its own introspection cache
+func OAuth2TokenValidationHandler(config OAuth2Config) http.HandlerFunc {
+	return NewOAuth2Server(config, defaultStateStore).TokenValidationHandler()
+}
+
+// introspectionSweepInterval is how often expired introspection results are evicted
+const introspectionSweepInterval = time.Minute
+
+// introspectionCache caches active introspection results keyed by token hash, each with
+// its own expiry. A nil cache caches nothing.
+type introspectionCache struct {
+	mu        sync.Mutex
+	entries   map[string]time.Time
+	sweepOnce sync.Once
+}
+
+// newIntrospectionCache creates an empty introspectionCache
+func newIntrospectionCache() *introspectionCache {
+	return &introspectionCache{entries: make(map[string]time.Time)}
+}
+
+// Get reports whether an unexpired active result is cached for a token key
+func (c *introspectionCache) Get(key string, now time.Time) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cachedUntil, ok := c.entries[key]
+	if ok && now.After(cachedUntil) {
+		delete(c.entries, key)
+		return false
+	}
+	return ok
+}
+
+// Put caches an active result until cachedUntil, starting the sweeper on first use
+func (c *introspectionCache) Put(key string, cachedUntil time.Time) {
+	if c == nil {
+		return
+	}
+	c.sweepOnce.Do(func() { go c.sweep(introspectionSweepInterval) })
+
+	c.mu.Lock()
+	c.entries[key] = cachedUntil
+	c.mu.Unlock()
+}
+
+// Remove drops the cached result for a token key
+func (c *introspectionCache) Remove(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
+
+// sweep evicts results whose cache lifetime has passed, so tokens validated once and
+// never presented again don't accumulate
+func (c *introspectionCache) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		c.mu.Lock()
+		for key, cachedUntil := range c.entries {
+			if now.After(cachedUntil) {
+				delete(c.entries, key)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// validateToken rejects revoked tokens and checks the rest against the introspection endpoint,
+// reusing recent active results
+func (s *OAuth2Server) validateToken(token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+
+	key := HashClientSecret(token)
+	now := time.Now()
+
+	// Revoked tokens are rejected before consulting the cache or the provider
+	if revokedTokens.Contains(key) {
+		return false, nil
+	}
+
+	if s.introspection.Get(key, now) {
+		return true, nil
+	}
+
+	config := s.Config
+	result, err := introspectToken(config, token)
+	if err != nil {
+		return false, err
+	}
+
+	if !result.Active {
+		return false, nil
+	}
+	if result.Exp != 0 && now.Unix() >= result.Exp {
+		return false, nil
+	}
+
+	if config.IntrospectionCacheTTL > 0 {
+		cachedUntil := now.Add(config.IntrospectionCacheTTL)
+		// Never cache past the token's own expiry
+		if result.Exp != 0 && time.Unix(result.Exp, 0).Before(cachedUntil) {
+			cachedUntil = time.Unix(result.Exp, 0)
+		}
+		s.introspection.Put(key, cachedUntil)
+	}
+
+	return true, nil
+}
+
+// introspectToken calls the RFC 7662 introspection endpoint using the client credentials
+func introspectToken(config OAuth2Config, token string) (introspectionResponse, error) {
+	if config.IntrospectURL == "" {
+		return introspectionResponse{}, errors.New("introspection URL is not configured")
+	}
+
+	data := url.Values{"token": {token}, "token_type_hint": {"access_token"}}.Encode()
+
+	req, err := http.NewRequest("POST", config.IntrospectURL, strings.NewReader(data))
+	if err != nil {
+		return introspectionResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(config.ClientID, config.ClientSecret)
+
+	resp, err := config.httpClient().Do(req)
+	if err != nil {
+		return introspectionResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return introspectionResponse{}, fmt.Errorf("introspection endpoint returned status %d", resp.StatusCode)
+	}
+
+	var result introspectionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return introspectionResponse{}, err
+	}
+
+	return result, nil
+}
+
+// RevocationHandler handles token revocation
+func (s *OAuth2Server) RevocationHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if !strings.HasPrefix(authHeader, "Bearer ") {
@@ -153,7 +650,7 @@ func OAuth2TokenRevocationHandler() http.HandlerFunc {
 		}
 
 		accessToken := strings.TrimPrefix(authHeader, "Bearer ")
-		if err := revokeToken(accessToken); err != nil {
+		if err := s.revokeToken(accessToken); err != nil {
 			http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
 			return
 		}
@@ -163,9 +660,89 @@ func OAuth2TokenRevocationHandler() http.HandlerFunc {
 	}
 }
 
-// revokeToken simulates token revocation
-func revokeToken(token string) error {
-	log.Printf("Token revoked: %s", token)
+// OAuth2TokenRevocationHandler handles token revocation
+func OAuth2TokenRevocationHandler(config OAuth2Config) http.HandlerFunc {
+	return NewOAuth2Server(config, defaultStateStore).RevocationHandler()
+}
+
+// defaultRevocationTTL is how long a revoked token is remembered when its expiry is unknown
+const defaultRevocationTTL = 24 * time.Hour
+
+// revocationSweepInterval is how often expired revocation entries are evicted
+const revocationSweepInterval = time.Minute
+
+// revocationList is a concurrent set of revoked token keys (token hashes or JWT IDs),
+// each kept until the token's original expiry
+type revocationList struct {
+	mu        sync.RWMutex
+	entries   map[string]time.Time
+	sweepOnce sync.Once
+}
+
+// newRevocationList creates an empty revocationList
+func newRevocationList() *revocationList {
+	return &revocationList{entries: make(map[string]time.Time)}
+}
+
+// revokedTokens holds every token revoked through this server
+var revokedTokens = newRevocationList()
+
+// Add records a revoked token key until expiresAt, starting the sweeper on first use
+func (rl *revocationList) Add(key string, expiresAt time.Time) {
+	rl.sweepOnce.Do(func() { go rl.sweep(revocationSweepInterval) })
+
+	rl.mu.Lock()
+	rl.entries[key] = expiresAt
+	rl.mu.Unlock()
+}
+
+// Contains reports whether a token key has been revoked and has not yet expired
+func (rl *revocationList) Contains(key string) bool {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	expiresAt, ok := rl.entries[key]
+	return ok && time.Now().Before(expiresAt)
+}
+
+// sweep evicts revocation entries whose tokens would have expired anyway
+func (rl *revocationList) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		rl.mu.Lock()
+		for key, expiresAt := range rl.entries {
+			if now.After(expiresAt) {
+				delete(rl.entries, key)
+			}
+		}
+		rl.mu.Unlock()
+	}
+}
+
+// revokeToken adds the token to the revocation list until its original expiry
+func (s *OAuth2Server) revokeToken(token string) error {
+	if token == "" {
+		return errors.New("empty token")
+	}
+
+	key := HashClientSecret(token)
+
+	// Ask the provider when the token expires so the entry can be evicted afterwards
+	expiresAt := time.Now().Add(defaultRevocationTTL)
+	if s.Config.IntrospectURL != "" {
+		if result, err := introspectToken(s.Config, token); err != nil {
+			log.Printf("Could not determine expiry of revoked token, using default retention: %v", err)
+		} else if result.Exp != 0 {
+			expiresAt = time.Unix(result.Exp, 0)
+		}
+	}
+
+	revokedTokens.Add(key, expiresAt)
+	s.introspection.Remove(key)
+
+	log.Printf("Token revoked: %s", key)
 	return nil
 }
 
@@ -174,13 +751,14 @@ func OAuth2RefreshTokenHandler(config OAuth2Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		refreshToken := r.FormValue("refresh_token")
 		if refreshToken == "" {
-			http.Error(w, "Missing refresh token", http.StatusBadRequest)
+			writeOAuth2Error(w, "invalid_request", "missing refresh token", http.StatusBadRequest)
 			return
 		}
 
-		token, err := refreshAccessToken(config, refreshToken)
+		token, err := refreshAccessToken(r.Context(), config, refreshToken)
 		if err != nil {
-			http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+			log.Printf("Token refresh failed: %v", err)
+			writeTokenExchangeError(w, err)
 			return
 		}
 
@@ -189,23 +767,99 @@ func OAuth2RefreshTokenHandler(config OAuth2Config) http.HandlerFunc {
 }
 
 // refreshAccessToken exchanges the refresh token for a new access token
-func refreshAccessToken(config OAuth2Config, refreshToken string) (OAuth2Token, error) {
-	data := fmt.Sprintf("grant_type=refresh_token&refresh_token=%s&client_id=%s&client_secret=%s",
-		refreshToken, config.ClientID, config.ClientSecret)
+func refreshAccessToken(ctx context.Context, config OAuth2Config, refreshToken string) (OAuth2Token, error) {
+	data := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {config.ClientID},
+		"client_secret": {config.ClientSecret},
+	}.Encode()
+
+	// Respect cancellation of the incoming request while bounding the outbound call
+	ctx, cancel := context.WithTimeout(ctx, config.requestTimeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", config.TokenURL, strings.NewReader(data))
+	if err != nil {
+		return OAuth2Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	req, err := http.NewRequest("POST", config.TokenURL, strings.NewReader(data))
+	resp, err := config.httpClient().Do(req)
+	if err != nil {
+		return OAuth2Token{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return OAuth2Token{}, &TokenEndpointError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var token OAuth2Token
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return OAuth2Token{}, err
+	}
+
+	return token, nil
+}
+
+// OAuth2ClientCredentialsHandler issues a token for service-to-service callers via the client_credentials grant
+func OAuth2ClientCredentialsHandler(config OAuth2Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scopes := strings.Fields(r.FormValue("scope"))
+		if len(scopes) == 0 {
+			scopes = strings.Fields(config.Scope)
+		}
+
+		token, err := clientCredentialsToken(r.Context(), config, scopes)
+		if err != nil {
+			log.Printf("Client credentials grant failed: %v", err)
+			writeTokenExchangeError(w, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(token)
+	}
+}
+
+// ClientCredentialsToken requests a token for the client itself using the client_credentials grant
+func ClientCredentialsToken(config OAuth2Config, scopes []string) (OAuth2Token, error) {
+	return clientCredentialsToken(context.Background(), config, scopes)
+}
+
+// clientCredentialsToken posts the client_credentials grant to the token endpoint.
+// No redirect URI is involved since there is no user to send back.
+func clientCredentialsToken(ctx context.Context, config OAuth2Config, scopes []string) (OAuth2Token, error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {config.ClientID},
+		"client_secret": {config.ClientSecret},
+	}
+	if len(scopes) > 0 {
+		form.Set("scope", strings.Join(scopes, " "))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.requestTimeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", config.TokenURL, strings.NewReader(form.Encode()))
 	if err != nil {
 		return OAuth2Token{}, err
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := config.httpClient().Do(req)
 	if err != nil {
 		return OAuth2Token{}, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return OAuth2Token{}, &TokenEndpointError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
 	var token OAuth2Token
 	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
 		return OAuth2Token{}, err
@@ -223,19 +877,22 @@ func HashClientSecret(secret string) string {
 
 /* func main() {
 	config := OAuth2Config{
-		ClientID:     "client-id",
-		ClientSecret: "client-secret",
-		RedirectURI:  "http://localhost:8080/callback",
-		AuthURL:      "http://localhost:8080/oauth2/authorize",
-		TokenURL:     "http://localhost:8080/oauth2/token",
-		Scope:        "read write",
+		ClientID:              "client-id",
+		ClientSecret:          "client-secret",
+		RedirectURI:           "http://localhost:8080/callback",
+		AuthURL:               "http://localhost:8080/oauth2/authorize",
+		TokenURL:              "http://localhost:8080/oauth2/token",
+		IntrospectURL:         "http://localhost:8080/oauth2/introspect",
+		IntrospectionCacheTTL: 30 * time.Second,
+		Scope:                 "read write",
 	}
 
 	http.HandleFunc("/oauth2/authorize", OAuth2AuthorizeHandler(config))
 	http.HandleFunc("/oauth2/token", OAuth2TokenHandler(config))
-	http.HandleFunc("/oauth2/validate", OAuth2TokenValidationHandler())
-	http.HandleFunc("/oauth2/revoke", OAuth2TokenRevocationHandler())
+	http.HandleFunc("/oauth2/validate", OAuth2TokenValidationHandler(config))
+	http.HandleFunc("/oauth2/revoke", OAuth2TokenRevocationHandler(config))
 	http.HandleFunc("/oauth2/refresh", OAuth2RefreshTokenHandler(config))
+	http.HandleFunc("/oauth2/client_credentials", OAuth2ClientCredentialsHandler(config))
 
 	log.Println("OAuth 2.0 server started on :8080")
 	log.Fatal(http.ListenAndServe(":8080", nil))
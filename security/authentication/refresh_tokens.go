@@ -0,0 +1,170 @@
+package authentication
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultRefreshTokenTTL is used when no refresh token lifetime is configured
+	defaultRefreshTokenTTL = 24 * time.Hour
+	// refreshTokenSweepInterval is how often expired token families are removed
+	refreshTokenSweepInterval = 10 * time.Minute
+)
+
+var (
+	// ErrRefreshTokenInvalid is returned for unknown or revoked refresh tokens
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	// ErrRefreshTokenExpired is returned for refresh tokens past their expiry
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// refreshTokenRecord is the server-side state of an issued refresh token
+type refreshTokenRecord struct {
+	username  string
+	familyID  string
+	expiresAt time.Time
+	used      bool
+}
+
+// tokenFamily lists the tokens issued from one login. The family expires with its newest
+// token; rotated tokens are kept until then so their reuse is still detected.
+type tokenFamily struct {
+	keys      []string // token hashes
+	expiresAt time.Time
+}
+
+// RefreshTokenStore issues and rotates opaque refresh tokens. Tokens issued from the
+// same login share a family, so detecting reuse of a rotated token revokes the family.
+type RefreshTokenStore struct {
+	mu        sync.Mutex
+	tokens    map[string]*refreshTokenRecord // keyed by token hash
+	families  map[string]*tokenFamily        // keyed by family ID
+	ttl       time.Duration
+	sweepOnce sync.Once
+}
+
+// NewRefreshTokenStore creates an empty RefreshTokenStore issuing tokens valid for ttl
+func NewRefreshTokenStore(ttl time.Duration) *RefreshTokenStore {
+	if ttl <= 0 {
+		ttl = defaultRefreshTokenTTL
+	}
+	return &RefreshTokenStore{
+		tokens:   make(map[string]*refreshTokenRecord),
+		families: make(map[string]*tokenFamily),
+		ttl:      ttl,
+	}
+}
+
+// randomToken returns a URL-safe random string of n bytes of entropy
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Issue creates a refresh token for a user starting a new token family, starting the
+// expiry sweeper on first use
+func (s *RefreshTokenStore) Issue(username string) (string, error) {
+	s.sweepOnce.Do(func() { go s.sweep(refreshTokenSweepInterval) })
+
+	familyID, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issueLocked(username, familyID)
+}
+
+// issueLocked creates a refresh token in the given family; s.mu must be held
+func (s *RefreshTokenStore) issueLocked(username, familyID string) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	key := HashClientSecret(token)
+	record := &refreshTokenRecord{
+		username:  username,
+		familyID:  familyID,
+		expiresAt: time.Now().Add(s.ttl),
+	}
+	s.tokens[key] = record
+
+	family, ok := s.families[familyID]
+	if !ok {
+		family = &tokenFamily{}
+		s.families[familyID] = family
+	}
+	family.keys = append(family.keys, key)
+	family.expiresAt = record.expiresAt
+	return token, nil
+}
+
+// Rotate invalidates the presented refresh token and issues its successor in the same family.
+// Presenting a token that was already rotated revokes every token in its family.
+func (s *RefreshTokenStore) Rotate(token string) (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.tokens[HashClientSecret(token)]
+	if !ok {
+		return "", "", ErrRefreshTokenInvalid
+	}
+	if record.used {
+		log.Printf("Refresh token reuse detected for user %s, revoking token family", record.username)
+		s.revokeFamilyLocked(record.familyID)
+		return "", "", ErrRefreshTokenReused
+	}
+	if now := time.Now(); now.After(record.expiresAt) {
+		// Nothing in the family can be rotated any more once its newest token has expired
+		if family := s.families[record.familyID]; family == nil || now.After(family.expiresAt) {
+			s.revokeFamilyLocked(record.familyID)
+		}
+		return "", "", ErrRefreshTokenExpired
+	}
+
+	record.used = true
+	next, err := s.issueLocked(record.username, record.familyID)
+	if err != nil {
+		return "", "", err
+	}
+	return record.username, next, nil
+}
+
+// revokeFamilyLocked removes every token in a family; s.mu must be held
+func (s *RefreshTokenStore) revokeFamilyLocked(familyID string) {
+	if family, ok := s.families[familyID]; ok {
+		for _, key := range family.keys {
+			delete(s.tokens, key)
+		}
+	}
+	delete(s.families, familyID)
+}
+
+// sweep periodically removes the families whose newest token has expired, with every
+// token in them
+func (s *RefreshTokenStore) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		s.mu.Lock()
+		for familyID, family := range s.families {
+			if now.After(family.expiresAt) {
+				s.revokeFamilyLocked(familyID)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
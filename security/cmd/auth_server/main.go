@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"security/authentication"
+	"syscall"
+	"time"
+)
+
+// shutdownTimeout bounds how long in-flight requests may drain on shutdown
+const shutdownTimeout = 15 * time.Second
+
+func main() {
+	// Load the signing configuration, refusing to start without a key
+	config, err := authentication.LoadAuthConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid auth configuration: %v", err)
+	}
+
+	// Starting server
+	port := "8080"
+	if os.Getenv("PORT") != "" {
+		port = os.Getenv("PORT")
+	}
+	server := &http.Server{Addr: ":" + port, Handler: authentication.NewServeMux(config)}
+
+	go func() {
+		fmt.Printf("Authentication server running on port %s\n", port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Authentication server failed: %v", err)
+		}
+	}()
+
+	// Wait for an interrupt or SIGTERM, then drain in-flight requests
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	log.Println("Shutting down authentication server...")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Graceful shutdown failed: %v", err)
+	}
+}
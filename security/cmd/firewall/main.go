@@ -0,0 +1,40 @@
+package main
+
+import "security"
+
+func main() {
+	// Whitelisted IPs and Ports
+	whitelistedIPs := []string{"192.168.1.100", "10.0.0.5", "172.16.0.1", "fd00::/8"}
+	whitelistedPorts := []int{80, 443, 22}
+
+	// Initialize firewall
+	firewall := security.NewFirewall(whitelistedIPs, whitelistedPorts, "firewall_log.txt")
+	defer firewall.Close()
+
+	// Simulate network connections
+	firewall.SimulateConnection("192.168.1.100", 80)
+	firewall.SimulateConnection("192.168.1.101", 80)
+	firewall.SimulateConnection("192.168.1.100", 8080)
+	firewall.SimulateConnection("10.0.0.5", 443)
+
+	// Block and test blocking functionality
+	firewall.BlockIP("192.168.1.101")
+	firewall.SimulateConnection("192.168.1.101", 80)
+	firewall.SimulateConnection("192.168.1.100", 443)
+
+	// Manually unblock and recheck connection
+	firewall.UnblockIP("192.168.1.101")
+	firewall.SimulateConnection("192.168.1.101", 80)
+
+	// Block a range, then test an address inside it
+	firewall.BlockIP("192.168.1.0/24")
+	firewall.SimulateConnection("192.168.1.100", 443)
+	firewall.UnblockIP("192.168.1.0/24")
+	firewall.SimulateConnection("fd00::1", 22)
+
+	// Rate limit each IP and exceed the burst
+	firewall.SetRateLimit(2, 3)
+	for i := 0; i < 5; i++ {
+		firewall.SimulateConnection("10.0.0.5", 443)
+	}
+}
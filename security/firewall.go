@@ -1,28 +1,63 @@
-package main
+package security
 
 import (
 	"fmt"
+	"math"
+	"net"
 	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
+// IP entries are either exact addresses or CIDR ranges, IPv4 or IPv6. Ranges are keyed by
+// their canonical form, such as 10.0.0.0/8. A Firewall is safe for concurrent use.
 type Firewall struct {
+	mu               sync.RWMutex // guards the whitelists and blocklists
 	whitelistedIPs   map[string]bool
+	whitelistedNets  map[string]*net.IPNet
 	whitelistedPorts map[int]bool
 	blockedIPs       map[string]bool
-	logFile          *os.File
+	blockedNets      map[string]*net.IPNet
+
+	logMu   sync.Mutex // serializes log writes so entries never interleave
+	logFile *os.File
+
+	rateMu  sync.Mutex // guards the rate limit and buckets
+	rate    float64    // connections per second allowed from each IP; 0 disables rate limiting
+	burst   float64    // connections an IP may make at once
+	buckets map[string]*tokenBucket
+	pruned  time.Time // when idle buckets were last dropped
+}
+
+// tokenBucket tracks the connections an IP may still make; it refills at the firewall's
+// rate up to its burst
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
 }
 
-// Initialize a new firewall with whitelist IPs and Ports
+// Initialize a new firewall with whitelist IPs, given as addresses or CIDR ranges, and Ports
 func NewFirewall(whitelistedIPs []string, whitelistedPorts []int, logFilePath string) *Firewall {
 	fw := &Firewall{
 		whitelistedIPs:   make(map[string]bool),
+		whitelistedNets:  make(map[string]*net.IPNet),
 		whitelistedPorts: make(map[int]bool),
 		blockedIPs:       make(map[string]bool),
+		blockedNets:      make(map[string]*net.IPNet),
 	}
 	// Add whitelisted IPs
-	for _, ip := range whitelistedIPs {
-		fw.whitelistedIPs[ip] = true
+	for _, entry := range whitelistedIPs {
+		ip, network, err := parseIPEntry(entry)
+		if err != nil {
+			fmt.Println("Skipping whitelist entry:", err)
+			continue
+		}
+		if network != nil {
+			fw.whitelistedNets[network.String()] = network
+		} else {
+			fw.whitelistedIPs[ip] = true
+		}
 	}
 	// Add whitelisted Ports
 	for _, port := range whitelistedPorts {
@@ -43,83 +78,190 @@ func NewFirewall(whitelistedIPs []string, whitelistedPorts []int, logFilePath st
 func (fw *Firewall) logUnauthorizedAccess(ip string, port int, reason string) {
 	timestamp := time.Now().Format(time.RFC3339)
 	logEntry := fmt.Sprintf("%s - Unauthorized access from %s on port %d: %s\n", timestamp, ip, port, reason)
-	fw.logFile.WriteString(logEntry)
+	fw.logMu.Lock()
+	defer fw.logMu.Unlock()
+	if _, err := fw.logFile.WriteString(logEntry); err != nil {
+		fmt.Println("Error writing to log file:", err)
+	}
+}
+
+// Parse an address or CIDR range, returning the canonical address or the network
+func parseIPEntry(entry string) (string, *net.IPNet, error) {
+	if strings.Contains(entry, "/") {
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid CIDR range %q: %w", entry, err)
+		}
+		return "", network, nil
+	}
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return "", nil, fmt.Errorf("invalid IP address %q", entry)
+	}
+	return ip.String(), nil, nil
+}
+
+// Check whether an IP matches an exact entry or falls in any of the ranges
+func matchesIP(ip string, exact map[string]bool, networks map[string]*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	if exact[parsed.String()] {
+		return true
+	}
+	for _, network := range networks {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
 }
 
 // Check if IP is whitelisted
 func (fw *Firewall) isIPWhitelisted(ip string) bool {
-	return fw.whitelistedIPs[ip]
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+	return matchesIP(ip, fw.whitelistedIPs, fw.whitelistedNets)
 }
 
 // Check if Port is whitelisted
 func (fw *Firewall) isPortWhitelisted(port int) bool {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
 	return fw.whitelistedPorts[port]
 }
 
-// Block IP manually
-func (fw *Firewall) BlockIP(ip string) {
-	fw.blockedIPs[ip] = true
+// Block IP manually, given as an address or CIDR range
+func (fw *Firewall) BlockIP(entry string) {
+	ip, network, err := parseIPEntry(entry)
+	if err != nil {
+		fmt.Println("Cannot block:", err)
+		return
+	}
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if network != nil {
+		fw.blockedNets[network.String()] = network
+	} else {
+		fw.blockedIPs[ip] = true
+	}
 }
 
-// Unblock IP manually
-func (fw *Firewall) UnblockIP(ip string) {
-	delete(fw.blockedIPs, ip)
+// Unblock IP manually, given as the address or CIDR range it was blocked with. Unblocking
+// an address inside a blocked range leaves the range blocked.
+func (fw *Firewall) UnblockIP(entry string) {
+	ip, network, err := parseIPEntry(entry)
+	if err != nil {
+		fmt.Println("Cannot unblock:", err)
+		return
+	}
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if network != nil {
+		delete(fw.blockedNets, network.String())
+	} else {
+		delete(fw.blockedIPs, ip)
+	}
 }
 
 // Check if IP is blocked
 func (fw *Firewall) isIPBlocked(ip string) bool {
-	return fw.blockedIPs[ip]
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+	return matchesIP(ip, fw.blockedIPs, fw.blockedNets)
+}
+
+// SetRateLimit allows each source IP rps connections per second on average, with bursts of
+// up to burst connections. A burst below 1 defaults to rps, and an rps below 1 disables
+// rate limiting. Changing the limit resets every IP's allowance.
+func (fw *Firewall) SetRateLimit(rps, burst int) {
+	fw.rateMu.Lock()
+	defer fw.rateMu.Unlock()
+	if rps < 1 {
+		fw.rate, fw.burst, fw.buckets = 0, 0, nil
+		return
+	}
+	if burst < 1 {
+		burst = rps
+	}
+	fw.rate = float64(rps)
+	fw.burst = float64(burst)
+	fw.buckets = make(map[string]*tokenBucket)
+	fw.pruned = time.Time{}
+}
+
+// Take a token from the IP's bucket, reporting false if it has none left
+func (fw *Firewall) allowRate(ip string, now time.Time) bool {
+	fw.rateMu.Lock()
+	defer fw.rateMu.Unlock()
+	if fw.rate == 0 {
+		return true
+	}
+	bucket, ok := fw.buckets[ip]
+	if !ok {
+		fw.pruneBuckets(now)
+		bucket = &tokenBucket{tokens: fw.burst, last: now}
+		fw.buckets[ip] = bucket
+	}
+	bucket.tokens = math.Min(fw.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*fw.rate)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// Drop the buckets of IPs idle long enough to have refilled, which behave like new ones,
+// so the number of buckets stays bounded by the IPs seen recently. Runs at most once per
+// refill period; fw.rateMu must be held.
+func (fw *Firewall) pruneBuckets(now time.Time) {
+	refill := time.Duration(fw.burst / fw.rate * float64(time.Second))
+	if now.Sub(fw.pruned) < refill {
+		return
+	}
+	fw.pruned = now
+	for ip, bucket := range fw.buckets {
+		if now.Sub(bucket.last) >= refill {
+			delete(fw.buckets, ip)
+		}
+	}
 }
 
-// Simulate incoming network connections
-func (fw *Firewall) SimulateConnection(ip string, port int) {
+// Simulate incoming network connections, reporting whether the connection was allowed
+func (fw *Firewall) SimulateConnection(ip string, port int) bool {
 	if fw.isIPBlocked(ip) {
 		fmt.Printf("Connection from %s blocked.\n", ip)
 		fw.logUnauthorizedAccess(ip, port, "Blocked IP")
-		return
+		return false
 	}
 
 	if !fw.isIPWhitelisted(ip) {
 		fmt.Printf("Connection from %s not whitelisted.\n", ip)
 		fw.logUnauthorizedAccess(ip, port, "IP not whitelisted")
-		return
+		return false
+	}
+
+	if !fw.allowRate(ip, time.Now()) {
+		fmt.Printf("Connection from %s exceeds the rate limit.\n", ip)
+		fw.logUnauthorizedAccess(ip, port, "Rate limit exceeded")
+		return false
 	}
 
 	if !fw.isPortWhitelisted(port) {
 		fmt.Printf("Connection on port %d from %s is not whitelisted.\n", port, ip)
 		fw.logUnauthorizedAccess(ip, port, "Port not whitelisted")
-		return
+		return false
 	}
 
 	fmt.Printf("Connection from %s on port %d is allowed.\n", ip, port)
+	return true
 }
 
 // Close the log file
 func (fw *Firewall) Close() {
+	fw.logMu.Lock()
+	defer fw.logMu.Unlock()
 	fw.logFile.Close()
 }
-
-func main() {
-	// Whitelisted IPs and Ports
-	whitelistedIPs := []string{"192.168.1.100", "10.0.0.5", "172.16.0.1"}
-	whitelistedPorts := []int{80, 443, 22}
-
-	// Initialize firewall
-	firewall := NewFirewall(whitelistedIPs, whitelistedPorts, "firewall_log.txt")
-	defer firewall.Close()
-
-	// Simulate network connections
-	firewall.SimulateConnection("192.168.1.100", 80)
-	firewall.SimulateConnection("192.168.1.101", 80)
-	firewall.SimulateConnection("192.168.1.100", 8080)
-	firewall.SimulateConnection("10.0.0.5", 443)
-
-	// Block and test blocking functionality
-	firewall.BlockIP("192.168.1.101")
-	firewall.SimulateConnection("192.168.1.101", 80)
-	firewall.SimulateConnection("192.168.1.100", 443)
-
-	// Manually unblock and recheck connection
-	firewall.UnblockIP("192.168.1.101")
-	firewall.SimulateConnection("192.168.1.101", 80)
-}
@@ -0,0 +1,377 @@
+package security_tests
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"security"
+	"security/authentication"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Test case for concurrent user registrations against the in-memory user store
+func TestConcurrentRegistrations(t *testing.T) {
+	store := authentication.NewInMemoryUserStore()
+
+	const numUsers = 100
+	var wg sync.WaitGroup
+	errs := make(chan error, numUsers)
+
+	for i := 0; i < numUsers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			username := fmt.Sprintf("user-%d", i)
+			if err := store.CreateUser(username, fmt.Sprintf("hash-%d", i)); err != nil {
+				errs <- fmt.Errorf("registration of %s failed: %v", username, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for i := 0; i < numUsers; i++ {
+		username := fmt.Sprintf("user-%d", i)
+		if !store.UserExists(username) {
+			t.Errorf("Expected %s to exist after registration", username)
+			continue
+		}
+		hash, err := store.GetPasswordHash(username)
+		if err != nil {
+			t.Errorf("Failed to retrieve %s: %v", username, err)
+			continue
+		}
+		if hash != fmt.Sprintf("hash-%d", i) {
+			t.Errorf("Expected hash-%d for %s, got %s", i, username, hash)
+		}
+	}
+}
+
+// Test case for rejecting a duplicate registration raced from many goroutines
+func TestConcurrentDuplicateRegistration(t *testing.T) {
+	store := authentication.NewInMemoryUserStore()
+
+	const attempts = 100
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := store.CreateUser("admin", "hash"); err == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			} else if err != authentication.ErrUserExists {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Errorf("Expected exactly 1 successful registration, got %d", created)
+	}
+}
+
+// Test case for locking an account after repeated failures and releasing it after the window
+func TestLoginLockout(t *testing.T) {
+	window := 200 * time.Millisecond
+	limiter := authentication.NewLoginAttemptLimiter(3, window)
+
+	for i := 0; i < 2; i++ {
+		limiter.RecordFailure("alice")
+		if _, locked := limiter.Locked("alice"); locked {
+			t.Fatalf("Expected account to remain unlocked after %d failures", i+1)
+		}
+	}
+
+	limiter.RecordFailure("alice")
+	retryAfter, locked := limiter.Locked("alice")
+	if !locked {
+		t.Fatalf("Expected account to be locked after 3 failures")
+	}
+	if retryAfter <= 0 || retryAfter > window {
+		t.Errorf("Expected retry-after within (0, %v], got %v", window, retryAfter)
+	}
+
+	if _, locked := limiter.Locked("bob"); locked {
+		t.Errorf("Expected lockout to be scoped to the failing username")
+	}
+
+	time.Sleep(window + 50*time.Millisecond)
+	if _, locked := limiter.Locked("alice"); locked {
+		t.Errorf("Expected account to be released after the lockout window")
+	}
+}
+
+// Test case for resetting the failure count on a successful login
+func TestLoginLockoutResetOnSuccess(t *testing.T) {
+	limiter := authentication.NewLoginAttemptLimiter(3, time.Minute)
+
+	limiter.RecordFailure("alice")
+	limiter.RecordFailure("alice")
+	limiter.Reset("alice")
+	limiter.RecordFailure("alice")
+
+	if _, locked := limiter.Locked("alice"); locked {
+		t.Errorf("Expected failure count to reset after a successful login")
+	}
+}
+
+// Test case for each ServeMux signing and verifying tokens with its own configuration
+func TestServeMuxConfigIsolation(t *testing.T) {
+	newConfig := func(secret string) *authentication.AuthConfig {
+		return &authentication.AuthConfig{
+			SigningMethod:   jwt.SigningMethodHS256,
+			HMACSecret:      []byte(secret),
+			TokenTTL:        time.Minute,
+			RefreshTokenTTL: time.Hour,
+			MaxFailedLogins: 5,
+			LockoutWindow:   time.Minute,
+			BcryptCost:      bcrypt.MinCost,
+		}
+	}
+	first := authentication.NewServeMux(newConfig("first-secret"))
+	second := authentication.NewServeMux(newConfig("second-secret"))
+
+	credentials := `{"username":"alice","password":"Passw0rd!"}`
+	rec := httptest.NewRecorder()
+	first.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(credentials)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected the registration to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	first.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(credentials)))
+	cookies := rec.Result().Cookies()
+	if rec.Code != http.StatusOK || len(cookies) != 1 {
+		t.Fatalf("Expected the login to set a token cookie, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	protected := func(mux *http.ServeMux) int {
+		req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+		req.AddCookie(cookies[0])
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	// Creating the second mux must not change the key the first one verifies with
+	if code := protected(first); code != http.StatusOK {
+		t.Errorf("Expected the issuing mux to accept its token, got %d", code)
+	}
+	if code := protected(second); code != http.StatusUnauthorized {
+		t.Errorf("Expected a mux with another secret to reject the token, got %d", code)
+	}
+}
+
+// Test case for storing a PKCE code verifier matching the challenge returned with a state
+func TestGenerateStateStoresPKCEVerifier(t *testing.T) {
+	store := authentication.NewInMemoryStateStore()
+	server := authentication.NewOAuth2Server(authentication.OAuth2Config{}, store)
+
+	state, challenge, err := server.GenerateState()
+	if err != nil {
+		t.Fatalf("Failed to generate state: %v", err)
+	}
+	verifier, err := store.Consume(state)
+	if err != nil {
+		t.Fatalf("Expected the state to be stored: %v", err)
+	}
+	hash := sha256.Sum256([]byte(verifier))
+	if verifier == "" || base64.RawURLEncoding.EncodeToString(hash[:]) != challenge {
+		t.Errorf("Expected the stored verifier %q to match the challenge %q", verifier, challenge)
+	}
+}
+
+// Test case for form-encoding the token request so reserved characters reach the provider intact
+func TestTokenExchangeEncodesForm(t *testing.T) {
+	const code, secret = "a&b=c+d e", "s3cr&t=+"
+	received := make(chan url.Values, 1)
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		received <- r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"token"}`))
+	}))
+	defer provider.Close()
+
+	store := authentication.NewInMemoryStateStore()
+	server := authentication.NewOAuth2Server(authentication.OAuth2Config{
+		ClientID:     "client",
+		ClientSecret: secret,
+		RedirectURI:  "https://app.example.com/callback",
+		TokenURL:     provider.URL,
+	}, store)
+	state, _, err := server.GenerateState()
+	if err != nil {
+		t.Fatalf("Failed to generate state: %v", err)
+	}
+
+	query := url.Values{"code": {code}, "state": {state}}
+	rec := httptest.NewRecorder()
+	server.TokenHandler()(rec, httptest.NewRequest(http.MethodGet, "/oauth2/token?"+query.Encode(), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the exchange to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	form := <-received
+	if form.Get("code") != code || form.Get("client_secret") != secret || form.Get("grant_type") != "authorization_code" {
+		t.Errorf("Expected the provider to receive the code and secret verbatim, got %v", form)
+	}
+}
+
+// Test case for caching introspection results per server and dropping them on revocation
+func TestTokenValidationCache(t *testing.T) {
+	var mu sync.Mutex
+	introspections := 0
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		introspections++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"active":true}`))
+	}))
+	defer provider.Close()
+	calls := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return introspections
+	}
+
+	config := authentication.OAuth2Config{IntrospectURL: provider.URL, IntrospectionCacheTTL: time.Minute}
+	server := authentication.NewOAuth2Server(config, nil)
+	validate := func(server *authentication.OAuth2Server, token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/oauth2/validate", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		server.TokenValidationHandler()(rec, req)
+		return rec.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := validate(server, "cached-token"); code != http.StatusOK {
+			t.Fatalf("Expected the active token to validate, got %d", code)
+		}
+	}
+	if n := calls(); n != 1 {
+		t.Errorf("Expected one introspection for repeated validations, got %d", n)
+	}
+
+	// Another server doesn't share the cache
+	if code := validate(authentication.NewOAuth2Server(config, nil), "cached-token"); code != http.StatusOK || calls() != 2 {
+		t.Errorf("Expected a separate server to introspect the token itself, got %d after %d calls", code, calls())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/oauth2/revoke", nil)
+	req.Header.Set("Authorization", "Bearer cached-token")
+	rec := httptest.NewRecorder()
+	server.RevocationHandler()(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the revocation to succeed, got %d", rec.Code)
+	}
+	if code := validate(server, "cached-token"); code != http.StatusUnauthorized {
+		t.Errorf("Expected the revoked token to be rejected despite the cache, got %d", code)
+	}
+}
+
+// Test case for dropping a token family once its newest refresh token has expired
+func TestRefreshTokenFamilyExpires(t *testing.T) {
+	store := authentication.NewRefreshTokenStore(50 * time.Millisecond)
+	token, err := store.Issue("alice")
+	if err != nil {
+		t.Fatalf("Failed to issue refresh token: %v", err)
+	}
+	_, next, err := store.Rotate(token)
+	if err != nil {
+		t.Fatalf("Failed to rotate refresh token: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, _, err := store.Rotate(next); err != authentication.ErrRefreshTokenExpired {
+		t.Fatalf("Expected ErrRefreshTokenExpired, got %v", err)
+	}
+	// The expired family is gone, rotated tokens included
+	for _, old := range []string{token, next} {
+		if _, _, err := store.Rotate(old); err != authentication.ErrRefreshTokenInvalid {
+			t.Errorf("Expected ErrRefreshTokenInvalid for a token of the dropped family, got %v", err)
+		}
+	}
+}
+
+// Test case for concurrent block, unblock and connection checks against the firewall, run with -race
+func TestFirewallConcurrentAccess(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "firewall_log.txt")
+	fw := security.NewFirewall([]string{"10.0.0.0/8"}, []int{443}, logPath)
+	if fw == nil {
+		t.Fatalf("Failed to create firewall")
+	}
+	fw.SetRateLimit(1000, 1000)
+
+	const workers = 8
+	const iterations = 100
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ip := fmt.Sprintf("10.0.%d.1", i)
+			for j := 0; j < iterations; j++ {
+				fw.BlockIP(ip)
+				fw.SimulateConnection(ip, 443)
+				fw.UnblockIP(ip)
+				fw.SimulateConnection(ip, 22)
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < iterations; j++ {
+			fw.BlockIP("10.0.0.0/16")
+			fw.UnblockIP("10.0.0.0/16")
+			fw.SetRateLimit(1000, 1000)
+		}
+	}()
+	wg.Wait()
+
+	fw.BlockIP("10.1.0.0/16")
+	if fw.SimulateConnection("10.1.2.3", 443) {
+		t.Errorf("Expected an address in a blocked range to be denied")
+	}
+	if !fw.SimulateConnection("10.2.0.1", 443) {
+		t.Errorf("Expected a whitelisted address outside the blocked range to be allowed")
+	}
+	fw.Close()
+
+	data, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read the firewall log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) < workers*iterations {
+		t.Errorf("Expected at least %d log entries, got %d", workers*iterations, len(lines))
+	}
+	for _, line := range lines {
+		if strings.Count(line, " - Unauthorized access from ") != 1 {
+			t.Errorf("Expected one log entry per line, got %q", line)
+			break
+		}
+	}
+}